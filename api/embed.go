@@ -0,0 +1,10 @@
+// Package api embeds the OpenAPI document of the HTTP API, so the binary
+// serves the description of the routes it was built with.
+package api
+
+import (
+	_ "embed"
+)
+
+//go:embed openapi.yaml
+var Spec []byte
@@ -8,6 +8,7 @@ import (
 	"syscall"
 	"testovoe/internal/app"
 	"testovoe/internal/config"
+	"testovoe/internal/lib/tracing"
 )
 
 const (
@@ -35,18 +36,26 @@ $$ |            \$$$$$$$ |      $$$$$$$$\       $$ |  $$ |      \$$$$$$$ |
 
 	log.Info("Starting http", "env", cfg.Env)
 
-	application := app.New(log, cfg.Server.Port, cfg.Storage, cfg.TokenTTL)
+	application := app.New(log, cfg.Server, cfg.Storage, cfg.TokenTTL, cfg.Markdown.CacheSize, cfg.Auth, cfg.RateLimit, cfg.Metrics, cfg.GRPC, cfg.GraphQL, cfg.Tracing, cfg.LegacyAPI)
 
 	go application.HTTPServer.MustRun()
 
+	if application.GRPCServer != nil {
+		go application.GRPCServer.MustRun()
+	}
+
+	if application.MetricsServer != nil {
+		go application.MetricsServer.MustRun()
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	sign := <-stop
 
-	log.Info("Application stopped", slog.String("signal", sign.String()))
+	log.Info("Stopping application", slog.String("signal", sign.String()))
 
-	application.HTTPServer.Stop()
+	application.Stop()
 }
 
 func setupLogger(env string) *slog.Logger {
@@ -54,11 +63,11 @@ func setupLogger(env string) *slog.Logger {
 
 	switch env {
 	case envLocal:
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		log = slog.New(tracing.NewLogHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
 	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		log = slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
 	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		log = slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
 	}
 
 	return log
@@ -1,36 +1,379 @@
 package app
 
 import (
+	"context"
+	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
 	"log/slog"
+	"testovoe/api"
+	grpcserver "testovoe/internal/app/grpc"
 	server "testovoe/internal/app/http"
+	"testovoe/internal/config"
+	"testovoe/internal/handlers/adminHandlers"
+	"testovoe/internal/handlers/apiKeysHandlers"
+	"testovoe/internal/handlers/graphqlHandlers"
+	"testovoe/internal/handlers/mfaHandlers"
+	"testovoe/internal/handlers/notesGRPC"
 	"testovoe/internal/handlers/notesHandlers"
+	"testovoe/internal/lib/health"
+	"testovoe/internal/lib/markdown"
+	"testovoe/internal/lib/metrics"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/openapi"
+	"testovoe/internal/lib/ratelimit"
+	"testovoe/internal/lib/tracing"
 	"testovoe/internal/routes"
+	"testovoe/internal/services/apiKeysService"
+	"testovoe/internal/services/clientsService"
+	"testovoe/internal/services/importService"
+	"testovoe/internal/services/lockoutService"
+	"testovoe/internal/services/mfaService"
 	"testovoe/internal/services/notesService"
+	spellcheck "testovoe/internal/services/spellchecker"
+	"testovoe/internal/services/usersService"
 	"testovoe/internal/storage/postgres"
+	"testovoe/migrations"
 	"time"
 )
 
 type App struct {
-	HTTPServer *server.Server
+	log             *slog.Logger
+	HTTPServer      *server.Server
+	MetricsServer   *server.Server
+	GRPCServer      *grpcserver.Server
+	importer        closer
+	storage         closer
+	checker         drainer
+	stopTracing     func(ctx context.Context) error
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
 }
 
-func New(log *slog.Logger, serverPort, storagePath string, tokenTTL time.Duration) *App {
+// closer and drainer are what Stop needs of the import workers, the storage
+// pool and the readiness checker.
+type closer interface {
+	Close()
+}
+
+type drainer interface {
+	Drain()
+}
+
+func New(log *slog.Logger, serverCfg config.ServerConfig, storagePath string, tokenTTL time.Duration, renderCacheSize int, authCfg config.AuthConfig, rateCfg config.RateLimitConfig, metricsCfg config.MetricsConfig, grpcCfg config.GRPCConfig, graphqlCfg config.GraphQLConfig, tracingCfg config.TracingConfig, legacyCfg config.LegacyAPIConfig) *App {
+	stopTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: authCfg.Issuer,
+		Exporter:    tracingCfg.Exporter,
+		Endpoint:    tracingCfg.Endpoint,
+		Insecure:    tracingCfg.Insecure,
+		SampleRatio: tracingCfg.SampleRatio,
+	})
+	if err != nil {
+		panic(err)
+	}
+
 	storage, err := postgres.New(storagePath)
 	if err != nil {
 		panic(err)
 	}
 
-	noteService := notesService.NewNotesService(log, storage)
+	renderer := markdown.New(renderCacheSize)
 
-	noteHandlers := notesHandlers.NewNotesHandlers(noteService)
+	appMetrics := metrics.New()
+	appMetrics.RegisterPool(storage.PoolStat)
+
+	noteService := notesService.NewNotesService(log, storage, renderer, appMetrics)
+
+	importer := importService.NewImportService(log, noteService)
+
+	noteHandlers := notesHandlers.NewNotesHandlers(noteService, importer)
+
+	keys, err := loadKeys(log, authCfg)
+	if err != nil {
+		panic(err)
+	}
+
+	clientService := clientsService.NewClientsService(log, storage)
+
+	lockouts := lockoutService.NewLockoutService(log, storage, lockoutService.Policy{
+		MaxUserFailures: authCfg.Lockout.MaxUserFailures,
+		MaxIPFailures:   authCfg.Lockout.MaxIPFailures,
+		Duration:        authCfg.Lockout.Duration,
+		Window:          authCfg.Lockout.Window,
+	})
+
+	apiKeyService := apiKeysService.NewAPIKeysService(log, storage)
+
+	apiKeyHandlers := apiKeysHandlers.NewAPIKeysHandlers(apiKeyService)
+
+	mfa := mfaService.NewMFAService(log, storage, authCfg.Issuer)
+
+	mfaHandler := mfaHandlers.NewMFAHandlers(mfa)
+
+	users := usersService.NewUsersService(log, storage)
+
+	if err := seedUsers(users, authCfg.Users, authCfg.Admin); err != nil {
+		panic(err)
+	}
+
+	clients := oa.ClientStores{loadClients(authCfg), clientService}
+
+	authServer := oa.NewServer(authCfg.Issuer, tokenTTL, authCfg.RefreshTokenTTL, keys, &oa.UserVerifier{Users: users, Clients: clients, MFA: mfa, Guard: lockouts}, clients, storage, apiKeyService)
+
+	adminHandler := adminHandlers.NewAdminHandlers(clientService, lockouts, users, authServer)
+
+	oidcLogin, err := loadOIDC(authCfg.OIDC, authServer, users)
+	if err != nil {
+		panic(err)
+	}
+
+	limiter, err := loadRateLimiter(log, rateCfg, storage)
+	if err != nil {
+		panic(err)
+	}
+
+	checker, err := newHealthChecker(log, storage)
+	if err != nil {
+		panic(err)
+	}
+
+	spec, err := openapi.Load(api.Spec)
+	if err != nil {
+		panic(err)
+	}
+
+	access := oa.NewAccessControl(users)
+
+	graphqlHandler, err := graphqlHandlers.NewGraphQLHandlers(noteService, renderer, authServer, access, limiter, graphqlHandlers.Config{
+		Limits: graphqlHandlers.Limits{
+			MaxDepth:      graphqlCfg.MaxDepth,
+			MaxComplexity: graphqlCfg.MaxComplexity,
+		},
+		PollInterval: graphqlCfg.PollInterval,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if legacyCfg.Sunset.Before(time.Now()) {
+		log.Warn("the sunset of the legacy note routes has passed", slog.Time("sunset", legacyCfg.Sunset))
+	}
 
 	r := chi.NewRouter()
-	r = routes.InitRoutes(log, noteHandlers, r)
+	r = routes.InitRoutes(log, noteHandlers, adminHandler, apiKeyHandlers, mfaHandler, graphqlHandler, authServer, access, limiter, checker, appMetrics, spec, oidcLogin, legacyCfg, r)
+
+	newServer := server.NewServer(log, serverCfg, r)
 
-	newServer := server.NewServer(log, serverPort, r)
+	var metricsServer *server.Server
+	if metricsCfg.Port != "" {
+		metricsRouter := chi.NewRouter()
+		metricsRouter.Handle("/metrics", appMetrics.Handler())
+
+		metricsServerCfg := serverCfg
+		metricsServerCfg.Port = metricsCfg.Port
+		metricsServer = server.NewServer(log, metricsServerCfg, metricsRouter)
+	}
+
+	var grpcServer *grpcserver.Server
+	if grpcCfg.Port != "" {
+		auth := grpcserver.NewAuth(authServer, access, notesGRPC.Scopes)
+		grpcServer = grpcserver.NewServer(log, grpcCfg, auth, limiter, notesGRPC.NewNotesServer(noteService))
+	}
 
 	return &App{
-		HTTPServer: newServer,
+		log:             log,
+		HTTPServer:      newServer,
+		MetricsServer:   metricsServer,
+		GRPCServer:      grpcServer,
+		importer:        importer,
+		storage:         storage,
+		checker:         checker,
+		stopTracing:     stopTracing,
+		shutdownTimeout: serverCfg.ShutdownTimeout,
+		drainDelay:      serverCfg.DrainDelay,
 	}
 }
+
+// Stop shuts down in dependency order: readiness fails first so that no new
+// traffic arrives, then the HTTP and gRPC servers drain the calls in flight,
+// the import workers stop, and only then the storage pool they all use is
+// closed. Buffered spans are flushed at the very end.
+func (a *App) Stop() {
+	const op = "app.Stop"
+
+	log := a.log.With(slog.String("op", op))
+
+	a.checker.Drain()
+	if a.GRPCServer != nil {
+		a.GRPCServer.Drain()
+	}
+	time.Sleep(a.drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	if err := a.HTTPServer.Stop(ctx); err != nil {
+		log.Error("failed to stop HTTP server", slog.String("error", err.Error()))
+	}
+
+	if a.GRPCServer != nil {
+		if err := a.GRPCServer.Stop(ctx); err != nil {
+			log.Error("failed to stop gRPC server", slog.String("error", err.Error()))
+		}
+	}
+
+	if a.MetricsServer != nil {
+		if err := a.MetricsServer.Stop(ctx); err != nil {
+			log.Error("failed to stop metrics server", slog.String("error", err.Error()))
+		}
+	}
+
+	a.importer.Close()
+
+	a.storage.Close()
+
+	// last, so the spans of the shutdown itself are flushed too
+	if err := a.stopTracing(ctx); err != nil {
+		log.Error("failed to flush traces", slog.String("error", err.Error()))
+	}
+
+	log.Info("application stopped")
+}
+
+func loadKeys(log *slog.Logger, authCfg config.AuthConfig) (*oa.KeySet, error) {
+	if len(authCfg.Keys) == 0 {
+		log.Warn("no token signing keys configured, using an ephemeral key")
+		return oa.NewEphemeralKeySet()
+	}
+
+	specs := make([]oa.KeySpec, 0, len(authCfg.Keys))
+	for _, k := range authCfg.Keys {
+		specs = append(specs, oa.KeySpec{
+			ID:             k.ID,
+			Algorithm:      k.Algorithm,
+			PrivateKey:     k.PrivateKey,
+			PrivateKeyFile: k.PrivateKeyFile,
+			PublicKeyFile:  k.PublicKeyFile,
+		})
+	}
+
+	return oa.NewKeySet(specs, authCfg.SigningKeyID)
+}
+
+func loadClients(authCfg config.AuthConfig) oa.StaticClients {
+	clients := make([]oa.Client, 0, len(authCfg.Clients))
+	for _, c := range authCfg.Clients {
+		client := oa.Client{
+			ID:           c.ID,
+			Name:         c.Name,
+			GrantTypes:   c.GrantTypes,
+			RedirectURIs: c.RedirectURIs,
+			Scopes:       c.Scopes,
+		}
+		if c.Secret != "" {
+			client.SecretHash = oa.HashSecret(c.Secret)
+		}
+		if len(client.GrantTypes) == 0 {
+			client.GrantTypes = []string{string(oauth.AuthCodeGrant)}
+		}
+
+		clients = append(clients, client)
+	}
+
+	return oa.NewStaticClients(clients)
+}
+
+func newHealthChecker(log *slog.Logger, storage *postgres.Storage) (*health.Checker, error) {
+	latest, err := migrations.LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return health.New(log, 3*time.Second,
+		health.Check{Name: "postgres", Critical: true, Probe: storage.Ping},
+		health.Check{Name: "migrations", Critical: true, Probe: func(ctx context.Context) error {
+			version, err := storage.MigrationVersion(ctx)
+			if err != nil {
+				return err
+			}
+
+			// a newer instance may already have migrated further during a rollout
+			if version < latest {
+				return fmt.Errorf("schema version %d, want %d", version, latest)
+			}
+
+			return nil
+		}},
+		// every instance shares the speller, so its outage must not take them all out
+		health.Check{Name: "spellchecker", Probe: spellcheck.Ping, CacheFor: 30 * time.Second},
+	), nil
+}
+
+func loadRateLimiter(log *slog.Logger, cfg config.RateLimitConfig, storage *postgres.Storage) (*ratelimit.Limiter, error) {
+	var store ratelimit.Store
+	switch cfg.Backend {
+	case "", "memory":
+		store = ratelimit.NewMemoryStore()
+	case "postgres":
+		store = ratelimit.NewSharedStore(log, storage)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+	}
+
+	routeLimits := make(map[string]ratelimit.Limit, len(cfg.Routes))
+	for route, l := range cfg.Routes {
+		routeLimits[route] = limitFromConfig(l)
+	}
+
+	return ratelimit.New(log, store, limitFromConfig(cfg.Default), routeLimits), nil
+}
+
+func limitFromConfig(l config.LimitConfig) ratelimit.Limit {
+	if l.Requests <= 0 || l.Period <= 0 {
+		return ratelimit.Limit{}
+	}
+
+	return ratelimit.PerPeriod(l.Requests, l.Period, l.Burst)
+}
+
+func seedUsers(users *usersService.UsersService, cfg []config.UserConfig, admin config.AdminConfig) error {
+	seed := make([]usersService.SeedUser, 0, len(cfg))
+	for _, u := range cfg {
+		seed = append(seed, usersService.SeedUser{
+			Username: u.Username,
+			Password: u.Password,
+			Role:     u.Role,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := users.SeedAdmin(ctx, usersService.SeedUser{
+		Username:     admin.Username,
+		Password:     admin.Password,
+		PasswordHash: admin.PasswordHash,
+	}); err != nil {
+		return err
+	}
+
+	return users.SeedUsers(ctx, seed)
+}
+
+func loadOIDC(cfg config.OIDCConfig, authServer *oa.Server, users *usersService.UsersService) (*oa.OIDCLogin, error) {
+	if cfg.IssuerURL == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return oa.NewOIDCLogin(ctx, oa.OIDCConfig{
+		IssuerURL:     cfg.IssuerURL,
+		ClientID:      cfg.ClientID,
+		ClientSecret:  cfg.ClientSecret,
+		RedirectURL:   cfg.RedirectURL,
+		Scopes:        cfg.Scopes,
+		UsernameClaim: cfg.UsernameClaim,
+	}, authServer, users)
+}
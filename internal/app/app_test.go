@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	server "testovoe/internal/app/http"
+	"testovoe/internal/config"
+	"time"
+)
+
+// shutdownLog записывает шаги остановки в порядке их выполнения
+type shutdownLog struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (l *shutdownLog) add(step string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.steps = append(l.steps, step)
+}
+
+type step struct {
+	name string
+	log  *shutdownLog
+}
+
+func (s step) Close() { s.log.add(s.name) }
+
+func (s step) Drain() { s.log.add(s.name) }
+
+func TestApp_StopOrder(t *testing.T) {
+	steps := &shutdownLog{}
+	started := make(chan struct{})
+
+	r := chi.NewRouter()
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		steps.add("request")
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	httpServer := server.NewServer(log, config.ServerConfig{}, r)
+	go func() {
+		_ = httpServer.Serve(lis)
+	}()
+
+	a := &App{
+		log:        log,
+		HTTPServer: httpServer,
+		importer:   step{name: "importer", log: steps},
+		storage:    step{name: "storage", log: steps},
+		checker:    step{name: "readiness", log: steps},
+		stopTracing: func(ctx context.Context) error {
+			steps.add("tracing")
+			return nil
+		},
+		shutdownTimeout: time.Second,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.Get("http://" + lis.Addr().String() + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	a.Stop()
+	<-done
+
+	// запрос в полёте завершается до того, как закрываются воркеры и пул
+	want := []string{"readiness", "request", "importer", "storage", "tracing"}
+	if !reflect.DeepEqual(steps.steps, want) {
+		t.Errorf("shutdown order = %v, want %v", steps.steps, want)
+	}
+}
@@ -0,0 +1,274 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/lib/ratelimit"
+	"time"
+)
+
+// errorDomain is the domain of the ErrorInfo attached to statuses, whose
+// reason is the same code the HTTP API puts into problem details.
+const errorDomain = "notes-service"
+
+var (
+	errMissingToken      = apperr.Unauthorized("invalid_authorization_header", "missing bearer token or API key")
+	errInsufficientScope = apperr.Forbidden("insufficient_scope", "insufficient scope")
+)
+
+// codeRateLimited is the reason of rejected calls, as in the HTTP API.
+const codeRateLimited = "rate_limited"
+
+var codesByKind = map[apperr.Kind]codes.Code{
+	apperr.KindValidation:   codes.InvalidArgument,
+	apperr.KindUnauthorized: codes.Unauthenticated,
+	apperr.KindForbidden:    codes.PermissionDenied,
+	apperr.KindNotFound:     codes.NotFound,
+	apperr.KindConflict:     codes.FailedPrecondition,
+	apperr.KindUnavailable:  codes.Unavailable,
+}
+
+// publicServices need no token: load balancers and tools such as grpcurl
+// call them anonymously.
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (context.Context, error)
+}
+
+type AccessChecker interface {
+	CheckActive(ctx context.Context) error
+}
+
+// Auth checks calls the way Authorize, RequireActive and RequireScope
+// check HTTP requests. The token comes from the "authorization" (bearer)
+// or "x-api-key" metadata.
+type Auth struct {
+	authenticator Authenticator
+	access        AccessChecker
+	scopes        map[string]string
+}
+
+// NewAuth takes the scope every method needs; methods without one are
+// rejected, so a new method cannot be exposed by accident.
+func NewAuth(authenticator *oa.Server, access *oa.AccessControl, scopes map[string]string) *Auth {
+	return &Auth{
+		authenticator: authenticator,
+		access:        access,
+		scopes:        scopes,
+	}
+}
+
+func (a *Auth) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(info.FullMethod, prefix) {
+			return handler(ctx, req)
+		}
+	}
+
+	token, ok := tokenFromMetadata(ctx)
+	if !ok {
+		return nil, errMissingToken
+	}
+
+	ctx, err := a.authenticator.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.access.CheckActive(ctx); err != nil {
+		return nil, err
+	}
+
+	scope, ok := a.scopes[info.FullMethod]
+	if !ok || !oa.HasScope(oa.Scope(ctx), scope) {
+		return nil, errInsufficientScope
+	}
+
+	args := []any{}
+	if user, ok := oa.Credential(ctx); ok {
+		args = append(args, slog.String("user", user))
+	}
+	if actor, ok := oa.ImpersonatedBy(ctx); ok {
+		args = append(args, slog.String("actor", actor))
+	}
+
+	return handler(logger.With(ctx, slog.Default(), args...), req)
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, route, caller string) (ratelimit.Limit, ratelimit.Result, error)
+}
+
+// rateLimit applies the limits of the HTTP API to calls, keyed by the full
+// method name ("/notes.v1.NotesService/CreateNote") and the caller. It
+// runs after Auth, so that callers are told apart by their token. When
+// the limiter fails, calls are let through.
+func rateLimit(limiter RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		caller, ok := ratelimit.Caller(ctx)
+		if !ok {
+			caller = "ip:" + peerHost(ctx)
+		}
+
+		_, res, err := limiter.Allow(ctx, info.FullMethod, caller)
+		if err == nil && !res.Allowed {
+			st := withReason(status.New(codes.ResourceExhausted, "too many requests"), codeRateLimited)
+			if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(res.RetryAfter)}); err == nil {
+				st = detailed
+			}
+
+			return nil, st.Err()
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func tokenFromMetadata(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if keys := md.Get("x-api-key"); len(keys) > 0 && keys[0] != "" {
+		return keys[0], true
+	}
+
+	auths := md.Get("authorization")
+	if len(auths) == 0 {
+		return "", false
+	}
+
+	auth := auths[0]
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return "", false
+	}
+
+	return auth[7:], true
+}
+
+// logRequests puts a request logger into the context, like the HTTP
+// logger middleware, and logs every call when it completes. The request
+// ID is taken from the "x-request-id" metadata when the caller sent one.
+func logRequests(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		requestID := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get("x-request-id"); len(ids) > 0 {
+				requestID = ids[0]
+			}
+		}
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+
+		reqLog := log.With(slog.String("request_id", requestID))
+
+		t1 := time.Now()
+
+		resp, err := handler(logger.WithLogger(ctx, reqLog), req)
+
+		reqLog.InfoContext(ctx, "call completed",
+			slog.String("method", info.FullMethod),
+			slog.String("code", status.Code(err).String()),
+			slog.String("duration", time.Since(t1).String()),
+		)
+
+		return resp, err
+	}
+}
+
+func recoverPanics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.FromContext(ctx, slog.Default()).ErrorContext(ctx, "panic in gRPC handler",
+				slog.String("method", info.FullMethod),
+				slog.String("panic", fmt.Sprint(p)),
+				slog.String("stack", string(debug.Stack())),
+			)
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// statusErrors turns the domain errors returned by handlers into statuses,
+// the gRPC counterpart of problem.Error.
+func statusErrors(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return nil, err
+	}
+
+	return nil, toStatus(ctx, err).Err()
+}
+
+func toStatus(ctx context.Context, err error) *status.Status {
+	log := logger.FromContext(ctx, slog.Default())
+
+	var code codes.Code
+	e, ok := apperr.As(err)
+	if ok {
+		code, ok = codesByKind[e.Kind]
+	}
+	if !ok {
+		log.ErrorContext(ctx, "call failed", slog.String("error", err.Error()))
+
+		return withReason(status.New(codes.Internal, "internal error"), problem.CodeInternal)
+	}
+
+	if code == codes.Unavailable {
+		log.WarnContext(ctx, "dependency unavailable", slog.String("error", err.Error()))
+	}
+
+	return withReason(status.New(code, e.Message), e.Code)
+}
+
+func withReason(st *status.Status, reason string) *status.Status {
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: errorDomain,
+	})
+	if err != nil {
+		return st
+	}
+
+	return detailed
+}
@@ -0,0 +1,118 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"log/slog"
+	"net"
+	notesv1 "testovoe/api/notes/v1"
+	"testovoe/internal/config"
+)
+
+// Server serves the gRPC API next to the HTTP one, together with the
+// standard health service and server reflection.
+type Server struct {
+	log        *slog.Logger
+	addr       string
+	grpcServer *grpc.Server
+	health     *health.Server
+}
+
+func NewServer(log *slog.Logger, cfg config.GRPCConfig, auth *Auth, limiter RateLimiter, notes notesv1.NotesServiceServer) *Server {
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			logRequests(log),
+			recoverPanics,
+			statusErrors,
+			auth.Unary,
+			rateLimit(limiter),
+		),
+	)
+
+	notesv1.RegisterNotesServiceServer(grpcServer, notes)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(notesv1.NotesService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	reflection.Register(grpcServer)
+
+	return &Server{
+		log:        log,
+		addr:       fmt.Sprintf(":%s", cfg.Port),
+		grpcServer: grpcServer,
+		health:     healthServer,
+	}
+}
+
+func (s *Server) MustRun() {
+	if err := s.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run serves until Stop is called.
+func (s *Server) Run() error {
+	const op = "GRPCServer.Run"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("addr", s.addr),
+	)
+
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("gRPC server started")
+
+	if err := s.grpcServer.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Drain reports every service as not serving, so that clients balancing
+// on the health service move away before Stop.
+func (s *Server) Drain() {
+	s.health.Shutdown()
+}
+
+// Stop stops accepting connections and waits for the calls in flight
+// until ctx is done; whatever is still running then is cut off.
+func (s *Server) Stop(ctx context.Context) error {
+	const op = "GRPCServer.Stop"
+
+	log := s.log.With(slog.String("op", op))
+
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Warn("gRPC server did not drain in time", slog.String("error", ctx.Err().Error()))
+
+		s.grpcServer.Stop()
+
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+
+	log.Info("gRPC server stopped")
+
+	return nil
+}
@@ -0,0 +1,474 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/oauth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	notesv1 "testovoe/api/notes/v1"
+	"testovoe/internal/config"
+	"testovoe/internal/lib/apperr"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/ratelimit"
+	"testovoe/internal/services/notesService"
+	"time"
+)
+
+// fakeAuthenticator знает только токены из tokens (токен -> scope)
+type fakeAuthenticator struct {
+	tokens map[string]string
+}
+
+func (f *fakeAuthenticator) Authenticate(ctx context.Context, token string) (context.Context, error) {
+	scope, ok := f.tokens[token]
+	if !ok {
+		return ctx, apperr.Unauthorized("invalid_token", "invalid token")
+	}
+
+	ctx = context.WithValue(ctx, oauth.CredentialContext, "alice")
+	ctx = context.WithValue(ctx, oauth.ScopeContext, scope)
+
+	return ctx, nil
+}
+
+type fakeAccess struct {
+	err error
+}
+
+func (f *fakeAccess) CheckActive(ctx context.Context) error {
+	return f.err
+}
+
+type fakeNotes struct {
+	notesv1.UnimplementedNotesServiceServer
+}
+
+func (f *fakeNotes) GetNote(ctx context.Context, req *notesv1.GetNoteRequest) (*notesv1.Note, error) {
+	owner, _ := oa.Credential(ctx)
+	if req.GetId() == "missing" {
+		return nil, notesService.ErrNoteNotFound
+	}
+	if req.GetId() == "broken" {
+		return nil, errors.New("connection refused")
+	}
+
+	return &notesv1.Note{Id: req.GetId(), Content: "text", Owner: owner}, nil
+}
+
+func (f *fakeNotes) CreateNote(ctx context.Context, req *notesv1.CreateNoteRequest) (*notesv1.Note, error) {
+	switch req.GetContent() {
+	case "":
+		return nil, apperr.Validation("empty_content", "content is required")
+	case "tpyo":
+		return nil, notesService.ErrSpellingErrors
+	case "speller down":
+		return nil, fmt.Errorf("notesService.checkSpelling: %w: %w", notesService.ErrSpellerUnavailable, errors.New("timeout"))
+	}
+
+	return &notesv1.Note{Id: "123", Content: req.GetContent()}, nil
+}
+
+func (f *fakeNotes) UpdateNote(ctx context.Context, req *notesv1.UpdateNoteRequest) (*notesv1.Note, error) {
+	if req.GetId() == "missing" {
+		return nil, fmt.Errorf("notesService.UpdateNote: %w", notesService.ErrNoteNotFound)
+	}
+
+	return &notesv1.Note{Id: req.GetId(), Content: req.GetContent()}, nil
+}
+
+func (f *fakeNotes) DeleteNote(ctx context.Context, req *notesv1.DeleteNoteRequest) (*notesv1.DeleteNoteResponse, error) {
+	switch req.GetId() {
+	case "missing":
+		return nil, fmt.Errorf("notesService.DeleteNote: %w", notesService.ErrNoteNotFound)
+	case "broken":
+		return nil, errors.New("connection refused")
+	}
+
+	return &notesv1.DeleteNoteResponse{}, nil
+}
+
+func (f *fakeNotes) SearchNotes(ctx context.Context, req *notesv1.SearchNotesRequest) (*notesv1.SearchNotesResponse, error) {
+	if req.GetQuery() == "" {
+		return nil, fmt.Errorf("notesService.SearchNotes: %w", notesService.ErrEmptyQuery)
+	}
+
+	return &notesv1.SearchNotesResponse{}, nil
+}
+
+func unlimited() *ratelimit.Limiter {
+	return ratelimit.New(slog.New(slog.NewTextHandler(io.Discard, nil)), ratelimit.NewMemoryStore(), ratelimit.Limit{}, nil)
+}
+
+func newTestClient(t *testing.T, access AccessChecker, limiter RateLimiter) *grpc.ClientConn {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	auth := &Auth{
+		authenticator: &fakeAuthenticator{tokens: map[string]string{
+			"reader": oa.ScopeNotesRead,
+			"writer": oa.ScopeNotesRead + " " + oa.ScopeNotesWrite,
+			"admin":  oa.ScopeAdmin,
+		}},
+		access: access,
+		// ListNotes намеренно без scope: такие методы должны быть закрыты
+		scopes: map[string]string{
+			notesv1.NotesService_CreateNote_FullMethodName:  oa.ScopeNotesWrite,
+			notesv1.NotesService_GetNote_FullMethodName:     oa.ScopeNotesRead,
+			notesv1.NotesService_UpdateNote_FullMethodName:  oa.ScopeNotesWrite,
+			notesv1.NotesService_DeleteNote_FullMethodName:  oa.ScopeNotesWrite,
+			notesv1.NotesService_SearchNotes_FullMethodName: oa.ScopeNotesRead,
+		},
+	}
+
+	s := NewServer(log, config.GRPCConfig{}, auth, limiter, &fakeNotes{})
+
+	lis := bufconn.Listen(1 << 20)
+	go s.grpcServer.Serve(lis)
+	t.Cleanup(s.grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestGetNote(t *testing.T) {
+	tests := []struct {
+		name         string
+		md           []string
+		access       AccessChecker
+		id           string
+		expectedCode codes.Code
+		reason       string
+	}{
+		{
+			name:         "Valid Request",
+			md:           []string{"authorization", "Bearer reader"},
+			access:       &fakeAccess{},
+			id:           "123",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "API Key",
+			md:           []string{"x-api-key", "reader"},
+			access:       &fakeAccess{},
+			id:           "123",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "Missing Token",
+			access:       &fakeAccess{},
+			id:           "123",
+			expectedCode: codes.Unauthenticated,
+			reason:       "invalid_authorization_header",
+		},
+		{
+			name:         "Invalid Token",
+			md:           []string{"authorization", "Bearer nope"},
+			access:       &fakeAccess{},
+			id:           "123",
+			expectedCode: codes.Unauthenticated,
+			reason:       "invalid_token",
+		},
+		{
+			name:         "Disabled User",
+			md:           []string{"authorization", "Bearer reader"},
+			access:       &fakeAccess{err: apperr.Unauthorized("account_disabled", "account is disabled")},
+			id:           "123",
+			expectedCode: codes.Unauthenticated,
+			reason:       "account_disabled",
+		},
+		{
+			name:         "Insufficient Scope",
+			md:           []string{"authorization", "Bearer admin"},
+			access:       &fakeAccess{},
+			id:           "123",
+			expectedCode: codes.PermissionDenied,
+			reason:       "insufficient_scope",
+		},
+		{
+			name:         "Note Not Found",
+			md:           []string{"authorization", "Bearer reader"},
+			access:       &fakeAccess{},
+			id:           "missing",
+			expectedCode: codes.NotFound,
+			reason:       "note_not_found",
+		},
+		{
+			// внутренние ошибки не должны утекать клиенту
+			name:         "Internal Error",
+			md:           []string{"authorization", "Bearer reader"},
+			access:       &fakeAccess{},
+			id:           "broken",
+			expectedCode: codes.Internal,
+			reason:       "internal_error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := notesv1.NewNotesServiceClient(newTestClient(t, tt.access, unlimited()))
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tt.md...)
+			note, err := client.GetNote(ctx, &notesv1.GetNoteRequest{Id: tt.id})
+
+			st := status.Convert(err)
+			if st.Code() != tt.expectedCode {
+				t.Fatalf("code = %v, want %v (%s)", st.Code(), tt.expectedCode, st.Message())
+			}
+
+			if tt.expectedCode == codes.OK {
+				if note.GetOwner() != "alice" {
+					t.Errorf("owner = %q, want alice", note.GetOwner())
+				}
+				return
+			}
+
+			if tt.expectedCode == codes.Internal && st.Message() != "internal error" {
+				t.Errorf("message = %q", st.Message())
+			}
+
+			if reason := reasonOf(st); reason != tt.reason {
+				t.Errorf("reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestHealthIsPublic(t *testing.T) {
+	client := healthpb.NewHealthClient(newTestClient(t, &fakeAccess{}, unlimited()))
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: notesv1.NotesService_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v, want SERVING", resp.GetStatus())
+	}
+}
+
+func reasonOf(st *status.Status) string {
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+
+	return ""
+}
+
+func TestWriteMethods(t *testing.T) {
+	noteID := "123e4567-e89b-12d3-a456-426614174000"
+
+	tests := []struct {
+		name         string
+		token        string
+		call         func(ctx context.Context, client notesv1.NotesServiceClient) error
+		expectedCode codes.Code
+		reason       string
+	}{
+		{
+			name:  "Create",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Content: "hello"})
+				return err
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			// scope notes:read не даёт писать
+			name:  "Create With Read Scope",
+			token: "reader",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Content: "hello"})
+				return err
+			},
+			expectedCode: codes.PermissionDenied,
+			reason:       "insufficient_scope",
+		},
+		{
+			name:  "Create Empty",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{})
+				return err
+			},
+			expectedCode: codes.InvalidArgument,
+			reason:       "empty_content",
+		},
+		{
+			name:  "Create With Spelling Errors",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Content: "tpyo"})
+				return err
+			},
+			expectedCode: codes.InvalidArgument,
+			reason:       "spelling_errors",
+		},
+		{
+			name:  "Create While Speller Is Down",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Content: "speller down"})
+				return err
+			},
+			expectedCode: codes.Unavailable,
+			reason:       "speller_unavailable",
+		},
+		{
+			name:  "Update Missing Note",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.UpdateNote(ctx, &notesv1.UpdateNoteRequest{Id: "missing", Content: "hello"})
+				return err
+			},
+			expectedCode: codes.NotFound,
+			reason:       "note_not_found",
+		},
+		{
+			name:  "Update With Read Scope",
+			token: "reader",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.UpdateNote(ctx, &notesv1.UpdateNoteRequest{Id: noteID, Content: "hello"})
+				return err
+			},
+			expectedCode: codes.PermissionDenied,
+			reason:       "insufficient_scope",
+		},
+		{
+			name:  "Delete",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.DeleteNote(ctx, &notesv1.DeleteNoteRequest{Id: noteID})
+				return err
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name:  "Delete Missing Note",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.DeleteNote(ctx, &notesv1.DeleteNoteRequest{Id: "missing"})
+				return err
+			},
+			expectedCode: codes.NotFound,
+			reason:       "note_not_found",
+		},
+		{
+			name:  "Delete Internal Error",
+			token: "writer",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.DeleteNote(ctx, &notesv1.DeleteNoteRequest{Id: "broken"})
+				return err
+			},
+			expectedCode: codes.Internal,
+			reason:       "internal_error",
+		},
+		{
+			name:  "Search Empty Query",
+			token: "reader",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.SearchNotes(ctx, &notesv1.SearchNotesRequest{})
+				return err
+			},
+			expectedCode: codes.InvalidArgument,
+			reason:       "empty_query",
+		},
+		{
+			name:  "Method Without Scope",
+			token: "admin",
+			call: func(ctx context.Context, client notesv1.NotesServiceClient) error {
+				_, err := client.ListNotes(ctx, &notesv1.ListNotesRequest{})
+				return err
+			},
+			expectedCode: codes.PermissionDenied,
+			reason:       "insufficient_scope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := notesv1.NewNotesServiceClient(newTestClient(t, &fakeAccess{}, unlimited()))
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tt.token)
+			st := status.Convert(tt.call(ctx, client))
+
+			if st.Code() != tt.expectedCode {
+				t.Fatalf("code = %v, want %v (%s)", st.Code(), tt.expectedCode, st.Message())
+			}
+			if reason := reasonOf(st); reason != tt.reason {
+				t.Errorf("reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	conn := newTestClient(t, &fakeAccess{}, unlimited())
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer writer")
+	err := conn.Invoke(ctx, "/notes.v1.NotesService/DropAllNotes", &notesv1.ListNotesRequest{}, &notesv1.ListNotesResponse{})
+
+	if code := status.Code(err); code != codes.Unimplemented {
+		t.Errorf("code = %v, want %v", code, codes.Unimplemented)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimit.New(slog.New(slog.NewTextHandler(io.Discard, nil)), ratelimit.NewMemoryStore(), ratelimit.Limit{}, map[string]ratelimit.Limit{
+		notesv1.NotesService_CreateNote_FullMethodName: ratelimit.PerPeriod(1, time.Minute, 1),
+	})
+	conn := newTestClient(t, &fakeAccess{}, limiter)
+	client := notesv1.NewNotesServiceClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer writer")
+	if _, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Content: "hello"}); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+
+	_, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Content: "hello"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || reasonOf(st) != "rate_limited" {
+		t.Fatalf("second call = %v, %q, want rate limited", st.Code(), reasonOf(st))
+	}
+
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			retry = info
+		}
+	}
+	if retry == nil || retry.GetRetryDelay().AsDuration() != time.Minute {
+		t.Errorf("retry info = %v, want a minute", retry)
+	}
+
+	// у других методов свои лимиты
+	if _, err := client.GetNote(ctx, &notesv1.GetNoteRequest{Id: "123"}); err != nil {
+		t.Errorf("GetNote() error = %v", err)
+	}
+}
@@ -2,29 +2,32 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"log/slog"
+	"net"
 	"net/http"
-	"time"
+	"testovoe/internal/config"
 )
 
 type Server struct {
-	log          *slog.Logger
-	port         string
-	router       *chi.Mux
-	httpServer   *http.Server
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	log        *slog.Logger
+	httpServer *http.Server
 }
 
-func NewServer(log *slog.Logger, port string, router *chi.Mux) *Server {
+func NewServer(log *slog.Logger, cfg config.ServerConfig, router *chi.Mux) *Server {
 	return &Server{
-		log:          log,
-		port:         port,
-		router:       router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		log: log,
+		httpServer: &http.Server{
+			Addr:              fmt.Sprintf(":%s", cfg.Port),
+			Handler:           router,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelWarn),
+		},
 	}
 }
 
@@ -34,28 +37,55 @@ func (s *Server) MustRun() {
 	}
 }
 
+// Run serves until Stop is called.
 func (s *Server) Run() error {
 	const op = "HTTPServer.Run"
 
 	log := s.log.With(
 		slog.String("op", op),
-		slog.String("port", s.port),
+		slog.String("addr", s.httpServer.Addr),
 	)
 
-	log.Info("HTTP http started")
+	lis, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", s.port), s.router); err != nil {
+	log.Info("HTTP server started")
+
+	return s.Serve(lis)
+}
+
+// Serve serves on lis until Stop is called.
+func (s *Server) Serve(lis net.Listener) error {
+	const op = "HTTPServer.Serve"
+
+	if err := s.httpServer.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Server) Stop() error {
+// Stop stops accepting connections and waits for the requests in flight
+// until ctx is done; whatever is still running then is cut off.
+func (s *Server) Stop(ctx context.Context) error {
 	const op = "HTTPServer.Stop"
 
-	s.log.With(slog.String("op", op)).
-		Info("HTTP http stopped")
+	log := s.log.With(slog.String("op", op))
+
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Warn("HTTP server did not drain in time", slog.String("error", err.Error()))
 
-	return s.httpServer.Shutdown(context.Background())
+		if err := s.httpServer.Close(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("HTTP server stopped")
+
+	return nil
 }
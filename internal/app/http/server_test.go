@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"testovoe/internal/config"
+	"time"
+)
+
+// startServer запускает сервер с одним медленным маршрутом; /slow ждёт release
+func startServer(t *testing.T, release <-chan struct{}) (*Server, string, <-chan struct{}) {
+	t.Helper()
+
+	started := make(chan struct{}, 1)
+	r := chi.NewRouter()
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte("done"))
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), config.ServerConfig{}, r)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	return s, "http://" + lis.Addr().String(), started
+}
+
+type result struct {
+	body string
+	err  error
+}
+
+func get(url string) <-chan result {
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			ch <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		ch <- result{body: string(body), err: err}
+	}()
+
+	return ch
+}
+
+func TestServer_StopDrainsRequestsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	s, url, started := startServer(t, release)
+
+	inFlight := get(url + "/slow")
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.Stop(context.Background())
+	}()
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop() returned %v before the request in flight finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// новые соединения уже не принимаются
+	if _, err := http.Get(url + "/slow"); err == nil {
+		t.Error("request after Stop succeeded, want it refused")
+	}
+
+	close(release)
+
+	if res := <-inFlight; res.err != nil || res.body != "done" {
+		t.Errorf("request in flight = %q, %v, want it completed", res.body, res.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+}
+
+func TestServer_StopCutsOffAfterDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	s, url, started := startServer(t, release)
+
+	inFlight := get(url + "/slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if res := <-inFlight; res.err == nil {
+		t.Errorf("request in flight = %q, want it cut off", res.body)
+	}
+}
@@ -8,15 +8,164 @@ import (
 )
 
 type Config struct {
-	Env      string        `yaml:"env" env-default:"local"`
-	Storage  string        `yaml:"storage" required:"true"`
-	TokenTTL time.Duration `yaml:"token_ttl" required:"true"`
-	Server   ServerConfig
+	Env       string        `yaml:"env" env-default:"local"`
+	Storage   string        `yaml:"storage" required:"true"`
+	TokenTTL  time.Duration `yaml:"token_ttl" required:"true"`
+	Server    ServerConfig
+	Markdown  MarkdownConfig  `yaml:"markdown"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	GRPC      GRPCConfig      `yaml:"grpc"`
+	GraphQL   GraphQLConfig   `yaml:"graphql"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	LegacyAPI LegacyAPIConfig `yaml:"legacy_api"`
 }
 
+// ServerConfig sets the HTTP server timeouts. On shutdown readiness fails
+// for DrainDelay before the server stops, and requests in flight then get
+// ShutdownTimeout to finish.
 type ServerConfig struct {
-	Port    string `yaml:"port" env-required:"true"`
-	Timeout string `yaml:"timeout" env-required:"true"`
+	Port              string        `yaml:"port" env-required:"true"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env-default:"30s"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env-default:"5s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env-default:"30s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env-default:"120s"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env-default:"15s"`
+	DrainDelay        time.Duration `yaml:"drain_delay" env-default:"5s"`
+}
+
+// LegacyAPIConfig dates the deprecation of the note routes from before
+// /api/v1, announced to clients in the Deprecation and Sunset headers.
+type LegacyAPIConfig struct {
+	DeprecatedAt time.Time `yaml:"deprecated_at" env-default:"2024-11-01T00:00:00Z"`
+	Sunset       time.Time `yaml:"sunset" env:"LEGACY_API_SUNSET" env-default:"2027-05-01T00:00:00Z"`
+}
+
+type MarkdownConfig struct {
+	CacheSize int `yaml:"cache_size" env-default:"1024"`
+}
+
+// MetricsConfig sets the admin port /metrics is served on, away from the
+// public API. Without a port metrics are not served.
+type MetricsConfig struct {
+	Port string `yaml:"port" env:"METRICS_PORT"`
+}
+
+// GRPCConfig sets the port of the gRPC API. Without a port it is not
+// served.
+type GRPCConfig struct {
+	Port string `yaml:"port" env:"GRPC_PORT"`
+}
+
+// GraphQLConfig limits the operations sent to /graphql: how deeply they
+// nest and their estimated cost (one point per field, times the size of
+// the lists it is under). Subscriptions poll the change feed every
+// PollInterval.
+type GraphQLConfig struct {
+	MaxDepth      int           `yaml:"max_depth" env-default:"8"`
+	MaxComplexity int           `yaml:"max_complexity" env-default:"1000"`
+	PollInterval  time.Duration `yaml:"poll_interval" env-default:"2s"`
+}
+
+// TracingConfig selects the span exporter: "none", "stdout" or "otlp", the
+// latter sending to an OTLP/HTTP collector at Endpoint (host:port).
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT" env-default:"localhost:4318"`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_INSECURE"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+}
+
+// RateLimitConfig limits requests per user, client or address. Routes are
+// keyed by method and pattern ("POST /api/v1/notes"), gRPC methods by
+// their full name, and override the default; the legacy aliases of a
+// route and the GraphQL mutations doing the same work share its limit.
+// Backend "postgres" shares the limits between instances.
+type RateLimitConfig struct {
+	Backend string                 `yaml:"backend" env:"RATE_LIMIT_BACKEND" env-default:"memory"`
+	Default LimitConfig            `yaml:"default"`
+	Routes  map[string]LimitConfig `yaml:"routes"`
+}
+
+// LimitConfig allows Requests per Period on average and up to Burst at
+// once; Burst defaults to Requests. Zero requests means no limit.
+type LimitConfig struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"`
+}
+
+type AuthConfig struct {
+	Issuer          string         `yaml:"issuer" env-default:"notes-service"`
+	RefreshTokenTTL time.Duration  `yaml:"refresh_token_ttl" env-default:"720h"`
+	SigningKeyID    string         `yaml:"signing_key_id" env:"AUTH_SIGNING_KEY_ID"`
+	Keys            []KeyConfig    `yaml:"keys"`
+	Clients         []ClientConfig `yaml:"clients"`
+	Users           []UserConfig   `yaml:"users"`
+	Admin           AdminConfig    `yaml:"admin"`
+	Lockout         LockoutConfig  `yaml:"lockout"`
+	OIDC            OIDCConfig     `yaml:"oidc"`
+}
+
+// OIDCConfig enables login through an external OpenID Connect provider
+// when IssuerURL is set.
+type OIDCConfig struct {
+	IssuerURL     string   `yaml:"issuer_url" env:"AUTH_OIDC_ISSUER_URL"`
+	ClientID      string   `yaml:"client_id" env:"AUTH_OIDC_CLIENT_ID"`
+	ClientSecret  string   `yaml:"client_secret" env:"AUTH_OIDC_CLIENT_SECRET"`
+	RedirectURL   string   `yaml:"redirect_url" env:"AUTH_OIDC_REDIRECT_URL"`
+	Scopes        []string `yaml:"scopes"`
+	UsernameClaim string   `yaml:"username_claim" env-default:"email"`
+}
+
+// LockoutConfig limits failed password logins in a row per username and
+// per client address.
+type LockoutConfig struct {
+	MaxUserFailures int           `yaml:"max_user_failures" env-default:"10"`
+	MaxIPFailures   int           `yaml:"max_ip_failures" env-default:"50"`
+	Duration        time.Duration `yaml:"duration" env-default:"15m"`
+	Window          time.Duration `yaml:"window" env-default:"1h"`
+}
+
+// KeyConfig is a token signing key. Either the private key (inline PEM or
+// file) or, for a retired key that only verifies, the public key file is set.
+type KeyConfig struct {
+	ID             string `yaml:"kid"`
+	Algorithm      string `yaml:"alg"`
+	PrivateKey     string `yaml:"private_key"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// ClientConfig is a client fixed in config, next to the ones registered
+// through the admin API. Clients without a secret are public and must use
+// PKCE; without grant_types a client may use the authorization code flow.
+type ClientConfig struct {
+	ID           string   `yaml:"id"`
+	Name         string   `yaml:"name"`
+	Secret       string   `yaml:"secret"`
+	GrantTypes   []string `yaml:"grant_types"`
+	RedirectURIs []string `yaml:"redirect_uris"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// UserConfig is a local user created on startup when it does not exist
+// yet; later changes made through the admin API are kept. Without a role
+// the user gets the user role.
+type UserConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Role     string `yaml:"role"`
+}
+
+// AdminConfig is the administrator created on the first start. Its
+// password, or a bcrypt hash of it, must come from the environment; the
+// service does not start without one or with a default password.
+type AdminConfig struct {
+	Username     string `yaml:"username" env:"AUTH_ADMIN_USERNAME" env-default:"admin"`
+	Password     string `env:"AUTH_ADMIN_PASSWORD"`
+	PasswordHash string `env:"AUTH_ADMIN_PASSWORD_HASH"`
 }
 
 func MustLoad() *Config {
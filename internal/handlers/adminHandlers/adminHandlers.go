@@ -0,0 +1,131 @@
+package adminHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
+	"net/http"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/lib/render"
+	"testovoe/internal/models"
+	"testovoe/internal/services/clientsService"
+	"testovoe/internal/services/lockoutService"
+	"testovoe/internal/services/usersService"
+)
+
+type ClientsService interface {
+	CreateClient(ctx context.Context, client models.Client, public bool) (models.Client, string, error)
+	ListClients(ctx context.Context) ([]models.Client, error)
+	RotateSecret(ctx context.Context, clientID string) (string, error)
+	DisableClient(ctx context.Context, clientID string) error
+}
+
+type LockoutService interface {
+	Unlock(ctx context.Context, username, ip, actor string) error
+	ListEvents(ctx context.Context, limit int) ([]models.LockoutEvent, error)
+}
+
+type UsersService interface {
+	ListUsers(ctx context.Context) ([]models.User, error)
+	UserDetails(ctx context.Context, username string) (models.User, error)
+	SetDisabled(ctx context.Context, actor, username string, disabled bool) error
+	ResetPassword(ctx context.Context, actor, username, password string) error
+	SetRole(ctx context.Context, actor, username, role string) error
+	Impersonate(ctx context.Context, actor, username, reason string) (string, error)
+	ListAudit(ctx context.Context, limit int) ([]models.AuditEvent, error)
+}
+
+type TokenIssuer interface {
+	Impersonate(actor, subject, scope string) (*oauth.TokenResponse, error)
+}
+
+type AdminHandlers struct {
+	clients  ClientsService
+	lockouts LockoutService
+	users    UsersService
+	tokens   TokenIssuer
+}
+
+func NewAdminHandlers(clients *clientsService.ClientsService, lockouts *lockoutService.LockoutService, users *usersService.UsersService, tokens *oa.Server) *AdminHandlers {
+	return &AdminHandlers{
+		clients:  clients,
+		lockouts: lockouts,
+		users:    users,
+		tokens:   tokens,
+	}
+}
+
+type createClientRequest struct {
+	Name         string   `json:"name"`
+	Public       bool     `json:"public"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// clientResponse carries the plaintext secret, which is only ever
+// returned on creation and rotation.
+type clientResponse struct {
+	models.Client
+	Secret string `json:"client_secret,omitempty"`
+}
+
+func (h *AdminHandlers) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var req createClientRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	client, secret, err := h.clients.CreateClient(r.Context(), models.Client{
+		Name:         req.Name,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		RedirectURIs: req.RedirectURIs,
+	}, req.Public)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, clientResponse{Client: client, Secret: secret})
+}
+
+func (h *AdminHandlers) ListClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.clients.ListClients(r.Context())
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, clients)
+}
+
+func (h *AdminHandlers) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "id")
+
+	secret, err := h.clients.RotateSecret(r.Context(), clientID)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, map[string]string{
+		"client_id":     clientID,
+		"client_secret": secret,
+	})
+}
+
+func (h *AdminHandlers) DisableClient(w http.ResponseWriter, r *http.Request) {
+	err := h.clients.DisableClient(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
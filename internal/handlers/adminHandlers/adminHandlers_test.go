@@ -0,0 +1,155 @@
+package adminHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testovoe/internal/models"
+	"testovoe/internal/services/clientsService"
+)
+
+// MockClientsService - мок для ClientsService
+type MockClientsService struct {
+	createFunc  func(ctx context.Context, client models.Client, public bool) (models.Client, string, error)
+	listFunc    func(ctx context.Context) ([]models.Client, error)
+	rotateFunc  func(ctx context.Context, clientID string) (string, error)
+	disableFunc func(ctx context.Context, clientID string) error
+}
+
+func (m *MockClientsService) CreateClient(ctx context.Context, client models.Client, public bool) (models.Client, string, error) {
+	return m.createFunc(ctx, client, public)
+}
+
+func (m *MockClientsService) ListClients(ctx context.Context) ([]models.Client, error) {
+	return m.listFunc(ctx)
+}
+
+func (m *MockClientsService) RotateSecret(ctx context.Context, clientID string) (string, error) {
+	return m.rotateFunc(ctx, clientID)
+}
+
+func (m *MockClientsService) DisableClient(ctx context.Context, clientID string) error {
+	return m.disableFunc(ctx, clientID)
+}
+
+func withURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestAdminHandlers_CreateClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		requestBody  string
+		createErr    error
+		expectedCode int
+		wantSecret   bool
+	}{
+		{
+			name:         "confidential client",
+			requestBody:  `{"name":"ci","grant_types":["client_credentials"],"scopes":["notes:read"]}`,
+			expectedCode: http.StatusCreated,
+			wantSecret:   true,
+		},
+		{
+			name:         "invalid client",
+			requestBody:  `{"name":""}`,
+			createErr:    fmt.Errorf("name is required: %w", clientsService.ErrInvalidClient),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid JSON",
+			requestBody:  `{"name":`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "storage error",
+			requestBody:  `{"name":"ci"}`,
+			createErr:    fmt.Errorf("connection refused"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &AdminHandlers{clients: &MockClientsService{
+				createFunc: func(ctx context.Context, client models.Client, public bool) (models.Client, string, error) {
+					if tt.createErr != nil {
+						return models.Client{}, "", tt.createErr
+					}
+					client.ID = "c1"
+					return client, "secret", nil
+				},
+			}}
+
+			req := httptest.NewRequest("POST", "/admin/clients", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			h.CreateClient(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("status = %v, want %v, body = %s", w.Code, tt.expectedCode, w.Body.String())
+			}
+
+			if tt.wantSecret {
+				var resp map[string]any
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp["client_id"] != "c1" || resp["client_secret"] != "secret" {
+					t.Errorf("response = %v", resp)
+				}
+				if _, ok := resp["SecretHash"]; ok {
+					t.Errorf("secret hash leaked in response")
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandlers_RotateAndDisable(t *testing.T) {
+	h := &AdminHandlers{clients: &MockClientsService{
+		rotateFunc: func(ctx context.Context, clientID string) (string, error) {
+			if clientID != "c1" {
+				return "", clientsService.ErrClientNotFound
+			}
+			return "new-secret", nil
+		},
+		disableFunc: func(ctx context.Context, clientID string) error {
+			if clientID != "c1" {
+				return clientsService.ErrClientNotFound
+			}
+			return nil
+		},
+	}}
+
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		clientID     string
+		expectedCode int
+	}{
+		{name: "rotate", handler: h.RotateClientSecret, clientID: "c1", expectedCode: http.StatusOK},
+		{name: "rotate unknown", handler: h.RotateClientSecret, clientID: "c2", expectedCode: http.StatusNotFound},
+		{name: "disable", handler: h.DisableClient, clientID: "c1", expectedCode: http.StatusNoContent},
+		{name: "disable unknown", handler: h.DisableClient, clientID: "c2", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withURLParam(httptest.NewRequest("POST", "/", nil), "id", tt.clientID)
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("status = %v, want %v", w.Code, tt.expectedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package adminHandlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testovoe/internal/lib/apperr"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/lib/render"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+var errInvalidLimit = apperr.Validation("invalid_limit", "limit must be between 1 and 1000")
+
+type unlockRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+func (h *AdminHandlers) Unlock(w http.ResponseWriter, r *http.Request) {
+	var req unlockRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	actor, _ := oa.Credential(r.Context())
+
+	err = h.lockouts.Unlock(r.Context(), req.Username, req.IP, actor)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandlers) ListLockoutEvents(w http.ResponseWriter, r *http.Request) {
+	limit := defaultEventsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEventsLimit {
+			problem.Error(w, r, errInvalidLimit)
+			return
+		}
+		limit = n
+	}
+
+	events, err := h.lockouts.ListEvents(r.Context(), limit)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,153 @@
+package adminHandlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/lib/render"
+)
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+type impersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *AdminHandlers) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.users.ListUsers(r.Context())
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, users)
+}
+
+func (h *AdminHandlers) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.users.UserDetails(r.Context(), chi.URLParam(r, "username"))
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, user)
+}
+
+func (h *AdminHandlers) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+func (h *AdminHandlers) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *AdminHandlers) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	actor, _ := oa.Credential(r.Context())
+
+	err := h.users.SetDisabled(r.Context(), actor, chi.URLParam(r, "username"), disabled)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req passwordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	actor, _ := oa.Credential(r.Context())
+
+	err = h.users.ResetPassword(r.Context(), actor, chi.URLParam(r, "username"), req.Password)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandlers) SetRole(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	actor, _ := oa.Credential(r.Context())
+
+	err = h.users.SetRole(r.Context(), actor, chi.URLParam(r, "username"), req.Role)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Impersonate issues a short-lived token that acts as the user, for
+// support. The reason is kept in the audit trail.
+func (h *AdminHandlers) Impersonate(w http.ResponseWriter, r *http.Request) {
+	var req impersonateRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	actor, _ := oa.Credential(r.Context())
+	username := chi.URLParam(r, "username")
+
+	scope, err := h.users.Impersonate(r.Context(), actor, username, req.Reason)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	token, err := h.tokens.Impersonate(actor, username, scope)
+	if err != nil {
+		problem.Error(w, r, fmt.Errorf("issue impersonation token: %w", err))
+		return
+	}
+
+	render.JSON(w, http.StatusOK, token)
+}
+
+func (h *AdminHandlers) ListAudit(w http.ResponseWriter, r *http.Request) {
+	limit := defaultEventsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEventsLimit {
+			problem.Error(w, r, errInvalidLimit)
+			return
+		}
+		limit = n
+	}
+
+	events, err := h.users.ListAudit(r.Context(), limit)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,164 @@
+package adminHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/oauth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testovoe/internal/models"
+	"testovoe/internal/services/usersService"
+)
+
+// MockUsersService - мок для UsersService
+type MockUsersService struct {
+	setDisabledFunc func(ctx context.Context, actor, username string, disabled bool) error
+	passwordFunc    func(ctx context.Context, actor, username, password string) error
+	impersonateFunc func(ctx context.Context, actor, username, reason string) (string, error)
+}
+
+func (m *MockUsersService) ListUsers(ctx context.Context) ([]models.User, error) {
+	return []models.User{{Username: "user1", Role: "user", NoteCount: 3}}, nil
+}
+
+func (m *MockUsersService) UserDetails(ctx context.Context, username string) (models.User, error) {
+	return models.User{}, usersService.ErrUserNotFound
+}
+
+func (m *MockUsersService) SetDisabled(ctx context.Context, actor, username string, disabled bool) error {
+	return m.setDisabledFunc(ctx, actor, username, disabled)
+}
+
+func (m *MockUsersService) ResetPassword(ctx context.Context, actor, username, password string) error {
+	return m.passwordFunc(ctx, actor, username, password)
+}
+
+func (m *MockUsersService) SetRole(ctx context.Context, actor, username, role string) error {
+	return nil
+}
+
+func (m *MockUsersService) Impersonate(ctx context.Context, actor, username, reason string) (string, error) {
+	return m.impersonateFunc(ctx, actor, username, reason)
+}
+
+func (m *MockUsersService) ListAudit(ctx context.Context, limit int) ([]models.AuditEvent, error) {
+	return nil, nil
+}
+
+type mockTokens struct{}
+
+func (mockTokens) Impersonate(actor, subject, scope string) (*oauth.TokenResponse, error) {
+	return &oauth.TokenResponse{Token: actor + ":" + subject + ":" + scope, TokenType: oauth.BearerToken}, nil
+}
+
+func adminRequest(method, target, body, username string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = withURLParam(req, "username", username)
+
+	return req.WithContext(context.WithValue(req.Context(), oauth.CredentialContext, "admin"))
+}
+
+func TestAdminHandlers_DisableUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		username     string
+		serviceErr   error
+		expectedCode int
+	}{
+		{name: "disabled", username: "user1", expectedCode: http.StatusNoContent},
+		{name: "not found", username: "nobody", serviceErr: usersService.ErrUserNotFound, expectedCode: http.StatusNotFound},
+		{name: "self", username: "admin", serviceErr: usersService.ErrSelfAction, expectedCode: http.StatusConflict},
+		{name: "storage error", username: "user1", serviceErr: fmt.Errorf("connection refused"), expectedCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotActor string
+			h := &AdminHandlers{users: &MockUsersService{
+				setDisabledFunc: func(ctx context.Context, actor, username string, disabled bool) error {
+					gotActor = actor
+					return tt.serviceErr
+				},
+			}}
+
+			w := httptest.NewRecorder()
+			h.DisableUser(w, adminRequest("POST", "/admin/users/"+tt.username+"/disable", "", tt.username))
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("status = %v, want %v", w.Code, tt.expectedCode)
+			}
+			if gotActor != "admin" {
+				t.Errorf("actor = %q, want admin", gotActor)
+			}
+		})
+	}
+}
+
+func TestAdminHandlers_ResetPassword(t *testing.T) {
+	h := &AdminHandlers{users: &MockUsersService{
+		passwordFunc: func(ctx context.Context, actor, username, password string) error {
+			if len(password) < 8 {
+				return usersService.ErrWeakPassword
+			}
+			return nil
+		},
+	}}
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "reset", body: `{"password":"correct horse"}`, expectedCode: http.StatusNoContent},
+		{name: "too short", body: `{"password":"short"}`, expectedCode: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{"password":`, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ResetPassword(w, adminRequest("POST", "/admin/users/user1/password", tt.body, "user1"))
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("status = %v, want %v", w.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestAdminHandlers_Impersonate(t *testing.T) {
+	h := &AdminHandlers{
+		users: &MockUsersService{
+			impersonateFunc: func(ctx context.Context, actor, username, reason string) (string, error) {
+				if username == "admin2" {
+					return "", usersService.ErrCannotImpersonate
+				}
+				return "notes:read notes:write", nil
+			},
+		},
+		tokens: mockTokens{},
+	}
+
+	w := httptest.NewRecorder()
+	h.Impersonate(w, adminRequest("POST", "/admin/users/user1/impersonate", `{"reason":"ticket 42"}`, "user1"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp oauth.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Token != "admin:user1:notes:read notes:write" {
+		t.Errorf("token = %q", resp.Token)
+	}
+
+	w = httptest.NewRecorder()
+	h.Impersonate(w, adminRequest("POST", "/admin/users/admin2/impersonate", `{"reason":"ticket 42"}`, "admin2"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("admin target status = %v, want %v", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,100 @@
+package apiKeysHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/lib/render"
+	"testovoe/internal/models"
+	"testovoe/internal/services/apiKeysService"
+	"time"
+)
+
+type APIKeysService interface {
+	CreateKey(ctx context.Context, owner, name string, scopes []string, granted string, ttl time.Duration) (models.APIKey, string, error)
+	ListKeys(ctx context.Context, owner string) ([]models.APIKey, error)
+	DeleteKey(ctx context.Context, keyId, owner string) error
+}
+
+type APIKeysHandlers struct {
+	service APIKeysService
+}
+
+func NewAPIKeysHandlers(service *apiKeysService.APIKeysService) *APIKeysHandlers {
+	return &APIKeysHandlers{
+		service: service,
+	}
+}
+
+type createKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// createKeyResponse is the only response that carries the plaintext key.
+type createKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+func (h *APIKeysHandlers) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req createKeyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	owner, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+
+	key, plaintext, err := h.service.CreateKey(r.Context(), owner, req.Name, req.Scopes, oa.Scope(r.Context()), ttl)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, createKeyResponse{APIKey: key, Key: plaintext})
+}
+
+func (h *APIKeysHandlers) ListKeys(w http.ResponseWriter, r *http.Request) {
+	owner, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return
+	}
+
+	keys, err := h.service.ListKeys(r.Context(), owner)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, keys)
+}
+
+func (h *APIKeysHandlers) DeleteKey(w http.ResponseWriter, r *http.Request) {
+	owner, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return
+	}
+
+	err := h.service.DeleteKey(r.Context(), chi.URLParam(r, "id"), owner)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package apiKeysHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/oauth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testovoe/internal/models"
+	"testovoe/internal/services/apiKeysService"
+	"time"
+)
+
+// MockAPIKeysService - мок для APIKeysService
+type MockAPIKeysService struct {
+	createFunc func(ctx context.Context, owner, name string, scopes []string, granted string, ttl time.Duration) (models.APIKey, string, error)
+	listFunc   func(ctx context.Context, owner string) ([]models.APIKey, error)
+	deleteFunc func(ctx context.Context, keyId, owner string) error
+}
+
+func (m *MockAPIKeysService) CreateKey(ctx context.Context, owner, name string, scopes []string, granted string, ttl time.Duration) (models.APIKey, string, error) {
+	return m.createFunc(ctx, owner, name, scopes, granted, ttl)
+}
+
+func (m *MockAPIKeysService) ListKeys(ctx context.Context, owner string) ([]models.APIKey, error) {
+	return m.listFunc(ctx, owner)
+}
+
+func (m *MockAPIKeysService) DeleteKey(ctx context.Context, keyId, owner string) error {
+	return m.deleteFunc(ctx, keyId, owner)
+}
+
+// withCredential имитирует запрос, прошедший через Authorize
+func withCredential(r *http.Request, owner, scope string) *http.Request {
+	ctx := context.WithValue(r.Context(), oauth.CredentialContext, owner)
+	ctx = context.WithValue(ctx, oauth.ScopeContext, scope)
+
+	return r.WithContext(ctx)
+}
+
+func TestAPIKeysHandlers_CreateKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestBody   string
+		authenticated bool
+		createErr     error
+		expectedCode  int
+	}{
+		{
+			name:          "created",
+			requestBody:   `{"name":"ci","scopes":["notes:read"],"expires_in_days":30}`,
+			authenticated: true,
+			expectedCode:  http.StatusCreated,
+		},
+		{
+			name:          "scope not granted",
+			requestBody:   `{"name":"ci","scopes":["admin"]}`,
+			authenticated: true,
+			createErr:     fmt.Errorf("scope %q is not granted: %w", "admin", apiKeysService.ErrInvalidAPIKey),
+			expectedCode:  http.StatusBadRequest,
+		},
+		{
+			name:         "unauthenticated",
+			requestBody:  `{"name":"ci"}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &APIKeysHandlers{service: &MockAPIKeysService{
+				createFunc: func(ctx context.Context, owner, name string, scopes []string, granted string, ttl time.Duration) (models.APIKey, string, error) {
+					if tt.createErr != nil {
+						return models.APIKey{}, "", tt.createErr
+					}
+					if owner != "user1" || granted != "notes:read notes:write" || ttl != 30*24*time.Hour {
+						t.Errorf("CreateKey(%q, granted %q, ttl %v)", owner, granted, ttl)
+					}
+					return models.APIKey{ID: "k1", Owner: owner, Name: name, Scopes: scopes}, "nsk_secret", nil
+				},
+			}}
+
+			req := httptest.NewRequest("POST", "/api-keys", strings.NewReader(tt.requestBody))
+			if tt.authenticated {
+				req = withCredential(req, "user1", "notes:read notes:write")
+			}
+			w := httptest.NewRecorder()
+			h.CreateKey(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("status = %v, want %v, body = %s", w.Code, tt.expectedCode, w.Body.String())
+			}
+
+			if tt.expectedCode == http.StatusCreated {
+				var resp map[string]any
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp["key"] != "nsk_secret" || resp["id"] != "k1" {
+					t.Errorf("response = %v", resp)
+				}
+				if _, ok := resp["owner"]; ok {
+					t.Errorf("owner should not be serialized")
+				}
+			}
+		})
+	}
+}
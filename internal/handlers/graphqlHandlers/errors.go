@@ -0,0 +1,101 @@
+package graphqlHandlers
+
+import (
+	"context"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"log/slog"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/lib/problem"
+)
+
+const (
+	codeQueryTooDeep      = "query_too_deep"
+	codeQueryTooComplex   = "query_too_complex"
+	codeOperationUnknown  = "unknown_operation"
+	codeRateLimited       = "rate_limited"
+	codeTooManyOperations = "too_many_operations"
+)
+
+var (
+	errInvalidID         = newError("invalid_id", "id must be a UUID")
+	errInsufficientScope = newError("insufficient_scope", "insufficient scope")
+)
+
+// Error is a GraphQL error carrying the same stable code as the problem
+// details of the REST API in its extensions.
+type Error struct {
+	Message string
+	Code    string
+}
+
+func newError(code, message string) *Error {
+	return &Error{
+		Message: message,
+		Code:    code,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+// resolverError keeps the code and message of domain errors; anything else
+// is logged and reported as a bare internal error, like problem.Error.
+func resolverError(ctx context.Context, err error) error {
+	log := logger.FromContext(ctx, slog.Default())
+
+	e, ok := apperr.As(err)
+	if !ok || e.Kind == apperr.KindInternal {
+		log.ErrorContext(ctx, "resolver failed", slog.String("error", err.Error()))
+		return newError(problem.CodeInternal, "internal error")
+	}
+
+	if e.Kind == apperr.KindUnavailable {
+		log.WarnContext(ctx, "dependency unavailable", slog.String("error", err.Error()))
+	}
+
+	return newError(e.Code, e.Message)
+}
+
+// formatErrors formats errors raised outside of the executor.
+func formatErrors(errs ...error) []gqlerrors.FormattedError {
+	return withCodes(gqlerrors.FormatErrors(errs...))
+}
+
+// withCodes fills in the code extension of errors that lost it: graphql-go
+// only keeps the extensions of errors returned by a resolver itself, not
+// of the ones returned by a thunk or formatted outside of the executor.
+func withCodes(errs []gqlerrors.FormattedError) []gqlerrors.FormattedError {
+	for i := range errs {
+		if errs[i].Extensions != nil {
+			continue
+		}
+		if e, ok := findError(errs[i].OriginalError()); ok {
+			errs[i].Extensions = e.Extensions()
+		}
+	}
+
+	return errs
+}
+
+func findError(err error) (*Error, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			return e, true
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		default:
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,270 @@
+package graphqlHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"net/http"
+	"testovoe/internal/lib/markdown"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/lib/ratelimit"
+	"testovoe/internal/models"
+	"testovoe/internal/services/notesService"
+	"time"
+)
+
+// maxRequestSize bounds the body of a GraphQL request and the messages of
+// a WebSocket.
+const maxRequestSize = 1 << 20
+
+// The routes operations count against when rate-limited. Mutations share
+// the limits of the REST routes doing the same work, spellchecking
+// included; an operation sent over a WebSocket counts like a POST.
+const (
+	routeQuery      = "POST /graphql"
+	routeSubscribe  = "GET /graphql"
+	routeCreateNote = "POST /api/v1/notes"
+	routeUpdateNote = "PUT /api/v1/notes/{id}"
+	routeDeleteNote = "DELETE /api/v1/notes/{id}"
+)
+
+type NotesService interface {
+	AddNote(ctx context.Context, content, owner string) (string, error)
+	GetNotes(ctx context.Context, owner string) ([]models.Note, error)
+	GetNotesByIDs(ctx context.Context, noteIds []string, owner string) ([]models.Note, error)
+	UpdateNote(ctx context.Context, noteId, content, owner string) error
+	DeleteNote(ctx context.Context, noteId, owner string) error
+	SearchNotes(ctx context.Context, owner, query string, limit int) ([]models.Note, error)
+	GetChanges(ctx context.Context, owner, token string, limit int) (models.ChangeSet, error)
+	CurrentSyncToken(ctx context.Context, owner string) (string, error)
+	ShareNote(ctx context.Context, noteId, username, owner string) error
+	UnshareNote(ctx context.Context, noteId, username, owner string) error
+	GetNoteShares(ctx context.Context, noteIds []string, owner string) ([]models.NoteShare, error)
+	GetSharedNotes(ctx context.Context, username string, limit int) ([]models.Note, error)
+	ListTags(ctx context.Context, owner string, limit int) ([]models.Tag, error)
+	ListNotebooks(ctx context.Context, owner string, limit int) ([]models.Notebook, error)
+}
+
+type Renderer interface {
+	Render(source string) (string, error)
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (context.Context, error)
+}
+
+type AccessChecker interface {
+	CheckActive(ctx context.Context) error
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, route, caller string) (ratelimit.Limit, ratelimit.Result, error)
+}
+
+// Config sets the limits of the operations and how often subscriptions
+// poll the change feed.
+type Config struct {
+	Limits       Limits
+	PollInterval time.Duration
+}
+
+type GraphQLHandlers struct {
+	service       NotesService
+	renderer      Renderer
+	authenticator Authenticator
+	access        AccessChecker
+	limiter       RateLimiter
+	schema        graphql.Schema
+	limits        Limits
+	pollInterval  time.Duration
+}
+
+func NewGraphQLHandlers(service *notesService.NotesService, renderer *markdown.Renderer, authServer *oa.Server, access *oa.AccessControl, limiter *ratelimit.Limiter, cfg Config) (*GraphQLHandlers, error) {
+	return newGraphQLHandlers(service, renderer, authServer, access, limiter, cfg)
+}
+
+func newGraphQLHandlers(service NotesService, renderer Renderer, authenticator Authenticator, access AccessChecker, limiter RateLimiter, cfg Config) (*GraphQLHandlers, error) {
+	const op = "graphqlHandlers.NewGraphQLHandlers"
+
+	h := &GraphQLHandlers{
+		service:       service,
+		renderer:      renderer,
+		authenticator: authenticator,
+		access:        access,
+		limiter:       limiter,
+		limits:        cfg.Limits,
+		pollInterval:  cfg.PollInterval,
+	}
+
+	schema, err := h.newSchema()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	h.schema = schema
+
+	return h, nil
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// operation is a parsed request that passed validation and the limits.
+type operation struct {
+	doc  *ast.Document
+	def  *ast.OperationDefinition
+	name string
+	vars map[string]interface{}
+}
+
+// Query runs queries and mutations sent with POST. It sits behind
+// Authorize, RequireActive, the notes:read scope and the rate limiter;
+// mutations also need notes:write and each counts against the limit of
+// its REST route.
+func (h *GraphQLHandlers) Query(w http.ResponseWriter, r *http.Request) {
+	var req request
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	owner, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return
+	}
+
+	op, errs := h.prepare(req)
+	if errs != nil {
+		writeResult(w, &graphql.Result{Errors: errs})
+		return
+	}
+
+	if op.def.Operation == ast.OperationTypeSubscription {
+		writeResult(w, &graphql.Result{Errors: formatErrors(newError(codeOperationUnknown, "subscriptions are served over WebSocket"))})
+		return
+	}
+
+	if !allowed(r.Context(), op) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, oa.ScopeNotesWrite))
+		problem.Write(w, r, http.StatusForbidden, errInsufficientScope.Code, errInsufficientScope.Message)
+		return
+	}
+
+	ctx := withLoaders(r.Context(), newLoaders(h.service, owner))
+
+	writeResult(w, graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           op.doc,
+		OperationName: op.name,
+		Args:          op.vars,
+		Context:       ctx,
+	}))
+}
+
+// prepare parses and validates the request and checks it against the
+// limits before anything is resolved.
+func (h *GraphQLHandlers) prepare(req request) (*operation, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return nil, formatErrors(err)
+	}
+
+	validation := graphql.ValidateDocument(&h.schema, doc, nil)
+	if !validation.IsValid {
+		return nil, validation.Errors
+	}
+
+	def, err := findOperation(doc, req.OperationName)
+	if err != nil {
+		return nil, formatErrors(err)
+	}
+
+	if err := checkLimits(&h.schema, doc, def, req.Variables, h.limits); err != nil {
+		return nil, formatErrors(err)
+	}
+
+	return &operation{
+		doc:  doc,
+		def:  def,
+		name: req.OperationName,
+		vars: req.Variables,
+	}, nil
+}
+
+func findOperation(doc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	var found *ast.OperationDefinition
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if name == "" {
+			if found != nil {
+				return nil, newError(codeOperationUnknown, "operationName is required for documents with several operations")
+			}
+			found = op
+			continue
+		}
+
+		if op.Name != nil && op.Name.Value == name {
+			return op, nil
+		}
+	}
+
+	if found == nil {
+		return nil, newError(codeOperationUnknown, fmt.Sprintf("unknown operation %q", name))
+	}
+
+	return found, nil
+}
+
+// allowed reports whether the token may run the operation: reading needs
+// notes:read and mutations notes:write.
+func allowed(ctx context.Context, op *operation) bool {
+	scope := oa.ScopeNotesRead
+	if op.def.Operation == ast.OperationTypeMutation {
+		scope = oa.ScopeNotesWrite
+	}
+
+	return oa.HasScope(oa.Scope(ctx), scope)
+}
+
+// allow takes a token from the caller's bucket of route. When the store
+// fails the operation is let through, as with the HTTP middleware.
+func (h *GraphQLHandlers) allow(ctx context.Context, route string) error {
+	caller, _ := ratelimit.Caller(ctx)
+
+	_, res, err := h.limiter.Allow(ctx, route, caller)
+	if err != nil || res.Allowed {
+		return nil
+	}
+
+	return newError(codeRateLimited, fmt.Sprintf("too many requests, retry in %s", res.RetryAfter))
+}
+
+func writeResult(w http.ResponseWriter, result *graphql.Result) {
+	result.Errors = withCodes(result.Errors)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		return
+	}
+}
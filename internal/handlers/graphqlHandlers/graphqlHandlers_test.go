@@ -0,0 +1,866 @@
+package graphqlHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/oauth"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testovoe/internal/lib/apperr"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/ratelimit"
+	"testovoe/internal/models"
+	"testovoe/internal/services/notesService"
+	"time"
+)
+
+const (
+	noteA = "123e4567-e89b-12d3-a456-426614174000"
+	noteB = "123e4567-e89b-12d3-a456-426614174001"
+)
+
+// fakeNotes хранит заметки в памяти и считает запросы GetNotesByIDs и
+// GetNoteShares
+type fakeNotes struct {
+	mu           sync.Mutex
+	notes        map[string]models.Note
+	shares       map[string][]string
+	batches      [][]string
+	shareBatches [][]string
+	changes      []models.NoteChange
+	polls        int
+}
+
+func newFakeNotes() *fakeNotes {
+	return &fakeNotes{
+		notes: map[string]models.Note{
+			noteA: {ID: noteA, Content: "first", Owner: "alice", Tags: []string{"go"}, Notebook: "Work/Projects"},
+			noteB: {ID: noteB, Content: "second", Owner: "alice"},
+		},
+		shares: map[string][]string{
+			noteA: {"bob", "carol"},
+		},
+	}
+}
+
+func (f *fakeNotes) AddNote(ctx context.Context, content, owner string) (string, error) {
+	return noteA, nil
+}
+
+func (f *fakeNotes) GetNotes(ctx context.Context, owner string) ([]models.Note, error) {
+	return []models.Note{f.notes[noteA], f.notes[noteB]}, nil
+}
+
+func (f *fakeNotes) GetNotesByIDs(ctx context.Context, noteIds []string, owner string) ([]models.Note, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.batches = append(f.batches, noteIds)
+
+	var notes []models.Note
+	for _, id := range noteIds {
+		if note, ok := f.notes[id]; ok {
+			notes = append(notes, note)
+		}
+	}
+
+	return notes, nil
+}
+
+func (f *fakeNotes) UpdateNote(ctx context.Context, noteId, content, owner string) error {
+	return nil
+}
+
+func (f *fakeNotes) DeleteNote(ctx context.Context, noteId, owner string) error {
+	return nil
+}
+
+func (f *fakeNotes) SearchNotes(ctx context.Context, owner, query string, limit int) ([]models.Note, error) {
+	return nil, notesService.ErrEmptyQuery
+}
+
+// GetChanges отдаёт накопленные изменения один раз, дальше пусто
+func (f *fakeNotes) GetChanges(ctx context.Context, owner, token string, limit int) (models.ChangeSet, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if token == "bad" {
+		return models.ChangeSet{}, notesService.ErrInvalidSyncToken
+	}
+
+	f.polls++
+	changes := f.changes
+	f.changes = nil
+
+	return models.ChangeSet{Changes: changes, NextToken: "next"}, nil
+}
+
+func (f *fakeNotes) CurrentSyncToken(ctx context.Context, owner string) (string, error) {
+	return "now", nil
+}
+
+func (f *fakeNotes) ShareNote(ctx context.Context, noteId, username, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.notes[noteId]; !ok {
+		return notesService.ErrNoteNotFound
+	}
+	if username == owner {
+		return notesService.ErrShareWithOwner
+	}
+	f.shares[noteId] = append(f.shares[noteId], username)
+
+	return nil
+}
+
+func (f *fakeNotes) UnshareNote(ctx context.Context, noteId, username, owner string) error {
+	return nil
+}
+
+func (f *fakeNotes) GetNoteShares(ctx context.Context, noteIds []string, owner string) ([]models.NoteShare, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.shareBatches = append(f.shareBatches, noteIds)
+
+	var shares []models.NoteShare
+	for _, id := range noteIds {
+		for _, username := range f.shares[id] {
+			shares = append(shares, models.NoteShare{NoteID: id, Username: username, CreatedAt: time.Now()})
+		}
+	}
+
+	return shares, nil
+}
+
+func (f *fakeNotes) GetSharedNotes(ctx context.Context, username string, limit int) ([]models.Note, error) {
+	return []models.Note{{ID: noteB, Content: "shared", Owner: "dave"}}, nil
+}
+
+func (f *fakeNotes) ListTags(ctx context.Context, owner string, limit int) ([]models.Tag, error) {
+	return []models.Tag{{Name: "go", Notes: 1}}, nil
+}
+
+func (f *fakeNotes) ListNotebooks(ctx context.Context, owner string, limit int) ([]models.Notebook, error) {
+	return []models.Notebook{{Path: "Work/Projects", Notes: 1}}, nil
+}
+
+type fakeRenderer struct{}
+
+func (f fakeRenderer) Render(source string) (string, error) {
+	return "<p>" + source + "</p>", nil
+}
+
+// fakeAuthenticator знает только токены из tokens (токен -> scope)
+type fakeAuthenticator struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (f *fakeAuthenticator) Authenticate(ctx context.Context, token string) (context.Context, error) {
+	f.mu.Lock()
+	scope, ok := f.tokens[token]
+	f.mu.Unlock()
+	if !ok {
+		return ctx, apperr.Unauthorized("invalid_token", "invalid token")
+	}
+
+	ctx = context.WithValue(ctx, oauth.CredentialContext, "alice")
+	ctx = context.WithValue(ctx, oauth.ScopeContext, scope)
+
+	return ctx, nil
+}
+
+func (f *fakeAuthenticator) revoke(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.tokens, token)
+}
+
+type fakeAccess struct {
+	disabled atomic.Bool
+}
+
+func (f *fakeAccess) CheckActive(ctx context.Context) error {
+	if f.disabled.Load() {
+		return apperr.Forbidden("account_disabled", "account is disabled")
+	}
+
+	return nil
+}
+
+// fakeLimiter пропускает на маршрут из routes столько операций, сколько
+// указано, остальные маршруты не ограничены
+type fakeLimiter struct {
+	mu     sync.Mutex
+	routes map[string]int
+	taken  []string
+}
+
+func (f *fakeLimiter) Allow(ctx context.Context, route, caller string) (ratelimit.Limit, ratelimit.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.taken = append(f.taken, route+" "+caller)
+
+	left, ok := f.routes[route]
+	if !ok {
+		return ratelimit.Limit{}, ratelimit.Result{Allowed: true}, nil
+	}
+
+	limit := ratelimit.Limit{Rate: 1, Burst: 1}
+	if left == 0 {
+		return limit, ratelimit.Result{RetryAfter: time.Second}, nil
+	}
+	f.routes[route] = left - 1
+
+	return limit, ratelimit.Result{Allowed: true}, nil
+}
+
+func newTestHandlers(t *testing.T, service NotesService, limits Limits) *GraphQLHandlers {
+	t.Helper()
+
+	h, err := newGraphQLHandlers(service, fakeRenderer{}, &fakeAuthenticator{tokens: map[string]string{
+		"reader": oa.ScopeNotesRead,
+	}}, &fakeAccess{}, &fakeLimiter{}, Config{Limits: limits, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("newGraphQLHandlers() error = %v", err)
+	}
+
+	return h
+}
+
+type result struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func TestGraphQLHandlers_Query(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		scope        string
+		limits       Limits
+		expectedCode int
+		expectedErr  string
+		check        func(t *testing.T, res result, service *fakeNotes)
+	}{
+		{
+			name:         "Notes by ID are loaded in one batch",
+			query:        `{ a: note(id: "` + noteA + `") { content } b: note(id: "` + noteB + `") { content html } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, res result, service *fakeNotes) {
+				if len(service.batches) != 1 || len(service.batches[0]) != 2 {
+					t.Errorf("batches = %v, want one batch of 2 IDs", service.batches)
+				}
+				b, _ := res.Data["b"].(map[string]interface{})
+				if b["html"] != "<p>second</p>" {
+					t.Errorf("b = %v, want rendered html", b)
+				}
+			},
+		},
+		{
+			name:         "Html of a list of notes needs no more queries",
+			query:        `{ notes(ids: ["` + noteA + `", "` + noteB + `"]) { html } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, res result, service *fakeNotes) {
+				if len(service.batches) != 1 {
+					t.Errorf("batches = %v, want one", service.batches)
+				}
+				notes, _ := res.Data["notes"].([]interface{})
+				if len(notes) != 2 {
+					t.Fatalf("notes = %v, want 2", notes)
+				}
+				if a, _ := notes[0].(map[string]interface{}); a["html"] != "<p>first</p>" {
+					t.Errorf("notes[0] = %v, want rendered html", a)
+				}
+			},
+		},
+		{
+			name: "Tags, notebooks and shares in one round trip",
+			query: `{
+				notes(ids: ["` + noteA + `", "` + noteB + `"]) { tags notebook sharedWith { username } }
+				tags { name notes }
+				notebooks { path notes }
+				sharedNotes { owner content sharedWith { username } }
+			}`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, res result, service *fakeNotes) {
+				if len(service.shareBatches) != 1 || len(service.shareBatches[0]) != 3 {
+					t.Errorf("share batches = %v, want one batch of 3 IDs", service.shareBatches)
+				}
+				notes, _ := res.Data["notes"].([]interface{})
+				if len(notes) != 2 {
+					t.Fatalf("notes = %v, want 2", notes)
+				}
+				a, _ := notes[0].(map[string]interface{})
+				if a["notebook"] != "Work/Projects" || len(a["tags"].([]interface{})) != 1 || len(a["sharedWith"].([]interface{})) != 2 {
+					t.Errorf("notes[0] = %v, want its notebook, tag and 2 shares", a)
+				}
+				b, _ := notes[1].(map[string]interface{})
+				if b["notebook"] != nil || len(b["tags"].([]interface{})) != 0 || len(b["sharedWith"].([]interface{})) != 0 {
+					t.Errorf("notes[1] = %v, want no notebook, tags or shares", b)
+				}
+				if tags, _ := res.Data["tags"].([]interface{}); len(tags) != 1 {
+					t.Errorf("tags = %v, want 1", res.Data["tags"])
+				}
+				if notebooks, _ := res.Data["notebooks"].([]interface{}); len(notebooks) != 1 {
+					t.Errorf("notebooks = %v, want 1", res.Data["notebooks"])
+				}
+				if shared, _ := res.Data["sharedNotes"].([]interface{}); len(shared) != 1 {
+					t.Errorf("sharedNotes = %v, want 1", res.Data["sharedNotes"])
+				}
+			},
+		},
+		{
+			name:         "Shares up to the limit",
+			query:        `{ note(id: "` + noteA + `") { sharedWith(limit: 1) { username sharedAt } } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, res result, service *fakeNotes) {
+				note, _ := res.Data["note"].(map[string]interface{})
+				shares, _ := note["sharedWith"].([]interface{})
+				if len(shares) != 1 {
+					t.Fatalf("sharedWith = %v, want 1", shares)
+				}
+				if share, _ := shares[0].(map[string]interface{}); share["username"] != "bob" {
+					t.Errorf("sharedWith[0] = %v, want bob", share)
+				}
+			},
+		},
+		{
+			name:         "Missing note",
+			query:        `{ note(id: "123e4567-e89b-12d3-a456-426614174999") { id } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			expectedErr:  "note_not_found",
+		},
+		{
+			name:         "Invalid ID",
+			query:        `{ note(id: "1") { id } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			expectedErr:  "invalid_id",
+		},
+		{
+			name:         "Domain error keeps its code",
+			query:        `{ searchNotes(query: " ") { id } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			expectedErr:  "empty_query",
+		},
+		{
+			name:         "Too deep",
+			query:        `{ changes { changes { note { id } } } }`,
+			scope:        oa.ScopeNotesRead,
+			limits:       Limits{MaxDepth: 2},
+			expectedCode: http.StatusOK,
+			expectedErr:  codeQueryTooDeep,
+		},
+		{
+			name:         "Too complex",
+			query:        `{ searchNotes(query: "go", limit: 100) { id content html } }`,
+			scope:        oa.ScopeNotesRead,
+			limits:       Limits{MaxComplexity: 100},
+			expectedCode: http.StatusOK,
+			expectedErr:  codeQueryTooComplex,
+		},
+		{
+			name:         "Introspection counts towards depth",
+			query:        `{ __type(name: "Note") { fields { type { fields { type { fields { type { fields { name } } } } } } } } }`,
+			scope:        oa.ScopeNotesRead,
+			limits:       Limits{MaxDepth: 8},
+			expectedCode: http.StatusOK,
+			expectedErr:  codeQueryTooDeep,
+		},
+		{
+			name:         "Introspection counts towards complexity",
+			query:        `{ __schema { types { name fields { name } } } }`,
+			scope:        oa.ScopeNotesRead,
+			limits:       Limits{MaxComplexity: 1000},
+			expectedCode: http.StatusOK,
+			expectedErr:  codeQueryTooComplex,
+		},
+		{
+			name:         "Shallow introspection",
+			query:        `{ __typename __type(name: "Note") { name } }`,
+			scope:        oa.ScopeNotesRead,
+			limits:       Limits{MaxDepth: 2, MaxComplexity: 10},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Mutation needs notes:write",
+			query:        `mutation { createNote(content: "hi") { id } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Mutation",
+			query:        `mutation { createNote(content: "hi") { id content owner } }`,
+			scope:        oa.ScopeNotesRead + " " + oa.ScopeNotesWrite,
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, res result, service *fakeNotes) {
+				note, _ := res.Data["createNote"].(map[string]interface{})
+				if note["id"] != noteA || note["owner"] != "alice" {
+					t.Errorf("createNote = %v", note)
+				}
+			},
+		},
+		{
+			name:         "Share a note",
+			query:        `mutation { shareNote(id: "` + noteB + `", username: "bob") { id sharedWith { username } } }`,
+			scope:        oa.ScopeNotesRead + " " + oa.ScopeNotesWrite,
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, res result, service *fakeNotes) {
+				note, _ := res.Data["shareNote"].(map[string]interface{})
+				if shares, _ := note["sharedWith"].([]interface{}); len(shares) != 1 {
+					t.Errorf("shareNote = %v, want the note shared with bob", note)
+				}
+			},
+		},
+		{
+			name:         "Share with the owner",
+			query:        `mutation { shareNote(id: "` + noteB + `", username: "alice") { id } }`,
+			scope:        oa.ScopeNotesRead + " " + oa.ScopeNotesWrite,
+			expectedCode: http.StatusOK,
+			expectedErr:  "share_with_owner",
+		},
+		{
+			name:         "Subscription over POST",
+			query:        `subscription { noteChanged { id } }`,
+			scope:        oa.ScopeNotesRead,
+			expectedCode: http.StatusOK,
+			expectedErr:  codeOperationUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newFakeNotes()
+			h := newTestHandlers(t, service, tt.limits)
+
+			body, _ := json.Marshal(request{Query: tt.query})
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			ctx := context.WithValue(req.Context(), oauth.CredentialContext, "alice")
+			ctx = context.WithValue(ctx, oauth.ScopeContext, tt.scope)
+			w := httptest.NewRecorder()
+
+			h.Query(w, req.WithContext(ctx))
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("status code = %v, want %v: %s", w.Code, tt.expectedCode, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var res result
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("Failed to unmarshal response body: %v", err)
+			}
+
+			if tt.expectedErr == "" && len(res.Errors) > 0 {
+				t.Errorf("errors = %+v, want none", res.Errors)
+			}
+			if tt.expectedErr != "" && (len(res.Errors) == 0 || res.Errors[0].Extensions["code"] != tt.expectedErr) {
+				t.Errorf("errors = %+v, want code %q", res.Errors, tt.expectedErr)
+			}
+			if tt.check != nil {
+				tt.check(t, res, service)
+			}
+		})
+	}
+}
+
+func TestGraphQLHandlers_MutationsRateLimited(t *testing.T) {
+	h := newTestHandlers(t, newFakeNotes(), Limits{})
+	limiter := &fakeLimiter{routes: map[string]int{routeCreateNote: 1}}
+	h.limiter = limiter
+
+	// псевдонимы позволяют уместить много мутаций в один запрос
+	query := `mutation {
+		c: deleteNote(id: "` + noteB + `")
+		a: createNote(content: "one") { id }
+		b: createNote(content: "two") { id }
+	}`
+	body, _ := json.Marshal(request{Query: query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	ctx := context.WithValue(req.Context(), oauth.CredentialContext, "alice")
+	ctx = context.WithValue(ctx, oauth.ScopeContext, oa.ScopeNotesRead+" "+oa.ScopeNotesWrite)
+	w := httptest.NewRecorder()
+
+	h.Query(w, req.WithContext(ctx))
+
+	var res result
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != codeRateLimited {
+		t.Fatalf("errors = %+v, want one %q", res.Errors, codeRateLimited)
+	}
+
+	want := []string{
+		routeDeleteNote + " user:alice",
+		routeCreateNote + " user:alice",
+		routeCreateNote + " user:alice",
+	}
+	if strings.Join(limiter.taken, ", ") != strings.Join(want, ", ") {
+		t.Errorf("taken = %v, want %v", limiter.taken, want)
+	}
+}
+
+func TestCheckLimits_Complexity(t *testing.T) {
+	h := newTestHandlers(t, newFakeNotes(), Limits{})
+
+	tests := []struct {
+		name  string
+		query string
+		vars  map[string]interface{}
+		want  int
+	}{
+		{
+			name:  "All notes are unbounded",
+			query: `{ notes { id content } }`,
+			want:  1 + 2*maxListSize,
+		},
+		{
+			name:  "Notes by ID",
+			query: `{ notes(ids: ["` + noteA + `", "` + noteB + `"]) { id content } }`,
+			want:  1 + 2*2,
+		},
+		{
+			name:  "Notes by ID from variables",
+			query: `query($ids: [ID!]) { notes(ids: $ids) { id } }`,
+			vars:  map[string]interface{}{"ids": []interface{}{noteA, noteB, noteA}},
+			want:  1 + 3,
+		},
+		{
+			name:  "No IDs",
+			query: `{ notes(ids: []) { id } note(id: "` + noteA + `") { id } }`,
+			want:  1 + 2,
+		},
+		{
+			name:  "Search by default",
+			query: `{ searchNotes(query: "go") { id } }`,
+			want:  1 + 20,
+		},
+		// limit стоит у changes, а список - поле внутри
+		{
+			name:  "Changes take the limit of the parent",
+			query: `{ changes(limit: 500) { token changes { id note { id } } } }`,
+			want:  1 + 1 + 1 + 500*(1+2),
+		},
+		{
+			name:  "Shares of a note by default",
+			query: `{ note(id: "` + noteA + `") { sharedWith { username } } }`,
+			want:  1 + 1 + notesService.MaxNoteShares,
+		},
+		{
+			name:  "Tags by default",
+			query: `{ tags { name notes } }`,
+			want:  1 + 2*notesService.DefaultListLimit,
+		},
+		{
+			name:  "Changes by default",
+			query: `{ changes { changes { id } } }`,
+			want:  1 + 1 + notesService.DefaultSyncLimit,
+		},
+		{
+			name:  "Limit from variables counts at most the largest page",
+			query: `query($limit: Int) { changes(limit: $limit) { changes { id } } }`,
+			vars:  map[string]interface{}{"limit": 1e6},
+			want:  1 + 1 + maxListSize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := request{Query: tt.query, Variables: tt.vars}
+
+			h.limits = Limits{MaxComplexity: tt.want}
+			if _, errs := h.prepare(req); errs != nil {
+				t.Errorf("prepare() with limit %d errors = %v, want none", tt.want, errs)
+			}
+
+			h.limits = Limits{MaxComplexity: tt.want - 1}
+			if _, errs := h.prepare(req); len(errs) == 0 || !strings.Contains(errs[0].Message, "complexity") {
+				t.Errorf("prepare() with limit %d passed, want complexity %d rejected", tt.want-1, tt.want)
+			}
+		})
+	}
+}
+
+func dial(t *testing.T, h *GraphQLHandlers) *websocket.Conn {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(h.Subscriptions))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	return ws
+}
+
+// initialize проходит connection_init с токеном reader
+func initialize(t *testing.T, ws *websocket.Conn) {
+	t.Helper()
+
+	if err := ws.WriteJSON(message{Type: msgConnectionInit, Payload: json.RawMessage(`{"Authorization":"Bearer reader"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg message
+	if err := ws.ReadJSON(&msg); err != nil || msg.Type != msgConnectionAck {
+		t.Fatalf("ReadJSON() = %+v, %v, want %s", msg, err, msgConnectionAck)
+	}
+}
+
+// readClose читает сообщения до ошибки чтения
+func readClose(ws *websocket.Conn) error {
+	for {
+		var msg message
+		if err := ws.ReadJSON(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+func TestGraphQLHandlers_Subscriptions(t *testing.T) {
+	service := newFakeNotes()
+	service.changes = []models.NoteChange{{ID: noteA, Version: 2}}
+	ws := dial(t, newTestHandlers(t, service, Limits{}))
+	initialize(t, ws)
+
+	var msg message
+	payload := json.RawMessage(`{"query":"subscription { noteChanged { id version note { content } } }"}`)
+	if err := ws.WriteJSON(message{ID: "1", Type: msgSubscribe, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.ReadJSON(&msg); err != nil || msg.Type != msgNext || msg.ID != "1" {
+		t.Fatalf("ReadJSON() = %+v, %v, want %s", msg, err, msgNext)
+	}
+
+	var res result
+	if err := json.Unmarshal(msg.Payload, &res); err != nil {
+		t.Fatal(err)
+	}
+	change, _ := res.Data["noteChanged"].(map[string]interface{})
+	note, _ := change["note"].(map[string]interface{})
+	if change["id"] != noteA || note["content"] != "first" {
+		t.Errorf("noteChanged = %v", change)
+	}
+
+	if err := ws.WriteJSON(message{ID: "1", Type: msgComplete}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.WriteJSON(message{Type: msgPing}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.ReadJSON(&msg); err != nil || msg.Type != msgPong {
+		t.Fatalf("ReadJSON() = %+v, %v, want %s", msg, err, msgPong)
+	}
+}
+
+func TestGraphQLHandlers_SubscriptionsRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []message
+		limits    map[string]int
+		closeCode int
+	}{
+		{
+			name:      "Invalid token",
+			messages:  []message{{Type: msgConnectionInit, Payload: json.RawMessage(`{"Authorization":"Bearer nope"}`)}},
+			closeCode: closeForbidden,
+		},
+		{
+			name:      "Subscribe before init",
+			messages:  []message{{ID: "1", Type: msgSubscribe, Payload: json.RawMessage(`{"query":"subscription { noteChanged { id } }"}`)}},
+			closeCode: closeUnauthorized,
+		},
+		{
+			name: "Second init",
+			messages: []message{
+				{Type: msgConnectionInit, Payload: json.RawMessage(`{"X-API-Key":"reader"}`)},
+				{Type: msgConnectionInit},
+			},
+			closeCode: closeTooManyInitRequests,
+		},
+		{
+			name:      "Rate limited caller",
+			messages:  []message{{Type: msgConnectionInit, Payload: json.RawMessage(`{"X-API-Key":"reader"}`)}},
+			limits:    map[string]int{routeSubscribe: 0},
+			closeCode: closeTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, newFakeNotes(), Limits{})
+			h.limiter = &fakeLimiter{routes: tt.limits}
+			ws := dial(t, h)
+
+			for _, msg := range tt.messages {
+				if err := ws.WriteJSON(msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := readClose(ws); !websocket.IsCloseError(err, tt.closeCode) {
+				t.Errorf("ReadJSON() error = %v, want close %d", err, tt.closeCode)
+			}
+		})
+	}
+}
+
+func TestGraphQLHandlers_SubscriptionsLimited(t *testing.T) {
+	subscribe := func(id, query string) message {
+		payload, _ := json.Marshal(request{Query: query})
+		return message{ID: id, Type: msgSubscribe, Payload: payload}
+	}
+
+	t.Run("Operations per connection", func(t *testing.T) {
+		ws := dial(t, newTestHandlers(t, newFakeNotes(), Limits{}))
+		initialize(t, ws)
+
+		for i := 0; i <= maxOperations; i++ {
+			if err := ws.WriteJSON(subscribe(strconv.Itoa(i), `subscription { noteChanged { id } }`)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var msg message
+		if err := ws.ReadJSON(&msg); err != nil || msg.Type != msgError || msg.ID != strconv.Itoa(maxOperations) {
+			t.Fatalf("ReadJSON() = %+v, %v, want %s for the last operation", msg, err, msgError)
+		}
+		if !strings.Contains(string(msg.Payload), codeTooManyOperations) {
+			t.Errorf("payload = %s, want %q", msg.Payload, codeTooManyOperations)
+		}
+	})
+
+	t.Run("Operations count against the caller", func(t *testing.T) {
+		h := newTestHandlers(t, newFakeNotes(), Limits{})
+		h.limiter = &fakeLimiter{routes: map[string]int{routeQuery: 1}}
+		ws := dial(t, h)
+		initialize(t, ws)
+
+		for _, id := range []string{"1", "2"} {
+			if err := ws.WriteJSON(subscribe(id, `{ note(id: "`+noteA+`") { id } }`)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := map[string]string{}
+		for len(got) < 2 {
+			var msg message
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == msgError && !strings.Contains(string(msg.Payload), codeRateLimited) {
+				t.Errorf("payload = %s, want %q", msg.Payload, codeRateLimited)
+			}
+			if msg.Type != msgNext {
+				got[msg.ID] = msg.Type
+			}
+		}
+
+		if got["1"] != msgComplete || got["2"] != msgError {
+			t.Errorf("operations = %v, want 1 completed and 2 rejected", got)
+		}
+	})
+
+	// без ограничения сервер прочитал бы сообщение и ответил ошибкой разбора
+	t.Run("Message size", func(t *testing.T) {
+		ws := dial(t, newTestHandlers(t, newFakeNotes(), Limits{}))
+		initialize(t, ws)
+
+		_ = ws.WriteJSON(subscribe("1", strings.Repeat("{", maxRequestSize)))
+
+		// сервер может и сбросить соединение, не дочитав сообщение
+		var msg message
+		err := ws.ReadJSON(&msg)
+		var closeErr *websocket.CloseError
+		var netErr net.Error
+		switch {
+		case err == nil:
+			t.Errorf("ReadJSON() = %s message, want the connection closed", msg.Type)
+		case errors.As(err, &closeErr) && closeErr.Code != websocket.CloseMessageTooBig,
+			errors.As(err, &netErr) && netErr.Timeout():
+			t.Errorf("ReadJSON() error = %v, want close %d", err, websocket.CloseMessageTooBig)
+		}
+	})
+}
+
+func TestGraphQLHandlers_SubscriptionsRecheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		revoke    func(auth *fakeAuthenticator, access *fakeAccess)
+		closeCode int
+	}{
+		{
+			name:      "Token revoked",
+			revoke:    func(auth *fakeAuthenticator, access *fakeAccess) { auth.revoke("reader") },
+			closeCode: closeUnauthorized,
+		},
+		{
+			name:      "User disabled",
+			revoke:    func(auth *fakeAuthenticator, access *fakeAccess) { access.disabled.Store(true) },
+			closeCode: closeForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newFakeNotes()
+			auth := &fakeAuthenticator{tokens: map[string]string{"reader": oa.ScopeNotesRead}}
+			access := &fakeAccess{}
+			h := newTestHandlers(t, service, Limits{})
+			h.authenticator, h.access = auth, access
+
+			ws := dial(t, h)
+			initialize(t, ws)
+
+			payload := json.RawMessage(`{"query":"subscription { noteChanged { id } }"}`)
+			if err := ws.WriteJSON(message{ID: "1", Type: msgSubscribe, Payload: payload}); err != nil {
+				t.Fatal(err)
+			}
+
+			// дожидаемся первого опроса, чтобы подписка точно работала
+			for {
+				service.mu.Lock()
+				polls := service.polls
+				service.mu.Unlock()
+				if polls > 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			tt.revoke(auth, access)
+
+			if err := readClose(ws); !websocket.IsCloseError(err, tt.closeCode) {
+				t.Errorf("ReadJSON() error = %v, want close %d", err, tt.closeCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package graphqlHandlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"testovoe/internal/services/notesService"
+)
+
+// maxListSize is what a list without a bound, e.g. all notes of the
+// caller, is assumed to hold when estimating the cost of a query. It is
+// also the most a limit argument is counted for, as the service never
+// returns longer pages.
+const maxListSize = notesService.MaxSyncLimit
+
+// Limits bound the shape of the operations clients may send. Depth counts
+// nested selections, 1 for a top-level field; complexity is one point per
+// field, with everything selected under a list multiplied by its size: the
+// number of ids asked for, or the limit argument of the list or of the
+// field it is in. Introspection fields count like any other.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// checkLimits measures the operation that is about to run. It expects a
+// validated document, so fragments do not form cycles.
+func checkLimits(schema *graphql.Schema, doc *ast.Document, op *ast.OperationDefinition, vars map[string]interface{}, limits Limits) error {
+	w := &walker{
+		schema:    schema,
+		fragments: fragments(doc),
+		vars:      vars,
+	}
+
+	root := rootType(schema, op)
+	if root == nil {
+		return nil
+	}
+
+	depth, complexity := w.selectionSet(op.SelectionSet, root, 0)
+
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return newError(codeQueryTooDeep, fmt.Sprintf("query depth %d exceeds the limit of %d", depth, limits.MaxDepth))
+	}
+
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return newError(codeQueryTooComplex, fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, limits.MaxComplexity))
+	}
+
+	return nil
+}
+
+type walker struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	vars      map[string]interface{}
+}
+
+// selectionSet measures the selections of a field; size is what the
+// arguments of that field bound its lists to, 0 if nothing.
+func (w *walker) selectionSet(set *ast.SelectionSet, parent graphql.Type, size int) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, c int
+
+		switch s := selection.(type) {
+		case *ast.Field:
+			d, c = w.field(s, parent, size)
+		case *ast.InlineFragment:
+			d, c = w.selectionSet(s.SelectionSet, w.typeCondition(s.TypeCondition, parent), size)
+		case *ast.FragmentSpread:
+			fragment, ok := w.fragments[s.Name.Value]
+			if !ok {
+				continue
+			}
+			d, c = w.selectionSet(fragment.SelectionSet, w.typeCondition(fragment.TypeCondition, parent), size)
+		}
+
+		depth = max(depth, d)
+		complexity += c
+	}
+
+	return depth, complexity
+}
+
+func (w *walker) field(f *ast.Field, parent graphql.Type, parentSize int) (depth, complexity int) {
+	def := fieldDef(parent, f.Name.Value)
+	if def == nil {
+		return 1, 1
+	}
+
+	// a list takes its size from its own arguments or else from the field
+	// it is in, as the changes of changes(limit: ...) do
+	size, bounded := w.size(f, def)
+	multiplier := 1
+	if isList(def.Type) {
+		switch {
+		case bounded:
+			multiplier = size
+		case parentSize > 0:
+			multiplier = parentSize
+		default:
+			multiplier = maxListSize
+		}
+		size = 0
+	}
+
+	childDepth, childComplexity := w.selectionSet(f.SelectionSet, namedType(def.Type), size)
+
+	return 1 + childDepth, 1 + multiplier*childComplexity
+}
+
+// size is the number of items the arguments of the field ask for: the
+// number of ids, or the limit as sent or as defaulted by the schema, at
+// most maxListSize. It is not bounded if the field takes neither.
+func (w *walker) size(f *ast.Field, def *graphql.FieldDefinition) (int, bool) {
+	for _, arg := range f.Arguments {
+		switch arg.Name.Value {
+		case "ids":
+			if n, ok := w.length(arg.Value); ok {
+				return n, true
+			}
+		case "limit":
+			if n, ok := w.int(arg.Value); ok && n > 0 {
+				return min(n, maxListSize), true
+			}
+		}
+	}
+
+	for _, arg := range def.Args {
+		if arg.Name() != "limit" {
+			continue
+		}
+
+		if n, ok := intValue(arg.DefaultValue); ok && n > 0 {
+			return min(n, maxListSize), true
+		}
+	}
+
+	return 0, false
+}
+
+func (w *walker) int(value ast.Value) (int, bool) {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		var n int
+		if _, err := fmt.Sscan(v.Value, &n); err == nil {
+			return n, true
+		}
+	case *ast.Variable:
+		return intValue(w.vars[v.Name.Value])
+	}
+
+	return 0, false
+}
+
+// length is the number of items of a list argument. A single value stands
+// for a list of one; a missing or null list is unbounded.
+func (w *walker) length(value ast.Value) (int, bool) {
+	switch v := value.(type) {
+	case *ast.ListValue:
+		return len(v.Values), true
+	case *ast.Variable:
+		switch items := w.vars[v.Name.Value].(type) {
+		case nil:
+			return 0, false
+		case []interface{}:
+			return len(items), true
+		default:
+			return 1, true
+		}
+	}
+
+	return 1, true
+}
+
+func (w *walker) typeCondition(cond *ast.Named, parent graphql.Type) graphql.Type {
+	if cond == nil {
+		return parent
+	}
+
+	if t := w.schema.Type(cond.Name.Value); t != nil {
+		return t
+	}
+
+	return parent
+}
+
+func fragments(doc *ast.Document) map[string]*ast.FragmentDefinition {
+	out := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			out[fragment.Name.Value] = fragment
+		}
+	}
+
+	return out
+}
+
+func rootType(schema *graphql.Schema, op *ast.OperationDefinition) *graphql.Object {
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		return schema.MutationType()
+	case ast.OperationTypeSubscription:
+		return schema.SubscriptionType()
+	default:
+		return schema.QueryType()
+	}
+}
+
+// fieldDef looks up the field on its parent type, including the meta
+// fields that the schema does not list among the fields of its types.
+func fieldDef(parent graphql.Type, name string) *graphql.FieldDefinition {
+	switch name {
+	case graphql.SchemaMetaFieldDef.Name:
+		return graphql.SchemaMetaFieldDef
+	case graphql.TypeMetaFieldDef.Name:
+		return graphql.TypeMetaFieldDef
+	case graphql.TypeNameMetaFieldDef.Name:
+		return graphql.TypeNameMetaFieldDef
+	}
+
+	switch t := parent.(type) {
+	case *graphql.Object:
+		return t.Fields()[name]
+	case *graphql.Interface:
+		return t.Fields()[name]
+	}
+
+	return nil
+}
+
+func namedType(t graphql.Type) graphql.Type {
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		case *graphql.List:
+			t = wrapped.OfType
+		default:
+			return t
+		}
+	}
+}
+
+func isList(t graphql.Type) bool {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+
+	_, ok := t.(*graphql.List)
+
+	return ok
+}
+
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	}
+
+	return 0, false
+}
@@ -0,0 +1,106 @@
+package graphqlHandlers
+
+import (
+	"context"
+	"github.com/graph-gophers/dataloader/v7"
+	"testovoe/internal/models"
+	"testovoe/internal/services/notesService"
+)
+
+// maxBatch keeps the ID list of one storage query bounded.
+const maxBatch = 100
+
+type loaderKey struct{}
+
+// loaders collect the lookups made while an operation resolves and fetch
+// them with one storage query per batch: notes by ID with GetNotesByIDs,
+// and who notes are shared with with GetNoteShares. They do not cache, so
+// a subscription that outlives many batches never serves stale notes.
+type loaders struct {
+	notes  *dataloader.Loader[string, models.Note]
+	shares *dataloader.Loader[string, []models.NoteShare]
+}
+
+func newLoaders(service NotesService, owner string) *loaders {
+	return &loaders{
+		notes:  newNoteLoader(service, owner),
+		shares: newShareLoader(service, owner),
+	}
+}
+
+func newNoteLoader(service NotesService, owner string) *dataloader.Loader[string, models.Note] {
+	batch := func(ctx context.Context, ids []string) []*dataloader.Result[models.Note] {
+		results := make([]*dataloader.Result[models.Note], len(ids))
+
+		notes, err := service.GetNotesByIDs(ctx, ids, owner)
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result[models.Note]{Error: err}
+			}
+			return results
+		}
+
+		byID := make(map[string]models.Note, len(notes))
+		for _, note := range notes {
+			byID[note.ID] = note
+		}
+
+		for i, id := range ids {
+			note, ok := byID[id]
+			if !ok {
+				results[i] = &dataloader.Result[models.Note]{Error: notesService.ErrNoteNotFound}
+				continue
+			}
+			results[i] = &dataloader.Result[models.Note]{Data: note}
+		}
+
+		return results
+	}
+
+	return dataloader.NewBatchedLoader(batch,
+		dataloader.WithCache[string, models.Note](&dataloader.NoCache[string, models.Note]{}),
+		dataloader.WithBatchCapacity[string, models.Note](maxBatch),
+	)
+}
+
+// newShareLoader resolves a note ID to the shares of the note, none for a
+// note of another user.
+func newShareLoader(service NotesService, owner string) *dataloader.Loader[string, []models.NoteShare] {
+	batch := func(ctx context.Context, ids []string) []*dataloader.Result[[]models.NoteShare] {
+		results := make([]*dataloader.Result[[]models.NoteShare], len(ids))
+
+		shares, err := service.GetNoteShares(ctx, ids, owner)
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result[[]models.NoteShare]{Error: err}
+			}
+			return results
+		}
+
+		byNote := make(map[string][]models.NoteShare, len(ids))
+		for _, share := range shares {
+			byNote[share.NoteID] = append(byNote[share.NoteID], share)
+		}
+
+		for i, id := range ids {
+			results[i] = &dataloader.Result[[]models.NoteShare]{Data: byNote[id]}
+		}
+
+		return results
+	}
+
+	return dataloader.NewBatchedLoader(batch,
+		dataloader.WithCache[string, []models.NoteShare](&dataloader.NoCache[string, []models.NoteShare]{}),
+		dataloader.WithBatchCapacity[string, []models.NoteShare](maxBatch),
+	)
+}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	l, _ := ctx.Value(loaderKey{}).(*loaders)
+
+	return l
+}
@@ -0,0 +1,637 @@
+package graphqlHandlers
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"log/slog"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/models"
+	"testovoe/internal/services/notesService"
+	"time"
+)
+
+// newSchema describes the notes of the caller, their tags and notebooks and
+// who they are shared with. Notes and their shares are looked up by note ID
+// through the loaders of the operation, so selecting many of them, e.g. the
+// notes of a page of changes, costs one storage query each.
+func (h *GraphQLHandlers) newSchema() (graphql.Schema, error) {
+	share := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Share",
+		Fields: graphql.Fields{
+			"username": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"sharedAt": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.NoteShare).CreatedAt, nil
+				},
+			},
+		},
+	})
+
+	note := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Note",
+		Fields: graphql.Fields{
+			"id":      &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"content": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"owner":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"html": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "Content rendered to sanitized HTML.",
+				Resolve:     h.resolveHTML,
+			},
+			"tags": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if tags := p.Source.(models.Note).Tags; tags != nil {
+						return tags, nil
+					}
+					return []string{}, nil
+				},
+			},
+			"notebook": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Slash separated path of the notebook, null for a note outside one.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if notebook := p.Source.(models.Note).Notebook; notebook != "" {
+						return notebook, nil
+					}
+					return nil, nil
+				},
+			},
+			"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"sharedWith": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(share))),
+				Description: "Users the note is shared with, oldest share first. Only its owner sees them.",
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: notesService.MaxNoteShares},
+				},
+				Resolve: h.resolveSharedWith,
+			},
+		},
+	})
+
+	tag := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tag",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"notes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	notebook := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Notebook",
+		Fields: graphql.Fields{
+			"path":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"notes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	change := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "NoteChange",
+		Description: "A note created, updated or deleted at some point of the change sequence.",
+		Fields: graphql.Fields{
+			"id":      &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"version": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"deleted": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"updatedAt": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.NoteChange).UpdatedAt, nil
+				},
+			},
+			"note": &graphql.Field{
+				Type:        note,
+				Description: "The current state of the note, null once it is deleted.",
+				Resolve:     h.resolveChangeNote,
+			},
+		},
+	})
+
+	changeSet := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ChangeSet",
+		Fields: graphql.Fields{
+			"changes": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(change))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.ChangeSet).Changes, nil
+				},
+			},
+			"token": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "Resumes after the last returned change.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.ChangeSet).NextToken, nil
+				},
+			},
+			"hasMore": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.ChangeSet).HasMore, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"note": &graphql.Field{
+				Type: note,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.resolveNote,
+			},
+			"notes": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(note))),
+				Description: "All notes, or the ones with the given IDs in that order. All notes count " +
+					"as the largest page towards the complexity limit; page through changes instead.",
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.ID))},
+				},
+				Resolve: h.resolveNotes,
+			},
+			"searchNotes": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(note))),
+				Description: "Full-text search, best match first.",
+				Args: graphql.FieldConfigArgument{
+					"query": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 20},
+				},
+				Resolve: h.resolveSearch,
+			},
+			"tags": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tag))),
+				Description: "Tags with the number of notes carrying each, most used first.",
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: notesService.DefaultListLimit},
+				},
+				Resolve: h.resolveTags,
+			},
+			"notebooks": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(notebook))),
+				Description: "Notebooks with the number of notes in each, by path.",
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: notesService.DefaultListLimit},
+				},
+				Resolve: h.resolveNotebooks,
+			},
+			"sharedNotes": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(note))),
+				Description: "Notes other users shared with the caller, most recently updated first.",
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: notesService.DefaultListLimit},
+				},
+				Resolve: h.resolveSharedNotes,
+			},
+			"changes": &graphql.Field{
+				Type:        graphql.NewNonNull(changeSet),
+				Description: "Changes since a sync token, as GET /api/v1/notes/sync returns them.",
+				Args: graphql.FieldConfigArgument{
+					"token": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: notesService.DefaultSyncLimit},
+				},
+				Resolve: h.resolveChanges,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createNote": &graphql.Field{
+				Type:        graphql.NewNonNull(note),
+				Description: "Content with spelling errors is rejected.",
+				Args: graphql.FieldConfigArgument{
+					"content": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveCreateNote,
+			},
+			"updateNote": &graphql.Field{
+				Type: graphql.NewNonNull(note),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"content": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveUpdateNote,
+			},
+			"deleteNote": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.resolveDeleteNote,
+			},
+			"shareNote": &graphql.Field{
+				Type:        graphql.NewNonNull(note),
+				Description: "Gives another user read access to the note.",
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"username": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveShareNote,
+			},
+			"unshareNote": &graphql.Field{
+				Type: graphql.NewNonNull(note),
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"username": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveUnshareNote,
+			},
+		},
+	})
+
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"noteChanged": &graphql.Field{
+				Type: graphql.NewNonNull(change),
+				Description: "Every change of the caller's notes after the sync token, or " +
+					"from now on without one.",
+				Args: graphql.FieldConfigArgument{
+					"token": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+				},
+				Subscribe: h.subscribeNoteChanged,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Mutation:     mutation,
+		Subscription: subscription,
+	})
+}
+
+func (h *GraphQLHandlers) resolveNote(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errInvalidID
+	}
+
+	return loadNote(p.Context, id), nil
+}
+
+func (h *GraphQLHandlers) resolveNotes(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	ids, ok := p.Args["ids"].([]interface{})
+	if !ok {
+		notes, err := h.service.GetNotes(p.Context, owner)
+		if err != nil {
+			return nil, resolverError(p.Context, err)
+		}
+
+		return notes, nil
+	}
+
+	thunks := make([]func() (interface{}, error), 0, len(ids))
+	for _, raw := range ids {
+		id, _ := raw.(string)
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, errInvalidID
+		}
+		thunks = append(thunks, loadNote(p.Context, id))
+	}
+
+	return func() (interface{}, error) {
+		notes := make([]models.Note, 0, len(thunks))
+		for _, thunk := range thunks {
+			note, err := thunk()
+			if err != nil {
+				return nil, err
+			}
+			notes = append(notes, note.(models.Note))
+		}
+
+		return notes, nil
+	}, nil
+}
+
+func (h *GraphQLHandlers) resolveChangeNote(p graphql.ResolveParams) (interface{}, error) {
+	change := p.Source.(models.NoteChange)
+	if change.Deleted {
+		return nil, nil
+	}
+
+	return loadNote(p.Context, change.ID), nil
+}
+
+// loadNote queues the lookup on the loader of the operation and returns a
+// thunk, which the executor calls only after the whole level of the query
+// has queued its lookups.
+func loadNote(ctx context.Context, id string) func() (interface{}, error) {
+	thunk := loadersFrom(ctx).notes.Load(ctx, id)
+
+	return func() (interface{}, error) {
+		note, err := thunk()
+		if err != nil {
+			return nil, resolverError(ctx, err)
+		}
+
+		return note, nil
+	}
+}
+
+// resolveHTML renders the note already loaded rather than fetching it
+// again, so a list of notes with their html still costs one query.
+func (h *GraphQLHandlers) resolveHTML(p graphql.ResolveParams) (interface{}, error) {
+	note := p.Source.(models.Note)
+
+	html, err := h.renderer.Render(note.Content)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return html, nil
+}
+
+func (h *GraphQLHandlers) resolveSearch(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	query, _ := p.Args["query"].(string)
+	limit, _ := p.Args["limit"].(int)
+
+	notes, err := h.service.SearchNotes(p.Context, owner, query, limit)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return notes, nil
+}
+
+func (h *GraphQLHandlers) resolveChanges(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	token, _ := p.Args["token"].(string)
+	limit, _ := p.Args["limit"].(int)
+
+	set, err := h.service.GetChanges(p.Context, owner, token, limit)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return set, nil
+}
+
+func (h *GraphQLHandlers) resolveCreateNote(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	if err := h.allow(p.Context, routeCreateNote); err != nil {
+		return nil, err
+	}
+
+	content, _ := p.Args["content"].(string)
+
+	noteID, err := h.service.AddNote(p.Context, content, owner)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return loadNote(p.Context, noteID), nil
+}
+
+func (h *GraphQLHandlers) resolveUpdateNote(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	if err := h.allow(p.Context, routeUpdateNote); err != nil {
+		return nil, err
+	}
+
+	id, _ := p.Args["id"].(string)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errInvalidID
+	}
+	content, _ := p.Args["content"].(string)
+
+	if err := h.service.UpdateNote(p.Context, id, content, owner); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return loadNote(p.Context, id), nil
+}
+
+func (h *GraphQLHandlers) resolveDeleteNote(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	if err := h.allow(p.Context, routeDeleteNote); err != nil {
+		return nil, err
+	}
+
+	id, _ := p.Args["id"].(string)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errInvalidID
+	}
+
+	if err := h.service.DeleteNote(p.Context, id, owner); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return id, nil
+}
+
+func (h *GraphQLHandlers) resolveShareNote(p graphql.ResolveParams) (interface{}, error) {
+	return h.changeShare(p, h.service.ShareNote)
+}
+
+func (h *GraphQLHandlers) resolveUnshareNote(p graphql.ResolveParams) (interface{}, error) {
+	return h.changeShare(p, h.service.UnshareNote)
+}
+
+// changeShare shares or unshares a note, which counts as updating it, and
+// resolves to the note as stored afterwards.
+func (h *GraphQLHandlers) changeShare(p graphql.ResolveParams, change func(ctx context.Context, noteId, username, owner string) error) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	if err := h.allow(p.Context, routeUpdateNote); err != nil {
+		return nil, err
+	}
+
+	id, _ := p.Args["id"].(string)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errInvalidID
+	}
+	username, _ := p.Args["username"].(string)
+
+	if err := change(p.Context, id, username, owner); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return loadNote(p.Context, id), nil
+}
+
+func (h *GraphQLHandlers) resolveSharedWith(p graphql.ResolveParams) (interface{}, error) {
+	note := p.Source.(models.Note)
+	limit, _ := p.Args["limit"].(int)
+
+	thunk := loadersFrom(p.Context).shares.Load(p.Context, note.ID)
+
+	return func() (interface{}, error) {
+		shares, err := thunk()
+		if err != nil {
+			return nil, resolverError(p.Context, err)
+		}
+
+		if limit > 0 && len(shares) > limit {
+			shares = shares[:limit]
+		}
+		if shares == nil {
+			shares = []models.NoteShare{}
+		}
+
+		return shares, nil
+	}, nil
+}
+
+func (h *GraphQLHandlers) resolveSharedNotes(p graphql.ResolveParams) (interface{}, error) {
+	username, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	limit, _ := p.Args["limit"].(int)
+
+	notes, err := h.service.GetSharedNotes(p.Context, username, limit)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return notes, nil
+}
+
+func (h *GraphQLHandlers) resolveTags(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	limit, _ := p.Args["limit"].(int)
+
+	tags, err := h.service.ListTags(p.Context, owner, limit)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return tags, nil
+}
+
+func (h *GraphQLHandlers) resolveNotebooks(p graphql.ResolveParams) (interface{}, error) {
+	owner, ok := oa.Credential(p.Context)
+	if !ok {
+		return nil, resolverError(p.Context, problem.ErrUnauthorized)
+	}
+
+	limit, _ := p.Args["limit"].(int)
+
+	notebooks, err := h.service.ListNotebooks(p.Context, owner, limit)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	return notebooks, nil
+}
+
+// subscribeNoteChanged follows the change feed of the caller. The feed is
+// shared by all instances through the database, so it is polled rather
+// than pushed; a failed poll is logged and retried on the next tick. Each
+// poll first rechecks the token and the user, which ends the subscription
+// along with its connection once they are no longer valid.
+func (h *GraphQLHandlers) subscribeNoteChanged(p graphql.ResolveParams) (interface{}, error) {
+	const op = "graphqlHandlers.subscribeNoteChanged"
+
+	ctx := p.Context
+	log := logger.FromContext(ctx, slog.Default()).With(slog.String("op", op))
+
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, resolverError(ctx, problem.ErrUnauthorized)
+	}
+	recheck := recheckFrom(ctx)
+
+	token, _ := p.Args["token"].(string)
+	if token == "" {
+		current, err := h.service.CurrentSyncToken(ctx, owner)
+		if err != nil {
+			return nil, resolverError(ctx, err)
+		}
+		token = current
+	} else if _, err := h.service.GetChanges(ctx, owner, token, 1); err != nil {
+		// a bad token would otherwise fail every poll
+		return nil, resolverError(ctx, err)
+	}
+
+	events := make(chan interface{})
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(h.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if recheck(ctx) != nil {
+				return
+			}
+
+			for {
+				set, err := h.service.GetChanges(ctx, owner, token, notesService.MaxSyncLimit)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.WarnContext(ctx, "failed to poll changes", slog.String("error", err.Error()))
+					}
+					break
+				}
+
+				for _, change := range set.Changes {
+					select {
+					case events <- change:
+					case <-ctx.Done():
+						return
+					}
+				}
+
+				token = set.NextToken
+				if !set.HasMore {
+					break
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,399 @@
+package graphqlHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"time"
+)
+
+// The graphql-transport-ws protocol, as spoken by graphql-ws and Apollo.
+const (
+	subprotocol = "graphql-transport-ws"
+
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+
+	closeInvalidMessage      = 4400
+	closeUnauthorized        = 4401
+	closeForbidden           = 4403
+	closeInitTimeout         = 4408
+	closeSubscriberExists    = 4409
+	closeTooManyInitRequests = 4429
+	closeTooManyRequests     = 4429
+
+	initTimeout = 10 * time.Second
+
+	// maxOperations bounds the operations running at once on a connection,
+	// each subscription polling the change feed on its own
+	maxOperations = 16
+)
+
+var errMissingToken = errors.New("missing bearer token or API key")
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{subprotocol},
+	// the token travels in connection_init, not in cookies, so a foreign
+	// page gains nothing from opening a socket
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type recheckKey struct{}
+
+type message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// connection is one WebSocket with the operations running on it.
+type connection struct {
+	h     *GraphQLHandlers
+	ws    *websocket.Conn
+	log   *slog.Logger
+	ctx   context.Context
+	token string
+	mu    sync.Mutex
+	wmu   sync.Mutex
+	subs  map[string]context.CancelFunc
+	wg    sync.WaitGroup
+}
+
+// Subscriptions serves the graphql-transport-ws protocol. Browsers cannot
+// send an Authorization header with a WebSocket, so the token is taken
+// from the connection_init payload, as "Authorization" ("Bearer ...") or
+// "X-API-Key". The connection counts against the rate limit of the caller
+// once authenticated, and so does every operation started on it.
+func (h *GraphQLHandlers) Subscriptions(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied
+		return
+	}
+	defer ws.Close()
+
+	ws.SetReadLimit(maxRequestSize)
+
+	if ws.Subprotocol() != subprotocol {
+		closeWith(ws, websocket.CloseProtocolError, "unsupported subprotocol")
+		return
+	}
+
+	// the server timeouts were meant for plain requests and would cut the
+	// socket off; the hijacked connection keeps them unless cleared
+	_ = ws.NetConn().SetDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	c := &connection{
+		h:    h,
+		ws:   ws,
+		log:  logger.FromContext(ctx, slog.Default()),
+		subs: make(map[string]context.CancelFunc),
+	}
+
+	c.ctx, err = c.init(ctx)
+	if err != nil {
+		return
+	}
+
+	c.serve()
+
+	cancel()
+	c.wg.Wait()
+}
+
+// init waits for connection_init and authenticates its payload.
+func (c *connection) init(ctx context.Context) (context.Context, error) {
+	_ = c.ws.SetReadDeadline(time.Now().Add(initTimeout))
+
+	var msg message
+	if err := c.ws.ReadJSON(&msg); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			closeWith(c.ws, closeInitTimeout, "Connection initialisation timeout")
+		}
+		return nil, err
+	}
+
+	_ = c.ws.SetReadDeadline(time.Time{})
+
+	if msg.Type != msgConnectionInit {
+		closeWith(c.ws, closeUnauthorized, "Unauthorized")
+		return nil, fmt.Errorf("unexpected %q before %q", msg.Type, msgConnectionInit)
+	}
+
+	ctx, err := c.authenticate(ctx, msg.Payload)
+	if err != nil {
+		closeWith(c.ws, closeForbidden, "Forbidden")
+		return nil, err
+	}
+
+	if err := c.h.allow(ctx, routeSubscribe); err != nil {
+		closeWith(c.ws, closeTooManyRequests, "Too many requests")
+		return nil, err
+	}
+
+	if err := c.write(message{Type: msgConnectionAck}); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+func (c *connection) authenticate(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+	var params map[string]interface{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	var token string
+	for key, value := range params {
+		v, _ := value.(string)
+
+		switch strings.ToLower(key) {
+		case "x-api-key":
+			token = v
+		case "authorization":
+			if token == "" && len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+				token = v[7:]
+			}
+		}
+	}
+	if token == "" {
+		return nil, errMissingToken
+	}
+
+	ctx, err := c.h.authenticator.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.h.access.CheckActive(ctx); err != nil {
+		return nil, err
+	}
+
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, problem.ErrUnauthorized
+	}
+
+	c.log = c.log.With(slog.String("user", owner))
+	c.token = token
+
+	ctx = context.WithValue(ctx, recheckKey{}, c.recheck)
+
+	return withLoaders(logger.WithLogger(ctx, c.log), newLoaders(c.h.service, owner)), nil
+}
+
+// recheck verifies the token of the connection and the user again, so that
+// a socket does not outlive an expired or revoked token or a disabled
+// account. On failure it closes the connection, which ends serve.
+func (c *connection) recheck(ctx context.Context) error {
+	code, reason := closeUnauthorized, "Unauthorized"
+
+	authenticated, err := c.h.authenticator.Authenticate(ctx, c.token)
+	if err == nil {
+		code, reason = closeForbidden, "Forbidden"
+		err = c.h.access.CheckActive(authenticated)
+	}
+
+	// an operation that ended meanwhile says nothing about the token
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	c.log.InfoContext(ctx, "closing connection, no longer authorized", slog.String("error", err.Error()))
+	closeWith(c.ws, code, reason)
+	_ = c.ws.Close()
+
+	return err
+}
+
+// recheckFrom returns the recheck of the connection the operation runs on,
+// or a no-op for operations sent with POST.
+func recheckFrom(ctx context.Context) func(ctx context.Context) error {
+	if recheck, ok := ctx.Value(recheckKey{}).(func(ctx context.Context) error); ok {
+		return recheck
+	}
+
+	return func(ctx context.Context) error { return nil }
+}
+
+func (c *connection) serve() {
+	for {
+		var msg message
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				closeWith(c.ws, closeInvalidMessage, "Invalid message received")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case msgPing:
+			if err := c.write(message{Type: msgPong}); err != nil {
+				return
+			}
+		case msgPong:
+		case msgConnectionInit:
+			closeWith(c.ws, closeTooManyInitRequests, "Too many initialisation requests")
+			return
+		case msgSubscribe:
+			if !c.subscribe(msg) {
+				return
+			}
+		case msgComplete:
+			c.mu.Lock()
+			if cancel, ok := c.subs[msg.ID]; ok {
+				cancel()
+				delete(c.subs, msg.ID)
+			}
+			c.mu.Unlock()
+		default:
+			closeWith(c.ws, closeInvalidMessage, fmt.Sprintf("Invalid message type %q", msg.Type))
+			return
+		}
+	}
+}
+
+// subscribe starts an operation, which may also be a query or mutation
+// answered with a single result. It returns false when the connection has
+// been closed.
+func (c *connection) subscribe(msg message) bool {
+	var req request
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+		closeWith(c.ws, closeInvalidMessage, "Invalid message received")
+		return false
+	}
+
+	if c.recheck(c.ctx) != nil {
+		return false
+	}
+
+	if err := c.h.allow(c.ctx, routeQuery); err != nil {
+		_ = c.writePayload(msg.ID, msgError, formatErrors(err))
+		return true
+	}
+
+	c.mu.Lock()
+	if _, ok := c.subs[msg.ID]; ok {
+		c.mu.Unlock()
+		closeWith(c.ws, closeSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+		return false
+	}
+	if len(c.subs) >= maxOperations {
+		c.mu.Unlock()
+		err := newError(codeTooManyOperations, fmt.Sprintf("at most %d operations may run at once on a connection", maxOperations))
+		_ = c.writePayload(msg.ID, msgError, formatErrors(err))
+		return true
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.subs[msg.ID] = cancel
+	c.mu.Unlock()
+
+	op, errs := c.h.prepare(req)
+	if errs == nil && !allowed(ctx, op) {
+		errs = formatErrors(errInsufficientScope)
+	}
+	if errs != nil {
+		c.finish(msg.ID)
+		_ = c.writePayload(msg.ID, msgError, errs)
+		return true
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		params := graphql.ExecuteParams{
+			Schema:        c.h.schema,
+			AST:           op.doc,
+			OperationName: op.name,
+			Args:          op.vars,
+			Context:       ctx,
+		}
+
+		if op.def.Operation != ast.OperationTypeSubscription {
+			_ = c.writePayload(msg.ID, msgNext, graphql.Execute(params))
+		} else {
+			// drained to the end: the executor blocks until each result
+			// is taken and only then notices the cancellation
+			for result := range graphql.ExecuteSubscription(params) {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := c.writePayload(msg.ID, msgNext, result); err != nil {
+					cancel()
+				}
+			}
+		}
+
+		// a complete from the client has already removed the subscription
+		if c.finish(msg.ID) {
+			_ = c.write(message{ID: msg.ID, Type: msgComplete})
+		}
+	}()
+
+	return true
+}
+
+// finish forgets the operation and reports whether it was still running.
+func (c *connection) finish(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancel, ok := c.subs[id]
+	if ok {
+		cancel()
+		delete(c.subs, id)
+	}
+
+	return ok
+}
+
+func (c *connection) writePayload(id, typ string, payload interface{}) error {
+	if result, ok := payload.(*graphql.Result); ok {
+		result.Errors = withCodes(result.Errors)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return c.write(message{ID: id, Type: typ, Payload: data})
+}
+
+func (c *connection) write(msg message) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	return c.ws.WriteJSON(msg)
+}
+
+func closeWith(ws *websocket.Conn, code int, reason string) {
+	_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
@@ -0,0 +1,101 @@
+package mfaHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/lib/render"
+	"testovoe/internal/services/mfaService"
+)
+
+type MFAService interface {
+	Enroll(ctx context.Context, username string) (mfaService.Enrollment, error)
+	Confirm(ctx context.Context, username, code string) ([]string, error)
+	Disable(ctx context.Context, username, code string) error
+}
+
+type MFAHandlers struct {
+	service MFAService
+}
+
+func NewMFAHandlers(service *mfaService.MFAService) *MFAHandlers {
+	return &MFAHandlers{
+		service: service,
+	}
+}
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Enroll starts TOTP enrollment. The response has the secret, the
+// otpauth:// URI and a base64 PNG QR code of it.
+func (h *MFAHandlers) Enroll(w http.ResponseWriter, r *http.Request) {
+	username, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return
+	}
+
+	enrollment, err := h.service.Enroll(r.Context(), username)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, enrollment)
+}
+
+func (h *MFAHandlers) Confirm(w http.ResponseWriter, r *http.Request) {
+	var req codeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	username, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return
+	}
+
+	codes, err := h.service.Confirm(r.Context(), username, req.Code)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *MFAHandlers) Disable(w http.ResponseWriter, r *http.Request) {
+	var req codeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	username, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return
+	}
+
+	err = h.service.Disable(r.Context(), username, req.Code)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package notesGRPC
+
+import (
+	"context"
+	"github.com/google/uuid"
+	notesv1 "testovoe/api/notes/v1"
+	"testovoe/internal/lib/apperr"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/models"
+	"testovoe/internal/services/notesService"
+)
+
+var (
+	errEmptyContent = apperr.Validation("empty_content", "content is required")
+	errInvalidID    = apperr.Validation("invalid_id", "id must be a UUID")
+)
+
+// Scopes is the scope a token needs for each method of the service.
+var Scopes = map[string]string{
+	notesv1.NotesService_CreateNote_FullMethodName:  oa.ScopeNotesWrite,
+	notesv1.NotesService_GetNote_FullMethodName:     oa.ScopeNotesRead,
+	notesv1.NotesService_ListNotes_FullMethodName:   oa.ScopeNotesRead,
+	notesv1.NotesService_UpdateNote_FullMethodName:  oa.ScopeNotesWrite,
+	notesv1.NotesService_DeleteNote_FullMethodName:  oa.ScopeNotesWrite,
+	notesv1.NotesService_SearchNotes_FullMethodName: oa.ScopeNotesRead,
+}
+
+type NotesService interface {
+	AddNote(ctx context.Context, content, owner string) (string, error)
+	GetNotes(ctx context.Context, owner string) ([]models.Note, error)
+	GetNote(ctx context.Context, noteId, owner string) (models.Note, error)
+	UpdateNote(ctx context.Context, noteId, content, owner string) error
+	DeleteNote(ctx context.Context, noteId, owner string) error
+	SearchNotes(ctx context.Context, owner, query string, limit int) ([]models.Note, error)
+}
+
+// NotesServer serves notes.v1.NotesService on top of the same service as
+// the HTTP handlers. It returns domain errors as they are; the server
+// interceptors turn them into statuses.
+type NotesServer struct {
+	notesv1.UnimplementedNotesServiceServer
+	service NotesService
+}
+
+func NewNotesServer(service *notesService.NotesService) *NotesServer {
+	return &NotesServer{
+		service: service,
+	}
+}
+
+func (s *NotesServer) CreateNote(ctx context.Context, req *notesv1.CreateNoteRequest) (*notesv1.Note, error) {
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, problem.ErrUnauthorized
+	}
+
+	if req.GetContent() == "" {
+		return nil, errEmptyContent
+	}
+
+	noteID, err := s.service.AddNote(ctx, req.GetContent(), owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notesv1.Note{Id: noteID, Content: req.GetContent(), Owner: owner}, nil
+}
+
+func (s *NotesServer) GetNote(ctx context.Context, req *notesv1.GetNoteRequest) (*notesv1.Note, error) {
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, problem.ErrUnauthorized
+	}
+
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	note, err := s.service.GetNote(ctx, req.GetId(), owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return toProto(note), nil
+}
+
+func (s *NotesServer) ListNotes(ctx context.Context, req *notesv1.ListNotesRequest) (*notesv1.ListNotesResponse, error) {
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, problem.ErrUnauthorized
+	}
+
+	notes, err := s.service.GetNotes(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notesv1.ListNotesResponse{Notes: toProtoList(notes)}, nil
+}
+
+func (s *NotesServer) UpdateNote(ctx context.Context, req *notesv1.UpdateNoteRequest) (*notesv1.Note, error) {
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, problem.ErrUnauthorized
+	}
+
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	if req.GetContent() == "" {
+		return nil, errEmptyContent
+	}
+
+	if err := s.service.UpdateNote(ctx, req.GetId(), req.GetContent(), owner); err != nil {
+		return nil, err
+	}
+
+	return &notesv1.Note{Id: req.GetId(), Content: req.GetContent(), Owner: owner}, nil
+}
+
+func (s *NotesServer) DeleteNote(ctx context.Context, req *notesv1.DeleteNoteRequest) (*notesv1.DeleteNoteResponse, error) {
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, problem.ErrUnauthorized
+	}
+
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.service.DeleteNote(ctx, req.GetId(), owner); err != nil {
+		return nil, err
+	}
+
+	return &notesv1.DeleteNoteResponse{}, nil
+}
+
+func (s *NotesServer) SearchNotes(ctx context.Context, req *notesv1.SearchNotesRequest) (*notesv1.SearchNotesResponse, error) {
+	owner, ok := oa.Credential(ctx)
+	if !ok {
+		return nil, problem.ErrUnauthorized
+	}
+
+	notes, err := s.service.SearchNotes(ctx, owner, req.GetQuery(), int(req.GetLimit()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &notesv1.SearchNotesResponse{Notes: toProtoList(notes)}, nil
+}
+
+// validateID rejects malformed IDs before they reach the database, which
+// would fail on them with an internal error.
+func validateID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return errInvalidID
+	}
+
+	return nil
+}
+
+func toProto(note models.Note) *notesv1.Note {
+	return &notesv1.Note{
+		Id:      note.ID,
+		Content: note.Content,
+		Owner:   note.Owner,
+	}
+}
+
+func toProtoList(notes []models.Note) []*notesv1.Note {
+	out := make([]*notesv1.Note, 0, len(notes))
+	for _, note := range notes {
+		out = append(out, toProto(note))
+	}
+
+	return out
+}
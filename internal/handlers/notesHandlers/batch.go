@@ -0,0 +1,59 @@
+package notesHandlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/models"
+)
+
+const maxBatchOperations = 100
+
+var errBatchSize = apperr.Validation("invalid_batch_size", "batch must contain between 1 and 100 operations")
+
+type batchRequest struct {
+	Atomic     bool                    `json:"atomic"`
+	Operations []models.BatchOperation `json:"operations"`
+}
+
+type batchResponse struct {
+	Committed bool                 `json:"committed"`
+	Results   []models.BatchResult `json:"results"`
+}
+
+func (h *NotesHandlers) Batch(w http.ResponseWriter, r *http.Request) {
+	var batchReq batchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&batchReq)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	if len(batchReq.Operations) == 0 || len(batchReq.Operations) > maxBatchOperations {
+		problem.Error(w, r, errBatchSize)
+		return
+	}
+
+	results, committed, err := h.service.Batch(r.Context(), batchReq.Operations, username, batchReq.Atomic)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(batchResponse{
+		Committed: committed,
+		Results:   results,
+	})
+	if err != nil {
+		return
+	}
+}
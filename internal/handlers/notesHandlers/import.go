@@ -0,0 +1,113 @@
+package notesHandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/models"
+	"testovoe/internal/services/importService"
+)
+
+const maxImportSize = 32 << 20
+
+var (
+	errInvalidSpellcheck = apperr.Validation("invalid_spellcheck", "invalid spellcheck flag")
+	errUnreadableImport  = apperr.Validation("unreadable_import", "failed to read import")
+)
+
+type ImportService interface {
+	StartImport(ctx context.Context, owner, format string, data []byte, checkSpelling bool) (models.ImportJob, error)
+	GetImportJob(ctx context.Context, jobId, owner string) (models.ImportJob, error)
+}
+
+func (h *NotesHandlers) ImportNotes(w http.ResponseWriter, r *http.Request) {
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatFromContentType(r.Header.Get("Content-Type"))
+	}
+
+	checkSpelling := true
+	if v := r.URL.Query().Get("spellcheck"); v != "" {
+		var err error
+		checkSpelling, err = strconv.ParseBool(v)
+		if err != nil {
+			problem.Error(w, r, errInvalidSpellcheck)
+			return
+		}
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(w, r, http.StatusRequestEntityTooLarge, "import_too_large", "import is too large")
+			return
+		}
+
+		problem.Error(w, r, errUnreadableImport)
+		return
+	}
+
+	job, err := h.importer.StartImport(r.Context(), username, format, data, checkSpelling)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// relative to the route the job was started through, legacy or versioned
+	w.Header().Set("Location", path.Join(r.URL.Path, job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(job)
+	if err != nil {
+		return
+	}
+}
+
+func (h *NotesHandlers) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.importer.GetImportJob(r.Context(), chi.URLParam(r, "id"), username)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(job)
+	if err != nil {
+		return
+	}
+}
+
+func formatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/zip", "application/x-zip-compressed":
+		return importService.FormatZip
+	case "application/json":
+		return importService.FormatJSON
+	case "application/xml", "text/xml", "application/enex+xml":
+		return importService.FormatENEX
+	}
+
+	return ""
+}
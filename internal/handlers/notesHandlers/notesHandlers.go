@@ -3,24 +3,42 @@ package notesHandlers
 import (
 	"context"
 	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"io"
 	"net/http"
-	"strings"
+	"testovoe/internal/lib/apperr"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
 	"testovoe/internal/models"
+	"testovoe/internal/services/importService"
 	"testovoe/internal/services/notesService"
+	"time"
 )
 
+var errUnsupportedRender = apperr.Validation("unsupported_format", "unsupported format")
+
 type NotesService interface {
 	AddNote(ctx context.Context, content, owner string) (string, error)
 	GetNotes(ctx context.Context, owner string) ([]models.Note, error)
+	GetNote(ctx context.Context, noteId, owner string) (models.Note, error)
+	UpdateNote(ctx context.Context, noteId, content, owner string) error
+	DeleteNote(ctx context.Context, noteId, owner string) error
+	RenderNote(ctx context.Context, noteId, owner string) (string, error)
+	ExportNotes(ctx context.Context, owner string, w io.Writer) error
+	Batch(ctx context.Context, ops []models.BatchOperation, owner string, atomic bool) ([]models.BatchResult, bool, error)
+	GetChanges(ctx context.Context, owner, token string, limit int) (models.ChangeSet, error)
+	PushChanges(ctx context.Context, changes []models.PushChange, owner string) []models.PushResult
 }
 
 type NotesHandlers struct {
-	service NotesService
+	service  NotesService
+	importer ImportService
 }
 
-func NewNotesHandlers(service *notesService.NotesService) *NotesHandlers {
+func NewNotesHandlers(service *notesService.NotesService, importer *importService.ImportService) *NotesHandlers {
 	return &NotesHandlers{
-		service: service,
+		service:  service,
+		importer: importer,
 	}
 }
 
@@ -29,27 +47,18 @@ func (h *NotesHandlers) AddNote(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&noteReq)
 	if err != nil {
-		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
-		return
-	}
-
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		problem.Error(w, r, problem.ErrInvalidJSON)
 		return
 	}
 
-	token := strings.TrimPrefix(authHeader, "Bearer ")
-
-	username, err := ValidateToken(token)
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	username, ok := authorize(w, r)
+	if !ok {
 		return
 	}
 
 	noteID, err := h.service.AddNote(r.Context(), noteReq.Content, username)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
@@ -63,40 +72,177 @@ func (h *NotesHandlers) AddNote(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(noteResp)
 	if err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
 	}
 }
 
 func (h *NotesHandlers) GetNotes(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+	username, ok := authorize(w, r)
+	if !ok {
 		return
 	}
 
-	token := strings.TrimPrefix(authHeader, "Bearer ")
+	notes, err := h.service.GetNotes(r.Context(), username)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
 
-	username, err := ValidateToken(token)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(notes)
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+}
 
-	notes, err := h.service.GetNotes(r.Context(), username)
+func (h *NotesHandlers) GetNote(w http.ResponseWriter, r *http.Request) {
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
 
+	note, err := h.service.GetNote(r.Context(), chi.URLParam(r, "id"), username)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Error(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(notes)
+	err = json.NewEncoder(w).Encode(note)
 	if err != nil {
 		return
 	}
 }
 
-func ValidateToken(token string) (string, error) {
-	return "user1", nil
+func (h *NotesHandlers) UpdateNote(w http.ResponseWriter, r *http.Request) {
+	var noteReq models.Note
+
+	err := json.NewDecoder(r.Body).Decode(&noteReq)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	noteID := chi.URLParam(r, "id")
+
+	err = h.service.UpdateNote(r.Context(), noteID, noteReq.Content, username)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	noteResp := models.Note{
+		ID:      noteID,
+		Content: noteReq.Content,
+		Owner:   username,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(noteResp)
+	if err != nil {
+		return
+	}
+}
+
+func (h *NotesHandlers) DeleteNote(w http.ResponseWriter, r *http.Request) {
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.DeleteNote(r.Context(), chi.URLParam(r, "id"), username)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *NotesHandlers) RenderNote(w http.ResponseWriter, r *http.Request) {
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+
+	if format != "html" {
+		problem.Error(w, r, errUnsupportedRender)
+		return
+	}
+
+	html, err := h.service.RenderNote(r.Context(), chi.URLParam(r, "id"), username)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(html))
+}
+
+func (h *NotesHandlers) ExportNotes(w http.ResponseWriter, r *http.Request) {
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="notes.zip"`)
+
+	cw := &countingWriter{w: w, rc: http.NewResponseController(w)}
+
+	err := h.service.ExportNotes(r.Context(), username, cw)
+	if err != nil && cw.n == 0 {
+		w.Header().Del("Content-Disposition")
+		problem.Error(w, r, err)
+	}
+	// once the archive has started streaming a failure can only be
+	// reported by cutting the response short
+}
+
+// exportWriteTimeout bounds every write of the archive rather than the
+// whole response, which the server-wide WriteTimeout would cut off on
+// large accounts.
+const exportWriteTimeout = 30 * time.Second
+
+type countingWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+	n  int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	// not every ResponseWriter supports deadlines, the recorder in tests doesn't
+	_ = c.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// authorize resolves the note owner from the credential the auth
+// middleware verified, writing 401 and returning false when there is none.
+func authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	credential, ok := oa.Credential(r.Context())
+	if !ok {
+		problem.Error(w, r, problem.ErrUnauthorized)
+		return "", false
+	}
+
+	return credential, true
 }
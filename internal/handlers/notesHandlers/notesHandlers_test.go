@@ -5,18 +5,32 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
 	"github.com/google/uuid"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"testovoe/internal/models"
+	"testovoe/internal/services/importService"
+	"testovoe/internal/services/notesService"
+	"time"
 )
 
 // MockNotesService - простой мок для NotesService
 type MockNotesService struct {
-	addNoteFunc  func(ctx context.Context, content, owner string) (string, error)
-	getNotesFunc func(ctx context.Context, owner string) ([]models.Note, error)
+	addNoteFunc    func(ctx context.Context, content, owner string) (string, error)
+	getNotesFunc   func(ctx context.Context, owner string) ([]models.Note, error)
+	getNoteFunc    func(ctx context.Context, noteId, owner string) (models.Note, error)
+	updateNoteFunc func(ctx context.Context, noteId, content, owner string) error
+	deleteNoteFunc func(ctx context.Context, noteId, owner string) error
+	renderNoteFunc func(ctx context.Context, noteId, owner string) (string, error)
+	exportFunc     func(ctx context.Context, owner string, w io.Writer) error
+	batchFunc      func(ctx context.Context, ops []models.BatchOperation, owner string, atomic bool) ([]models.BatchResult, bool, error)
+	getChangesFunc func(ctx context.Context, owner, token string, limit int) (models.ChangeSet, error)
+	pushFunc       func(ctx context.Context, changes []models.PushChange, owner string) []models.PushResult
 }
 
 func (m *MockNotesService) AddNote(ctx context.Context, content, owner string) (string, error) {
@@ -27,15 +41,81 @@ func (m *MockNotesService) GetNotes(ctx context.Context, owner string) ([]models
 	return m.getNotesFunc(ctx, owner)
 }
 
+func (m *MockNotesService) GetNote(ctx context.Context, noteId, owner string) (models.Note, error) {
+	return m.getNoteFunc(ctx, noteId, owner)
+}
+
+func (m *MockNotesService) UpdateNote(ctx context.Context, noteId, content, owner string) error {
+	return m.updateNoteFunc(ctx, noteId, content, owner)
+}
+
+func (m *MockNotesService) DeleteNote(ctx context.Context, noteId, owner string) error {
+	return m.deleteNoteFunc(ctx, noteId, owner)
+}
+
+func (m *MockNotesService) RenderNote(ctx context.Context, noteId, owner string) (string, error) {
+	return m.renderNoteFunc(ctx, noteId, owner)
+}
+
+func (m *MockNotesService) ExportNotes(ctx context.Context, owner string, w io.Writer) error {
+	return m.exportFunc(ctx, owner, w)
+}
+
+func (m *MockNotesService) Batch(ctx context.Context, ops []models.BatchOperation, owner string, atomic bool) ([]models.BatchResult, bool, error) {
+	return m.batchFunc(ctx, ops, owner, atomic)
+}
+
+func (m *MockNotesService) GetChanges(ctx context.Context, owner, token string, limit int) (models.ChangeSet, error) {
+	return m.getChangesFunc(ctx, owner, token, limit)
+}
+
+func (m *MockNotesService) PushChanges(ctx context.Context, changes []models.PushChange, owner string) []models.PushResult {
+	return m.pushFunc(ctx, changes, owner)
+}
+
+// MockImportService - мок для ImportService
+type MockImportService struct {
+	startImportFunc  func(ctx context.Context, owner, format string, data []byte, checkSpelling bool) (models.ImportJob, error)
+	getImportJobFunc func(ctx context.Context, jobId, owner string) (models.ImportJob, error)
+}
+
+func (m *MockImportService) StartImport(ctx context.Context, owner, format string, data []byte, checkSpelling bool) (models.ImportJob, error) {
+	return m.startImportFunc(ctx, owner, format, data, checkSpelling)
+}
+
+func (m *MockImportService) GetImportJob(ctx context.Context, jobId, owner string) (models.ImportJob, error) {
+	return m.getImportJobFunc(ctx, jobId, owner)
+}
+
+// authenticated выставляет заголовок и, как auth middleware, кладёт в
+// контекст владельца известного токена
+func authenticated(r *http.Request, authHeader string) *http.Request {
+	if authHeader != "" {
+		r.Header.Set("Authorization", authHeader)
+	}
+	if authHeader != "Bearer valid-token" {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), oauth.CredentialContext, "user1"))
+}
+
+// withURLParam подставляет параметр маршрута chi в запрос
+func withURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
 func TestNotesHandlers_AddNote(t *testing.T) {
 	tests := []struct {
-		name          string
-		service       NotesService
-		requestBody   string
-		expectedCode  int
-		expectedBody  models.Note
-		authHeader    string
-		validateToken func(string) (string, error)
+		name         string
+		service      NotesService
+		requestBody  string
+		expectedCode int
+		expectedBody models.Note
+		authHeader   string
 	}{
 		{
 			name: "Valid Request",
@@ -48,9 +128,6 @@ func TestNotesHandlers_AddNote(t *testing.T) {
 			expectedCode: http.StatusCreated,
 			expectedBody: models.Note{Content: "Test note", Owner: "user1"},
 			authHeader:   "Bearer valid-token",
-			validateToken: func(token string) (string, error) {
-				return "user1", nil
-			},
 		},
 		{
 			name:         "Invalid JSON",
@@ -59,9 +136,6 @@ func TestNotesHandlers_AddNote(t *testing.T) {
 			expectedCode: http.StatusBadRequest,
 			expectedBody: models.Note{},
 			authHeader:   "Bearer valid-token",
-			validateToken: func(token string) (string, error) {
-				return "user1", nil
-			},
 		},
 		{
 			name:         "Missing Authorization",
@@ -70,15 +144,12 @@ func TestNotesHandlers_AddNote(t *testing.T) {
 			expectedCode: http.StatusUnauthorized,
 			expectedBody: models.Note{},
 			authHeader:   "",
-			validateToken: func(token string) (string, error) {
-				return "", errors.New("invalid token")
-			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest("POST", "/add-note", bytes.NewBuffer([]byte(tt.requestBody)))
-			req.Header.Set("Authorization", tt.authHeader)
+			req = authenticated(req, tt.authHeader)
 			w := httptest.NewRecorder()
 
 			h := &NotesHandlers{service: tt.service}
@@ -113,12 +184,11 @@ func TestNotesHandlers_AddNote(t *testing.T) {
 
 func TestNotesHandlers_GetNotes(t *testing.T) {
 	tests := []struct {
-		name          string
-		service       NotesService
-		expectedCode  int
-		expectedBody  []models.Note
-		authHeader    string
-		validateToken func(string) (string, error)
+		name         string
+		service      NotesService
+		expectedCode int
+		expectedBody []models.Note
+		authHeader   string
 	}{
 		{
 			name: "Valid Request",
@@ -134,9 +204,6 @@ func TestNotesHandlers_GetNotes(t *testing.T) {
 				{Content: "Test note", Owner: "user1"},
 			},
 			authHeader: "Bearer valid-token",
-			validateToken: func(token string) (string, error) {
-				return "user1", nil
-			},
 		},
 		{
 			name:         "Missing Authorization",
@@ -144,16 +211,13 @@ func TestNotesHandlers_GetNotes(t *testing.T) {
 			expectedCode: http.StatusUnauthorized,
 			expectedBody: []models.Note{}, // Пустое тело
 			authHeader:   "",
-			validateToken: func(token string) (string, error) {
-				return "", errors.New("invalid token")
-			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest("GET", "/get-notes", nil)
-			req.Header.Set("Authorization", tt.authHeader)
+			req = authenticated(req, tt.authHeader)
 			w := httptest.NewRecorder()
 
 			h := &NotesHandlers{service: tt.service}
@@ -194,30 +258,593 @@ func TestNotesHandlers_GetNotes(t *testing.T) {
 	}
 }
 
-func Test_validateToken(t *testing.T) {
+func Test_authorize(t *testing.T) {
+	tests := []struct {
+		name         string
+		authHeader   string
+		wantOwner    string
+		expectedCode int
+	}{
+		{
+			name:         "Verified By Middleware",
+			authHeader:   "Bearer valid-token",
+			wantOwner:    "user1",
+			expectedCode: http.StatusOK,
+		},
+		{
+			// без проверки middleware заголовок ничего не значит
+			name:         "Unverified Bearer Token",
+			authHeader:   "Bearer forged-token",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Missing Authorization",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authenticated(httptest.NewRequest("GET", "/notes", nil), tt.authHeader)
+			w := httptest.NewRecorder()
+
+			owner, ok := authorize(w, req)
+			if owner != tt.wantOwner || ok != (tt.wantOwner != "") {
+				t.Errorf("authorize() = %q, %v, want %q", owner, ok, tt.wantOwner)
+			}
+			if w.Code != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", w.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestNotesHandlers_UpdateNote(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      NotesService
+		body         string
+		expectedCode int
+		authHeader   string
+	}{
+		{
+			name: "Valid Request",
+			service: &MockNotesService{
+				updateNoteFunc: func(ctx context.Context, noteId, content, owner string) error {
+					return nil
+				},
+			},
+			body:         `{"content": "updated"}`,
+			expectedCode: http.StatusOK,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Invalid JSON",
+			service:      &MockNotesService{},
+			body:         `{"content":`,
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name: "Note Not Found",
+			service: &MockNotesService{
+				updateNoteFunc: func(ctx context.Context, noteId, content, owner string) error {
+					return fmt.Errorf("notesService.UpdateNote: %w", notesService.ErrNoteNotFound)
+				},
+			},
+			body:         `{"content": "updated"}`,
+			expectedCode: http.StatusNotFound,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Missing Authorization",
+			service:      &MockNotesService{},
+			body:         `{"content": "updated"}`,
+			expectedCode: http.StatusUnauthorized,
+			authHeader:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", bytes.NewBufferString(tt.body))
+			req = withURLParam(req, "id", "123e4567-e89b-12d3-a456-426614174000")
+			req = authenticated(req, tt.authHeader)
+			w := httptest.NewRecorder()
+
+			h := &NotesHandlers{service: tt.service}
+			h.UpdateNote(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", resp.StatusCode, tt.expectedCode)
+			}
+
+			if resp.StatusCode == http.StatusOK {
+				var note models.Note
+				if err := json.NewDecoder(resp.Body).Decode(&note); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if note.ID != "123e4567-e89b-12d3-a456-426614174000" || note.Content != "updated" {
+					t.Errorf("note = %+v", note)
+				}
+			}
+		})
+	}
+}
+
+func TestNotesHandlers_DeleteNote(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      NotesService
+		expectedCode int
+		authHeader   string
+	}{
+		{
+			name: "Valid Request",
+			service: &MockNotesService{
+				deleteNoteFunc: func(ctx context.Context, noteId, owner string) error {
+					return nil
+				},
+			},
+			expectedCode: http.StatusNoContent,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name: "Note Not Found",
+			service: &MockNotesService{
+				deleteNoteFunc: func(ctx context.Context, noteId, owner string) error {
+					return fmt.Errorf("notesService.DeleteNote: %w", notesService.ErrNoteNotFound)
+				},
+			},
+			expectedCode: http.StatusNotFound,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Missing Authorization",
+			service:      &MockNotesService{},
+			expectedCode: http.StatusUnauthorized,
+			authHeader:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000", nil)
+			req = withURLParam(req, "id", "123e4567-e89b-12d3-a456-426614174000")
+			req = authenticated(req, tt.authHeader)
+			w := httptest.NewRecorder()
+
+			h := &NotesHandlers{service: tt.service}
+			h.DeleteNote(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", resp.StatusCode, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestNotesHandlers_RenderNote(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      NotesService
+		query        string
+		expectedCode int
+		expectedBody string
+		authHeader   string
+	}{
+		{
+			name: "Valid Request",
+			service: &MockNotesService{
+				renderNoteFunc: func(ctx context.Context, noteId, owner string) (string, error) {
+					return "<h1>Title</h1>\n", nil
+				},
+			},
+			query:        "?format=html",
+			expectedCode: http.StatusOK,
+			expectedBody: "<h1>Title</h1>\n",
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Unsupported Format",
+			service:      &MockNotesService{},
+			query:        "?format=pdf",
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name: "Note Not Found",
+			service: &MockNotesService{
+				renderNoteFunc: func(ctx context.Context, noteId, owner string) (string, error) {
+					return "", fmt.Errorf("notesService.RenderNote: %w", notesService.ErrNoteNotFound)
+				},
+			},
+			expectedCode: http.StatusNotFound,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Missing Authorization",
+			service:      &MockNotesService{},
+			expectedCode: http.StatusUnauthorized,
+			authHeader:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/notes/123e4567-e89b-12d3-a456-426614174000/render"+tt.query, nil)
+			req = withURLParam(req, "id", "123e4567-e89b-12d3-a456-426614174000")
+			req = authenticated(req, tt.authHeader)
+			w := httptest.NewRecorder()
+
+			h := &NotesHandlers{service: tt.service}
+			h.RenderNote(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", resp.StatusCode, tt.expectedCode)
+			}
+
+			if resp.StatusCode == http.StatusOK && string(body) != tt.expectedBody {
+				t.Errorf("body = %q, want %q", body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNotesHandlers_ExportNotes(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      NotesService
+		expectedCode int
+		expectedType string
+		authHeader   string
+	}{
+		{
+			name: "Valid Request",
+			service: &MockNotesService{
+				exportFunc: func(ctx context.Context, owner string, w io.Writer) error {
+					_, err := w.Write([]byte("PK"))
+					return err
+				},
+			},
+			expectedCode: http.StatusOK,
+			expectedType: "application/zip",
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name: "Failure Before Streaming",
+			service: &MockNotesService{
+				exportFunc: func(ctx context.Context, owner string, w io.Writer) error {
+					return errors.New("connection refused")
+				},
+			},
+			expectedCode: http.StatusInternalServerError,
+			expectedType: "application/problem+json",
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Missing Authorization",
+			service:      &MockNotesService{},
+			expectedCode: http.StatusUnauthorized,
+			expectedType: "application/problem+json",
+			authHeader:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/notes/export", nil)
+			req = authenticated(req, tt.authHeader)
+			w := httptest.NewRecorder()
+
+			h := &NotesHandlers{service: tt.service}
+			h.ExportNotes(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", resp.StatusCode, tt.expectedCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != tt.expectedType {
+				t.Errorf("content type = %v, want %v", ct, tt.expectedType)
+			}
+		})
+	}
+}
+
+func TestNotesHandlers_ExportNotesOutlivesWriteTimeout(t *testing.T) {
+	h := &NotesHandlers{service: &MockNotesService{
+		exportFunc: func(ctx context.Context, owner string, w io.Writer) error {
+			// архив пишется дольше, чем WriteTimeout сервера
+			for i := 0; i < 5; i++ {
+				time.Sleep(50 * time.Millisecond)
+				if _, err := w.Write([]byte("PK")); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ExportNotes(w, r.WithContext(context.WithValue(r.Context(), oauth.CredentialContext, "user1")))
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the archive: %v", err)
+	}
+	if string(body) != "PKPKPKPKPK" {
+		t.Errorf("body = %q, want the whole archive", body)
+	}
+}
+
+func TestNotesHandlers_ImportNotes(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		contentType   string
+		expectedCode  int
+		expectedSpell bool
+		authHeader    string
+	}{
+		{
+			name:          "Format From Content Type",
+			contentType:   "application/json",
+			expectedCode:  http.StatusAccepted,
+			expectedSpell: true,
+			authHeader:    "Bearer valid-token",
+		},
+		{
+			name:          "Skip Spellcheck",
+			query:         "?format=enex&spellcheck=false",
+			expectedCode:  http.StatusAccepted,
+			expectedSpell: false,
+			authHeader:    "Bearer valid-token",
+		},
+		{
+			name:         "Invalid Spellcheck Flag",
+			query:        "?format=zip&spellcheck=maybe",
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Unsupported Format",
+			query:        "?format=docx",
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Missing Authorization",
+			query:        "?format=json",
+			expectedCode: http.StatusUnauthorized,
+			authHeader:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSpell bool
+			importer := &MockImportService{
+				startImportFunc: func(ctx context.Context, owner, format string, data []byte, checkSpelling bool) (models.ImportJob, error) {
+					gotSpell = checkSpelling
+					if format == "docx" {
+						return models.ImportJob{}, fmt.Errorf("importService.StartImport: %w", importService.ErrUnsupportedFormat)
+					}
+					return models.ImportJob{ID: "123e4567-e89b-12d3-a456-426614174000", Format: format, Status: models.ImportStatusPending}, nil
+				},
+			}
+
+			req := httptest.NewRequest("POST", "/notes/import"+tt.query, bytes.NewBufferString(`[]`))
+			req = authenticated(req, tt.authHeader)
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			h := &NotesHandlers{importer: importer}
+			h.ImportNotes(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", resp.StatusCode, tt.expectedCode)
+			}
+
+			if resp.StatusCode == http.StatusAccepted {
+				if loc := resp.Header.Get("Location"); loc != "/notes/import/123e4567-e89b-12d3-a456-426614174000" {
+					t.Errorf("location = %v", loc)
+				}
+				if gotSpell != tt.expectedSpell {
+					t.Errorf("checkSpelling = %v, want %v", gotSpell, tt.expectedSpell)
+				}
+			}
+		})
+	}
+}
+
+func TestNotesHandlers_Batch(t *testing.T) {
 	tests := []struct {
-		name    string
-		token   string
-		want    string
-		wantErr bool
+		name         string
+		service      NotesService
+		requestBody  string
+		expectedCode int
+		committed    bool
+		authHeader   string
 	}{
 		{
-			name:    "Valid token",
-			token:   "valid-token",
-			want:    "user1",
-			wantErr: false,
+			name: "Valid Request",
+			service: &MockNotesService{
+				batchFunc: func(ctx context.Context, ops []models.BatchOperation, owner string, atomic bool) ([]models.BatchResult, bool, error) {
+					if !atomic || len(ops) != 2 {
+						return nil, false, errors.New("unexpected arguments")
+					}
+					return []models.BatchResult{
+						{Index: 0, Op: models.BatchOpCreate, ID: "123e4567-e89b-12d3-a456-426614174000", Status: models.BatchStatusOK},
+						{Index: 1, Op: models.BatchOpDelete, ID: "123e4567-e89b-12d3-a456-426614174001", Status: models.BatchStatusOK},
+					}, true, nil
+				},
+			},
+			requestBody:  `{"atomic":true,"operations":[{"op":"create","content":"Test note"},{"op":"delete","id":"123e4567-e89b-12d3-a456-426614174001"}]}`,
+			expectedCode: http.StatusOK,
+			committed:    true,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Empty Batch",
+			service:      &MockNotesService{},
+			requestBody:  `{"operations":[]}`,
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Invalid JSON",
+			service:      &MockNotesService{},
+			requestBody:  `{"operations":`,
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Missing Authorization",
+			service:      &MockNotesService{},
+			requestBody:  `{"operations":[{"op":"create","content":"Test note"}]}`,
+			expectedCode: http.StatusUnauthorized,
+			authHeader:   "",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ValidateToken(tt.token)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("validateToken() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			req := httptest.NewRequest("POST", "/notes/batch", bytes.NewBufferString(tt.requestBody))
+			req = authenticated(req, tt.authHeader)
+			w := httptest.NewRecorder()
+
+			h := &NotesHandlers{service: tt.service}
+			h.Batch(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", resp.StatusCode, tt.expectedCode)
 			}
-			if got != tt.want {
-				t.Errorf("validateToken() got = %v, want %v", got, tt.want)
+
+			if resp.StatusCode == http.StatusOK {
+				var responseBody batchResponse
+				if err := json.Unmarshal(body, &responseBody); err != nil {
+					t.Errorf("Failed to unmarshal response body: %v", err)
+					return
+				}
+
+				if responseBody.Committed != tt.committed || len(responseBody.Results) != 2 {
+					t.Errorf("body = %+v", responseBody)
+				}
+			}
+		})
+	}
+}
+
+func TestNotesHandlers_GetChanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      NotesService
+		query        string
+		expectedCode int
+		authHeader   string
+	}{
+		{
+			name: "Valid Request",
+			service: &MockNotesService{
+				getChangesFunc: func(ctx context.Context, owner, token string, limit int) (models.ChangeSet, error) {
+					if token != "djE6Mw" || limit != 50 {
+						return models.ChangeSet{}, errors.New("unexpected arguments")
+					}
+					return models.ChangeSet{
+						Changes:   []models.NoteChange{{ID: "123e4567-e89b-12d3-a456-426614174000", Version: 2, Deleted: true}},
+						NextToken: "djE6NA",
+					}, nil
+				},
+			},
+			query:        "?token=djE6Mw&limit=50",
+			expectedCode: http.StatusOK,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name: "Invalid Token",
+			service: &MockNotesService{
+				getChangesFunc: func(ctx context.Context, owner, token string, limit int) (models.ChangeSet, error) {
+					return models.ChangeSet{}, fmt.Errorf("notesService.GetChanges: %w", notesService.ErrInvalidSyncToken)
+				},
+			},
+			query:        "?token=garbage",
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Invalid Limit",
+			service:      &MockNotesService{},
+			query:        "?limit=many",
+			expectedCode: http.StatusBadRequest,
+			authHeader:   "Bearer valid-token",
+		},
+		{
+			name:         "Missing Authorization",
+			service:      &MockNotesService{},
+			expectedCode: http.StatusUnauthorized,
+			authHeader:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/notes/sync"+tt.query, nil)
+			req = authenticated(req, tt.authHeader)
+			w := httptest.NewRecorder()
+
+			h := &NotesHandlers{service: tt.service}
+			h.GetChanges(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("status code = %v, want %v", resp.StatusCode, tt.expectedCode)
+			}
+
+			if resp.StatusCode == http.StatusOK {
+				var responseBody models.ChangeSet
+				if err := json.Unmarshal(body, &responseBody); err != nil {
+					t.Errorf("Failed to unmarshal response body: %v", err)
+					return
+				}
+
+				if responseBody.NextToken != "djE6NA" || len(responseBody.Changes) != 1 || !responseBody.Changes[0].Deleted {
+					t.Errorf("body = %+v", responseBody)
+				}
 			}
 		})
 	}
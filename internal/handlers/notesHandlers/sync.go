@@ -0,0 +1,84 @@
+package notesHandlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/problem"
+	"testovoe/internal/models"
+)
+
+const maxPushChanges = 100
+
+var (
+	errInvalidLimit = apperr.Validation("invalid_limit", "invalid limit")
+	errPushSize     = apperr.Validation("invalid_push_size", "push must contain between 1 and 100 changes")
+)
+
+type pushRequest struct {
+	Changes []models.PushChange `json:"changes"`
+}
+
+type pushResponse struct {
+	Results []models.PushResult `json:"results"`
+}
+
+func (h *NotesHandlers) GetChanges(w http.ResponseWriter, r *http.Request) {
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			problem.Error(w, r, errInvalidLimit)
+			return
+		}
+	}
+
+	changes, err := h.service.GetChanges(r.Context(), username, r.URL.Query().Get("token"), limit)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(changes)
+	if err != nil {
+		return
+	}
+}
+
+func (h *NotesHandlers) PushChanges(w http.ResponseWriter, r *http.Request) {
+	var pushReq pushRequest
+
+	err := json.NewDecoder(r.Body).Decode(&pushReq)
+	if err != nil {
+		problem.Error(w, r, problem.ErrInvalidJSON)
+		return
+	}
+
+	username, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	if len(pushReq.Changes) == 0 || len(pushReq.Changes) > maxPushChanges {
+		problem.Error(w, r, errPushSize)
+		return
+	}
+
+	results := h.service.PushChanges(r.Context(), pushReq.Changes, username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(pushResponse{Results: results})
+	if err != nil {
+		return
+	}
+}
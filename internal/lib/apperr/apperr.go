@@ -0,0 +1,100 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind says what went wrong in terms a client can act on. The HTTP layer
+// maps it to a status code.
+type Kind uint8
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUnavailable
+)
+
+// Error is a domain error that is safe to show to clients. Code is stable
+// and meant for programs, Message for people.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors by code, so a copy made by Detailf still matches the
+// sentinel it came from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+
+	return ok && t.Code == e.Code
+}
+
+// Detailf returns a copy of e with a more specific message.
+func (e *Error) Detailf(format string, args ...any) *Error {
+	c := *e
+	c.Message = fmt.Sprintf(format, args...)
+
+	return &c
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func Validation(code, message string) *Error {
+	return New(KindValidation, code, message)
+}
+
+func Unauthorized(code, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Unavailable(code, message string) *Error {
+	return New(KindUnavailable, code, message)
+}
+
+// As returns the first domain error in err's chain.
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+
+	return nil, false
+}
+
+// PublicMessage reports a domain error by its message and hides anything
+// else, which may carry driver or network details, behind a generic one.
+func PublicMessage(err error) string {
+	if e, ok := As(err); ok {
+		return e.Message
+	}
+
+	return "internal error"
+}
@@ -0,0 +1,68 @@
+package frontmatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+)
+
+const delimiter = "---"
+
+var (
+	ErrUnterminated = errors.New("front-matter is not terminated")
+)
+
+// Write emits meta as a YAML front-matter block followed by the body.
+func Write(w io.Writer, meta any, body string) error {
+	const op = "frontmatter.Write"
+
+	header, err := yaml.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(delimiter + "\n")
+	buf.Write(header)
+	buf.WriteString(delimiter + "\n\n")
+	buf.WriteString(body)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Parse splits data into front-matter, decoded into meta, and the body.
+// Documents without front-matter are returned as-is and meta is untouched.
+func Parse(data []byte, meta any) (string, error) {
+	const op = "frontmatter.Parse"
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	normalized := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	if !bytes.HasPrefix(normalized, []byte(delimiter+"\n")) {
+		return string(data), nil
+	}
+
+	rest := normalized[len(delimiter)+1:]
+
+	end := bytes.Index(rest, []byte("\n"+delimiter+"\n"))
+	if end < 0 {
+		if !bytes.HasSuffix(rest, []byte("\n"+delimiter)) {
+			return "", fmt.Errorf("%s: %w", op, ErrUnterminated)
+		}
+		end = len(rest) - len(delimiter) - 1
+	}
+
+	if err := yaml.Unmarshal(rest[:end], meta); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	body := rest[min(end+len(delimiter)+2, len(rest)):]
+
+	return string(bytes.TrimPrefix(body, []byte("\n"))), nil
+}
@@ -0,0 +1,61 @@
+package frontmatter
+
+import (
+	"bytes"
+	"testing"
+)
+
+type meta struct {
+	ID   string   `yaml:"id"`
+	Tags []string `yaml:"tags,omitempty"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	in := meta{ID: "123e4567-e89b-12d3-a456-426614174000", Tags: []string{"work"}}
+	if err := Write(&buf, in, "# Title\n\nbody\n"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var out meta
+	body, err := Parse(buf.Bytes(), &out)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if out.ID != in.ID || len(out.Tags) != 1 || out.Tags[0] != "work" {
+		t.Errorf("meta = %+v, want %+v", out, in)
+	}
+	if body != "# Title\n\nbody\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantID  string
+		want    string
+		wantErr bool
+	}{
+		{name: "No Front-Matter", data: "just text", want: "just text"},
+		{name: "CRLF", data: "---\r\nid: a\r\n---\r\nbody", wantID: "a", want: "body"},
+		{name: "Empty Body", data: "---\nid: b\n---", wantID: "b", want: ""},
+		{name: "Unterminated", data: "---\nid: c\nbody", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m meta
+			got, err := Parse([]byte(tt.data), &m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || m.ID != tt.wantID {
+				t.Errorf("Parse() = %q, %q, want %q, %q", got, m.ID, tt.want, tt.wantID)
+			}
+		})
+	}
+}
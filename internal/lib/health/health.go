@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusDegraded     = "degraded"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check probes one dependency. A failing check that is not Critical only
+// degrades readiness: the instance keeps getting traffic, since every
+// instance would fail it alike. The result of a check with CacheFor set is
+// reused for that long, so probes do not hammer a shared dependency.
+type Check struct {
+	Name     string
+	Critical bool
+	Probe    func(ctx context.Context) error
+	CacheFor time.Duration
+}
+
+type CheckResult struct {
+	Status     string
+	Error      string
+	DurationMs int64
+}
+
+// Report is the answer of the probes. Only the status and the code are
+// served; the results of the checks, which may name hosts and carry
+// driver errors, are only logged.
+type Report struct {
+	Status string                 `json:"status"`
+	Code   int                    `json:"code"`
+	Checks map[string]CheckResult `json:"-"`
+}
+
+// Checker serves the liveness and readiness probes.
+type Checker struct {
+	log      *slog.Logger
+	checks   []Check
+	cached   []cachedResult
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+type cachedResult struct {
+	mu     sync.Mutex
+	result CheckResult
+	at     time.Time
+}
+
+func New(log *slog.Logger, timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		log:     log,
+		checks:  checks,
+		cached:  make([]cachedResult, len(checks)),
+		timeout: timeout,
+	}
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending
+// requests before the server shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Live answers as long as the process serves HTTP at all.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, Report{Status: StatusOK, Code: http.StatusOK})
+}
+
+// Ready runs all checks in parallel and answers 503 when a critical one
+// fails or the instance is draining.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	if c.draining.Load() {
+		writeReport(w, Report{Status: StatusShuttingDown, Code: http.StatusServiceUnavailable})
+		return
+	}
+
+	report := c.Run(r.Context())
+
+	for name, result := range report.Checks {
+		if result.Status != StatusOK {
+			c.log.Warn("readiness check failed",
+				slog.String("check", name),
+				slog.String("error", result.Error),
+				slog.Int64("duration_ms", result.DurationMs),
+			)
+		}
+	}
+
+	writeReport(w, report)
+}
+
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results[i] = c.probe(ctx, i)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Code: http.StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+	for i, check := range c.checks {
+		report.Checks[check.Name] = results[i]
+
+		if results[i].Status == StatusOK {
+			continue
+		}
+
+		if check.Critical {
+			report.Status = StatusFail
+			report.Code = http.StatusServiceUnavailable
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+// probe runs the i-th check, or returns its result while still cached.
+// Concurrent probes of a cached check wait for one run instead of each
+// reaching the dependency.
+func (c *Checker) probe(ctx context.Context, i int) CheckResult {
+	check := c.checks[i]
+
+	cached := &c.cached[i]
+	if check.CacheFor > 0 {
+		cached.mu.Lock()
+		defer cached.mu.Unlock()
+
+		if !cached.at.IsZero() && time.Since(cached.at) < check.CacheFor {
+			return cached.result
+		}
+	}
+
+	start := time.Now()
+	err := check.Probe(ctx)
+
+	result := CheckResult{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	if check.CacheFor > 0 {
+		cached.result, cached.at = result, time.Now()
+	}
+
+	return result
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(report.Code)
+	_ = json.NewEncoder(w).Encode(report)
+}
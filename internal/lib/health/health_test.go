@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func failing(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestChecker_Ready(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     []Check
+		drain      bool
+		wantCode   int
+		wantStatus string
+	}{
+		{
+			name:       "all ok",
+			checks:     []Check{{Name: "postgres", Critical: true, Probe: ok}, {Name: "spellchecker", Probe: ok}},
+			wantCode:   http.StatusOK,
+			wantStatus: StatusOK,
+		},
+		{
+			name:       "critical failure",
+			checks:     []Check{{Name: "postgres", Critical: true, Probe: failing}, {Name: "spellchecker", Probe: ok}},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: StatusFail,
+		},
+		{
+			name:       "optional failure",
+			checks:     []Check{{Name: "postgres", Critical: true, Probe: ok}, {Name: "spellchecker", Probe: failing}},
+			wantCode:   http.StatusOK,
+			wantStatus: StatusDegraded,
+		},
+		{
+			name:       "draining",
+			checks:     []Check{{Name: "postgres", Critical: true, Probe: ok}},
+			drain:      true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: StatusShuttingDown,
+		},
+		{
+			name: "timeout",
+			checks: []Check{{Name: "postgres", Critical: true, Probe: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}}},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: StatusFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), 50*time.Millisecond, tt.checks...)
+			if tt.drain {
+				c.Drain()
+			}
+
+			w := httptest.NewRecorder()
+			c.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status code = %v, want %v", w.Code, tt.wantCode)
+			}
+
+			// наружу отдаются только статус и код, без ошибок проверок
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]any{"status": tt.wantStatus, "code": float64(tt.wantCode)}
+			if !reflect.DeepEqual(body, want) {
+				t.Errorf("body = %v, want %v", body, want)
+			}
+		})
+	}
+}
+
+func TestChecker_CacheFor(t *testing.T) {
+	probes := 0
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second, Check{
+		Name:     "spellchecker",
+		CacheFor: time.Minute,
+		Probe: func(ctx context.Context) error {
+			probes++
+			return failing(ctx)
+		},
+	})
+
+	for range 3 {
+		report := c.Run(context.Background())
+		if report.Status != StatusDegraded {
+			t.Fatalf("status = %q, want %q", report.Status, StatusDegraded)
+		}
+	}
+
+	if probes != 1 {
+		t.Errorf("probes = %d, want 1", probes)
+	}
+}
@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxKey struct{}
+
+// WithLogger returns a copy of ctx carrying log.
+func WithLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, log)
+}
+
+// FromContext returns the request logger stored by the logger middleware,
+// which already carries the request ID, user and route, or fallback
+// outside of requests.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if log, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return log
+	}
+
+	return fallback
+}
+
+// With adds attributes to the logger carried by ctx.
+func With(ctx context.Context, fallback *slog.Logger, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx, fallback).With(args...))
+}
+
+// For returns the logger carried by ctx, or fallback, tagged with the
+// operation op of a service.
+func For(ctx context.Context, fallback *slog.Logger, op string) *slog.Logger {
+	return FromContext(ctx, fallback).With(slog.String("op", op))
+}
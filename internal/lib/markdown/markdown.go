@@ -0,0 +1,126 @@
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"regexp"
+	"sync"
+)
+
+// Renderer converts CommonMark/GFM to sanitised HTML. Results are cached by
+// the SHA-256 of the source, so the same content is rendered only once no
+// matter which note (or share page, or preview) it belongs to.
+type Renderer struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type cacheEntry struct {
+	hash string
+	html string
+}
+
+func New(cacheSize int) *Renderer {
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		// raw HTML is let through here and filtered by the allowlist below
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+
+	return &Renderer{
+		md:       md,
+		policy:   newPolicy(),
+		capacity: cacheSize,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// fenced code blocks: <code class="language-go">
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	// task lists: <input type="checkbox" checked disabled>
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	return p
+}
+
+// Hash returns the cache key for the given source.
+func Hash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Renderer) Render(source string) (string, error) {
+	const op = "markdown.Render"
+
+	hash := Hash(source)
+
+	if cached, ok := r.get(hash); ok {
+		return cached, nil
+	}
+
+	var buf bytes.Buffer
+	if err := r.md.Convert([]byte(source), &buf); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	rendered := string(r.policy.SanitizeBytes(buf.Bytes()))
+
+	r.put(hash, rendered)
+
+	return rendered, nil
+}
+
+func (r *Renderer) get(hash string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	el, ok := r.entries[hash]
+	if !ok {
+		return "", false
+	}
+
+	r.order.MoveToFront(el)
+
+	return el.Value.(*cacheEntry).html, true
+}
+
+func (r *Renderer) put(hash, rendered string) {
+	if r.capacity <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if el, ok := r.entries[hash]; ok {
+		r.order.MoveToFront(el)
+		return
+	}
+
+	r.entries[hash] = r.order.PushFront(&cacheEntry{hash: hash, html: rendered})
+
+	for r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).hash)
+	}
+}
@@ -0,0 +1,86 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderer_Render(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "Table",
+			source:   "| a | b |\n|---|---|\n| 1 | 2 |\n",
+			contains: []string{"<table>", "<th>a</th>", "<td>2</td>"},
+		},
+		{
+			name:     "Task List",
+			source:   "- [x] done\n- [ ] todo\n",
+			contains: []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`},
+		},
+		{
+			name:     "Fenced Code",
+			source:   "```go\nfmt.Println(1)\n```\n",
+			contains: []string{`<code class="language-go">`},
+		},
+		{
+			name:        "Script Tag",
+			source:      "hello <script>alert(1)</script>",
+			contains:    []string{"hello"},
+			notContains: []string{"<script", "alert(1)"},
+		},
+		{
+			name:        "Javascript Link",
+			source:      "[click](javascript:alert(1))",
+			notContains: []string{"javascript:"},
+		},
+		{
+			name:        "Event Handler",
+			source:      `<img src="x.png" onerror="alert(1)">`,
+			notContains: []string{"onerror"},
+		},
+	}
+
+	r := New(16)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Render(tt.source)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("Render() = %q, want it to contain %q", got, s)
+				}
+			}
+			for _, s := range tt.notContains {
+				if strings.Contains(got, s) {
+					t.Errorf("Render() = %q, want it not to contain %q", got, s)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderer_Cache(t *testing.T) {
+	r := New(2)
+
+	for _, src := range []string{"# one", "# two", "# three"} {
+		if _, err := r.Render(src); err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+	}
+
+	if _, ok := r.get(Hash("# one")); ok {
+		t.Errorf("oldest entry was not evicted")
+	}
+	if _, ok := r.get(Hash("# three")); !ok {
+		t.Errorf("newest entry is missing from cache")
+	}
+}
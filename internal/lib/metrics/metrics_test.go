@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	m := New()
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/notes/{id}/render", func(w http.ResponseWriter, r *http.Request) {})
+	r.Post("/add-note", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/notes/1/render", nil),
+		httptest.NewRequest("GET", "/notes/2/render", nil),
+		httptest.NewRequest("POST", "/add-note", nil),
+		httptest.NewRequest("GET", "/wp-login.php", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrape(t, m)
+
+	// запросы группируются по шаблону маршрута, а не по пути
+	for _, want := range []string{
+		`notes_http_requests_total{method="GET",route="/notes/{id}/render",status="200"} 2`,
+		`notes_http_requests_total{method="POST",route="/add-note",status="201"} 1`,
+		`notes_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`notes_http_requests_in_flight 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
+
+func TestMetrics_Spellcheck(t *testing.T) {
+	m := New()
+
+	m.ObserveSpellcheck(100*time.Millisecond, nil)
+	m.ObserveSpellcheck(time.Second, errors.New("timeout"))
+	m.NoteCreated()
+
+	body := scrape(t, m)
+
+	for _, want := range []string{
+		`notes_spellchecker_errors_total 1`,
+		`notes_spellchecker_request_duration_seconds_count{result="ok"} 1`,
+		`notes_spellchecker_request_duration_seconds_count{result="error"} 1`,
+		`notes_created_total 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
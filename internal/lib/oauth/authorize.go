@@ -0,0 +1,330 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/oauth"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"testovoe/internal/models"
+	"time"
+)
+
+const authCodeTTL = 5 * time.Minute
+
+type CodeStore interface {
+	SaveAuthCode(ctx context.Context, code models.AuthCode) error
+	ConsumeAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error)
+}
+
+type authorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func parseAuthorizeRequest(r *http.Request) authorizeRequest {
+	return authorizeRequest{
+		ResponseType:        r.FormValue("response_type"),
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+	}
+}
+
+type consentPage struct {
+	Request authorizeRequest
+	Client  Client
+	Scopes  []string
+	Error   string
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Authorize {{.Client.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 4rem auto; }
+label, input { display: block; width: 100%; margin-bottom: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Authorize {{.Client.Name}}</h1>
+<p>{{.Client.Name}} is asking for access to your notes:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<label>Username <input name="username" autocomplete="username" required></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<label>One-time code, if enabled <input name="otp" inputmode="numeric" autocomplete="one-time-code"></label>
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// AuthorizePage shows the consent page of the authorization code flow.
+func (s *Server) AuthorizePage(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(r)
+
+	client, ok := s.checkClient(w, r, req)
+	if !ok {
+		return
+	}
+
+	if errCode := checkAuthorizeRequest(req); errCode != "" {
+		redirectError(w, r, req, errCode)
+		return
+	}
+
+	s.renderConsent(w, http.StatusOK, req, client, "")
+}
+
+// AuthorizeDecision handles the consent form: it authenticates the user,
+// stores a single-use code bound to the client, redirect URI and PKCE
+// challenge, and sends the browser back to the client with it.
+func (s *Server) AuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	const op = "oauth.AuthorizeDecision"
+
+	log := slog.With(slog.String("op", op))
+
+	req := parseAuthorizeRequest(r)
+
+	client, ok := s.checkClient(w, r, req)
+	if !ok {
+		return
+	}
+
+	if errCode := checkAuthorizeRequest(req); errCode != "" {
+		redirectError(w, r, req, errCode)
+		return
+	}
+
+	if r.FormValue("action") != "approve" {
+		redirectError(w, r, req, "access_denied")
+		return
+	}
+
+	username := r.FormValue("username")
+	if err := s.verifier.ValidateUser(username, r.FormValue("password"), req.Scope, r); err != nil {
+		var locked *LockedError
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", locked.retryAfterSeconds())
+			s.renderConsent(w, http.StatusTooManyRequests, req, client, "Too many failed attempts, try again later")
+			return
+		}
+
+		msg := "Wrong username or password"
+		switch {
+		case errors.Is(err, ErrMFARequired):
+			msg = "Enter the code from your authenticator app"
+		case errors.Is(err, ErrInvalidMFACode):
+			msg = "Wrong one-time code"
+		}
+
+		s.renderConsent(w, http.StatusUnauthorized, req, client, msg)
+		return
+	}
+
+	scope, err := s.consentScope(r.Context(), client, username, req.Scope)
+	if err != nil {
+		redirectError(w, r, req, "invalid_scope")
+		return
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		log.Error("failed to generate code", slog.String("error", err.Error()))
+		redirectError(w, r, req, "server_error")
+		return
+	}
+
+	err = s.codes.SaveAuthCode(r.Context(), models.AuthCode{
+		CodeHash:      hashCode(code),
+		ClientID:      client.ID,
+		RedirectURI:   req.RedirectURI,
+		Username:      username,
+		Scope:         scope,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(authCodeTTL),
+	})
+	if err != nil {
+		log.Error("failed to save code", slog.String("error", err.Error()))
+		redirectError(w, r, req, "server_error")
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// exchangeCode redeems an authorization code at the token endpoint.
+func (s *Server) exchangeCode(r *http.Request) (interface{}, int) {
+	clientID := r.FormValue("client_id")
+	clientSecret := r.FormValue("client_secret")
+	if clientID == "" {
+		var err error
+		clientID, clientSecret, err = oauth.GetBasicAuthentication(r)
+		if err != nil {
+			return "Not authorized", http.StatusUnauthorized
+		}
+	}
+
+	client, err := s.clients.GetClient(r.Context(), clientID)
+	if err != nil {
+		return "Not authorized", http.StatusUnauthorized
+	}
+	if !client.AllowsGrant(oauth.AuthCodeGrant) || (!client.Public() && !client.CheckSecret(clientSecret)) {
+		return "Not authorized", http.StatusUnauthorized
+	}
+
+	code, err := s.codes.ConsumeAuthCode(r.Context(), hashCode(r.FormValue("code")))
+	if err != nil {
+		return "Not authorized", http.StatusUnauthorized
+	}
+
+	if code.ClientID != client.ID ||
+		code.RedirectURI != r.FormValue("redirect_uri") ||
+		!verifyPKCE(code.CodeChallenge, r.FormValue("code_verifier")) {
+		return "Not authorized", http.StatusUnauthorized
+	}
+
+	return s.issue(oauth.AuthToken, code.Username, code.Scope, client.ID, r)
+}
+
+// checkClient validates the client and redirect URI. Errors here are shown
+// to the user instead of being redirected, since the redirect target
+// cannot be trusted.
+func (s *Server) checkClient(w http.ResponseWriter, r *http.Request, req authorizeRequest) (Client, bool) {
+	client, err := s.clients.GetClient(r.Context(), req.ClientID)
+	if err != nil {
+		if !errors.Is(err, ErrClientNotFound) {
+			slog.Error("failed to get client", slog.String("error", err.Error()))
+		}
+		http.Error(w, "Unknown client", http.StatusBadRequest)
+		return Client{}, false
+	}
+
+	if !client.AllowsGrant(oauth.AuthCodeGrant) {
+		http.Error(w, "Client may not use the authorization code flow", http.StatusBadRequest)
+		return Client{}, false
+	}
+
+	if !client.AllowsRedirect(req.RedirectURI) {
+		http.Error(w, "Redirect URI is not registered for this client", http.StatusBadRequest)
+		return Client{}, false
+	}
+
+	return client, true
+}
+
+func checkAuthorizeRequest(req authorizeRequest) string {
+	if req.ResponseType != "code" {
+		return "unsupported_response_type"
+	}
+
+	// PKCE is required for every client, and only with S256
+	if req.CodeChallengeMethod != PKCEMethodS256 || !validPKCEValue(req.CodeChallenge) {
+		return "invalid_request"
+	}
+
+	return ""
+}
+
+// consentScope narrows the requested scope to what both the user and the
+// client are allowed to have.
+func (s *Server) consentScope(ctx context.Context, client Client, username, requested string) (string, error) {
+	allowed := client.Scopes
+
+	if granter, ok := s.verifier.(ScopeGranter); ok {
+		userScopes, err := granter.AllowedScopes(ctx, oauth.AuthToken, username)
+		if err != nil {
+			return "", err
+		}
+
+		allowed = slices.DeleteFunc(slices.Clone(allowed), func(scope string) bool {
+			return !slices.Contains(userScopes, scope)
+		})
+	}
+
+	return grantScope(allowed, requested)
+}
+
+func (s *Server) renderConsent(w http.ResponseWriter, status int, req authorizeRequest, client Client, errMsg string) {
+	scopes := ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	if client.Name == "" {
+		client.Name = client.ID
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = consentTemplate.Execute(w, consentPage{Request: req, Client: client, Scopes: scopes, Error: errMsg})
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, req authorizeRequest, errCode string) {
+	redirect(w, r, req.RedirectURI, url.Values{"error": {errCode}, "state": {req.State}})
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,292 @@
+package oauth
+
+import (
+	"context"
+	"github.com/go-chi/oauth"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+	"time"
+)
+
+const (
+	testRedirect = "http://localhost:3000/callback"
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+var (
+	authCodeOnly    = []string{string(oauth.AuthCodeGrant)}
+	testAuthClients = NewStaticClients([]Client{
+		{ID: "web", Name: "Notes Web", GrantTypes: authCodeOnly, RedirectURIs: []string{testRedirect}, Scopes: []string{ScopeNotesRead, ScopeNotesWrite}},
+		{ID: "backend", SecretHash: HashSecret("s3cret"), GrantTypes: authCodeOnly, RedirectURIs: []string{testRedirect}, Scopes: []string{ScopeNotesRead}},
+		{ID: "service", SecretHash: HashSecret("s3cret"), GrantTypes: []string{string(oauth.ClientCredentialsGrant)}, Scopes: []string{ScopeNotesRead}},
+	})
+)
+
+// memoryCodes повторяет поведение postgres: код можно использовать один раз
+type memoryCodes struct {
+	mu    sync.Mutex
+	codes map[string]models.AuthCode
+}
+
+func newMemoryCodes() *memoryCodes {
+	return &memoryCodes{codes: make(map[string]models.AuthCode)}
+}
+
+func (m *memoryCodes) SaveAuthCode(ctx context.Context, code models.AuthCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.codes[code.CodeHash] = code
+
+	return nil
+}
+
+func (m *memoryCodes) ConsumeAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code, ok := m.codes[codeHash]
+	if !ok || time.Now().After(code.ExpiresAt) {
+		return models.AuthCode{}, storage.ErrCodeNotFound
+	}
+	delete(m.codes, codeHash)
+
+	return code, nil
+}
+
+func authorizeForm(clientID, scope string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {testRedirect},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {S256Challenge(testVerifier)},
+		"code_challenge_method": {PKCEMethodS256},
+		"username":              {"user1"},
+		"password":              {"password1"},
+		"action":                {"approve"},
+	}
+}
+
+func postForm(handler http.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	return w
+}
+
+func obtainCode(t *testing.T, s *Server, form url.Values) string {
+	t.Helper()
+
+	w := postForm(s.AuthorizeDecision, form)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("authorize status = %v, body = %s", w.Code, w.Body.String())
+	}
+
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Query().Get("state") != "xyz" {
+		t.Errorf("state = %q, want xyz", loc.Query().Get("state"))
+	}
+
+	code := loc.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect %s", loc)
+	}
+
+	return code
+}
+
+func TestServer_AuthorizationCode(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	code := obtainCode(t, s, authorizeForm("web", ScopeNotesRead))
+
+	resp := requestToken(t, s, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"web"},
+		"code":          {code},
+		"redirect_uri":  {testRedirect},
+		"code_verifier": {testVerifier},
+	})
+	claims, err := s.ParseAccessToken(resp.Token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if claims.Subject != "user1" || claims.ClientID != "web" || claims.Scope != ScopeNotesRead {
+		t.Errorf("sub = %q, azp = %q, scope = %q, want user1, web, %s", claims.Subject, claims.ClientID, claims.Scope, ScopeNotesRead)
+	}
+
+	// второй обмен того же кода должен быть отклонён
+	w := postForm(s.UserCredentials, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"web"},
+		"code":          {code},
+		"redirect_uri":  {testRedirect},
+		"code_verifier": {testVerifier},
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("reused code status = %v, want 401", w.Code)
+	}
+}
+
+func TestServer_AuthorizationCodeRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		exchange url.Values
+	}{
+		{
+			name:     "wrong verifier",
+			clientID: "web",
+			exchange: url.Values{"client_id": {"web"}, "redirect_uri": {testRedirect}, "code_verifier": {strings.Repeat("a", 43)}},
+		},
+		{
+			name:     "missing verifier",
+			clientID: "web",
+			exchange: url.Values{"client_id": {"web"}, "redirect_uri": {testRedirect}},
+		},
+		{
+			name:     "wrong redirect",
+			clientID: "web",
+			exchange: url.Values{"client_id": {"web"}, "redirect_uri": {"http://evil.example/cb"}, "code_verifier": {testVerifier}},
+		},
+		{
+			name:     "other client",
+			clientID: "web",
+			exchange: url.Values{"client_id": {"backend"}, "client_secret": {"s3cret"}, "redirect_uri": {testRedirect}, "code_verifier": {testVerifier}},
+		},
+		{
+			name:     "confidential client without secret",
+			clientID: "backend",
+			exchange: url.Values{"client_id": {"backend"}, "redirect_uri": {testRedirect}, "code_verifier": {testVerifier}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+			form := tt.exchange
+			form.Set("grant_type", "authorization_code")
+			form.Set("code", obtainCode(t, s, authorizeForm(tt.clientID, ScopeNotesRead)))
+
+			if w := postForm(s.UserCredentials, form); w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %v, want 401, body = %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_AuthorizeRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(url.Values)
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:     "consent page",
+			modify:   func(url.Values) {},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "unknown client",
+			modify:   func(f url.Values) { f.Set("client_id", "nope") },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "client without the grant",
+			modify:   func(f url.Values) { f.Set("client_id", "service") },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unregistered redirect",
+			modify:   func(f url.Values) { f.Set("redirect_uri", "http://evil.example/cb") },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "no pkce",
+			modify:    func(f url.Values) { f.Del("code_challenge") },
+			wantCode:  http.StatusSeeOther,
+			wantError: "invalid_request",
+		},
+		{
+			name:      "plain pkce",
+			modify:    func(f url.Values) { f.Set("code_challenge_method", "plain") },
+			wantCode:  http.StatusSeeOther,
+			wantError: "invalid_request",
+		},
+		{
+			name:      "implicit flow",
+			modify:    func(f url.Values) { f.Set("response_type", "token") },
+			wantCode:  http.StatusSeeOther,
+			wantError: "unsupported_response_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+			form := authorizeForm("web", ScopeNotesRead)
+			tt.modify(form)
+
+			req := httptest.NewRequest("GET", "/oauth/authorize?"+form.Encode(), nil)
+			w := httptest.NewRecorder()
+			s.AuthorizePage(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %v, want %v, body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+
+			if tt.wantCode == http.StatusOK && w.Header().Get("X-Frame-Options") != "DENY" {
+				t.Errorf("consent page can be framed")
+			}
+
+			if tt.wantError != "" {
+				loc, _ := url.Parse(w.Header().Get("Location"))
+				if got := loc.Query().Get("error"); got != tt.wantError {
+					t.Errorf("error = %q, want %q", got, tt.wantError)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_AuthorizeDecision(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	form := authorizeForm("web", "")
+	form.Set("action", "deny")
+	w := postForm(s.AuthorizeDecision, form)
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusSeeOther || loc.Query().Get("error") != "access_denied" {
+		t.Errorf("deny = %v %s, want access_denied redirect", w.Code, loc)
+	}
+
+	form = authorizeForm("web", "")
+	form.Set("password", "nope")
+	if w := postForm(s.AuthorizeDecision, form); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password status = %v, want 401", w.Code)
+	}
+
+	// клиенту backend разрешено только чтение
+	form = authorizeForm("backend", ScopeNotesWrite)
+	w = postForm(s.AuthorizeDecision, form)
+	loc, _ = url.Parse(w.Header().Get("Location"))
+	if loc.Query().Get("error") != "invalid_scope" {
+		t.Errorf("error = %q, want invalid_scope", loc.Query().Get("error"))
+	}
+}
@@ -0,0 +1,68 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/oauth"
+	"github.com/google/uuid"
+	"net/http"
+	"testovoe/internal/lib/problem"
+	"time"
+)
+
+// maxImpersonationTTL caps the lifetime of impersonation tokens below the
+// regular access token lifetime.
+const maxImpersonationTTL = 15 * time.Minute
+
+// ActorClaim is the RFC 8693 "act" claim: the admin acting as the subject.
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
+
+type actorContextKey struct{}
+
+// Impersonate issues a short-lived access token for subject on behalf of
+// actor. There is no refresh token; the admin asks for a new one when it
+// expires.
+func (s *Server) Impersonate(actor, subject, scope string) (*oauth.TokenResponse, error) {
+	const op = "oauth.Impersonate"
+
+	ttl := min(s.accessTTL, maxImpersonationTTL)
+
+	token, err := s.sign(Claims{
+		RegisteredClaims: s.registered(uuid.NewString(), subject, time.Now().UTC(), ttl),
+		Scope:            scope,
+		TokenType:        oauth.UserToken,
+		TokenUse:         tokenUseAccess,
+		Actor:            &ActorClaim{Subject: actor},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &oauth.TokenResponse{
+		Token:     token,
+		TokenType: oauth.BearerToken,
+		ExpiresIn: int64(ttl / time.Second),
+	}, nil
+}
+
+// ImpersonatedBy returns the admin behind an impersonation token.
+func ImpersonatedBy(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorContextKey{}).(string)
+
+	return actor, ok
+}
+
+// RejectImpersonation keeps impersonation tokens away from routes that
+// manage credentials, so support access cannot outlive the token.
+func RejectImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ImpersonatedBy(r.Context()); ok {
+			problem.Write(w, r, http.StatusForbidden, "impersonation_not_allowed", "not allowed while impersonating")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
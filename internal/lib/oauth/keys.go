@@ -0,0 +1,317 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	minRSABits = 2048
+)
+
+var (
+	ErrNoSigningKey      = errors.New("no signing key configured")
+	ErrUnknownKey        = errors.New("unknown key id")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrAlgorithmMismatch = errors.New("algorithm does not match key")
+)
+
+// KeySpec describes one key of the set. The private key is given inline or
+// as a path to a PEM file. Keys with only a public part are kept for
+// verification, which is how a rotated-out key stays valid until the
+// tokens it signed expire.
+type KeySpec struct {
+	ID             string
+	Algorithm      string
+	PrivateKey     string
+	PrivateKeyFile string
+	PublicKeyFile  string
+}
+
+type Key struct {
+	ID        string
+	Algorithm string
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// KeySet holds the keys tokens are verified with; the active one also
+// signs new tokens. Its kid goes into the token header so verifiers can
+// pick the right key after a rotation.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	order  []string
+}
+
+func NewKeySet(specs []KeySpec, activeID string) (*KeySet, error) {
+	const op = "oauth.NewKeySet"
+
+	ks := &KeySet{keys: make(map[string]*Key)}
+
+	for _, spec := range specs {
+		key, err := loadKey(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", op, spec.ID, err)
+		}
+
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate key id %q", op, key.ID)
+		}
+
+		ks.keys[key.ID] = key
+		ks.order = append(ks.order, key.ID)
+	}
+
+	if activeID == "" && len(ks.order) > 0 {
+		activeID = ks.order[0]
+	}
+
+	if activeID != "" {
+		active, ok := ks.keys[activeID]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w: %q", op, ErrUnknownKey, activeID)
+		}
+		if active.private == nil {
+			return nil, fmt.Errorf("%s: %w: %q has no private key", op, ErrNoSigningKey, activeID)
+		}
+		ks.active = active
+	}
+
+	if ks.active == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrNoSigningKey)
+	}
+
+	return ks, nil
+}
+
+// NewEphemeralKeySet generates a throwaway Ed25519 key. Tokens signed with
+// it do not survive a restart, so it is only meant for local runs.
+func NewEphemeralKeySet() (*KeySet, error) {
+	const op = "oauth.NewEphemeralKeySet"
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key := &Key{Algorithm: AlgEdDSA, private: private, public: public}
+	if key.ID, err = thumbprint(public); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &KeySet{
+		active: key,
+		keys:   map[string]*Key{key.ID: key},
+		order:  []string{key.ID},
+	}, nil
+}
+
+func (ks *KeySet) Active() *Key {
+	return ks.active
+}
+
+func (ks *KeySet) Lookup(kid string) (*Key, error) {
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+func loadKey(spec KeySpec) (*Key, error) {
+	key := &Key{ID: spec.ID}
+
+	switch {
+	case spec.PrivateKey != "" || spec.PrivateKeyFile != "":
+		data := []byte(spec.PrivateKey)
+		if spec.PrivateKeyFile != "" {
+			var err error
+			if data, err = os.ReadFile(spec.PrivateKeyFile); err != nil {
+				return nil, err
+			}
+		}
+
+		private, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+		key.public = private.Public()
+	case spec.PublicKeyFile != "":
+		data, err := os.ReadFile(spec.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.public, err = parsePublicKey(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("neither private nor public key given")
+	}
+
+	alg, err := algorithmFor(key.public)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Algorithm != "" && spec.Algorithm != alg {
+		return nil, fmt.Errorf("%w: %s", ErrAlgorithmMismatch, spec.Algorithm)
+	}
+	key.Algorithm = alg
+
+	if key.ID == "" {
+		if key.ID, err = thumbprint(key.public); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if private, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		return signer, nil
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if public, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return public, nil
+	}
+
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+func algorithmFor(public crypto.PublicKey) (string, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return "", fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+		return AlgRS256, nil
+	case ed25519.PublicKey:
+		return AlgEdDSA, nil
+	}
+
+	return "", ErrUnsupportedKey
+}
+
+// JWK is the public part of a key as published at /.well-known/jwks.json.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.order))}
+
+	for _, kid := range ks.order {
+		key := ks.keys[kid]
+
+		jwk, err := publicJWK(key.public)
+		if err != nil {
+			continue
+		}
+		jwk.KeyID = key.ID
+		jwk.Use = "sig"
+		jwk.Algorithm = key.Algorithm
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func publicJWK(public crypto.PublicKey) (JWK, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	}
+
+	return JWK{}, ErrUnsupportedKey
+}
+
+// thumbprint derives a key ID as defined by RFC 7638.
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return "", err
+	}
+
+	var members any
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
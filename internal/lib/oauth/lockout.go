@@ -0,0 +1,43 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LoginGuard throttles password logins. CheckLogin returns a *LockedError
+// while the username or address is locked; the outcome of every attempt
+// is reported back through LoginFailed or LoginSucceeded.
+type LoginGuard interface {
+	CheckLogin(ctx context.Context, username, ip string) error
+	LoginFailed(ctx context.Context, username, ip string)
+	LoginSucceeded(ctx context.Context, username, ip string)
+}
+
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("login locked, retry after %s", e.RetryAfter)
+}
+
+// retryAfterSeconds formats the Retry-After header, rounding up.
+func (e *LockedError) retryAfterSeconds() string {
+	return strconv.Itoa(int((e.RetryAfter + time.Second - 1) / time.Second))
+}
+
+// clientIP returns the address middleware.RealIP resolved for the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RealIP stores a bare address, without the port
+		return r.RemoteAddr
+	}
+
+	return host
+}
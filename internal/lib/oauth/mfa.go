@@ -0,0 +1,18 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrMFARequired    = errors.New("mfa code required")
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+)
+
+// MFAVerifier is the second login step. CheckMFA returns nil for users
+// without MFA, ErrMFARequired when the code is missing and
+// ErrInvalidMFACode when it is wrong.
+type MFAVerifier interface {
+	CheckMFA(ctx context.Context, username, code string) error
+}
@@ -0,0 +1,146 @@
+package oauth
+
+import (
+	"context"
+	"github.com/go-chi/oauth"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/problem"
+)
+
+// APIKeyPrefix marks personal API keys, so they can be told apart from
+// JWTs in the Authorization header.
+const APIKeyPrefix = "nsk_"
+
+// APIKeyVerifier resolves a personal API key to its owner and scope.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (owner, scope string, err error)
+}
+
+var errInvalidAPIKey = apperr.Unauthorized("invalid_api_key", "invalid API key")
+
+type apiKeyContextKey struct{}
+
+// Authorize verifies the bearer token or API key of the request and stores
+// its credential, claims, scope and type in the context under the
+// go-chi/oauth keys, so handlers read them the same way as with
+// oauth.Authorize. API keys are accepted in the X-API-Key header or as a
+// bearer token.
+func (s *Server) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-API-Key")
+		if token == "" {
+			auth := r.Header.Get("Authorization")
+			if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+				problem.Write(w, r, http.StatusUnauthorized, "invalid_authorization_header", "invalid bearer authorization header")
+				return
+			}
+			token = auth[7:]
+		}
+
+		ctx, err := s.Authenticate(r.Context(), token)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+
+		if actor, ok := ImpersonatedBy(ctx); ok {
+			owner, _ := Credential(ctx)
+			slog.Info("impersonated request",
+				slog.String("actor", actor),
+				slog.String("owner", owner),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authenticate verifies a bearer token or API key and returns ctx with the
+// values Authorize stores, for transports other than HTTP.
+func (s *Server) Authenticate(ctx context.Context, token string) (context.Context, error) {
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		return s.authenticateAPIKey(ctx, token)
+	}
+
+	claims, err := s.ParseAccessToken(token)
+	if err != nil {
+		return ctx, problem.ErrInvalidToken
+	}
+
+	ctx = context.WithValue(ctx, oauth.CredentialContext, claims.Subject)
+	ctx = context.WithValue(ctx, oauth.ClaimsContext, claims.Extra)
+	ctx = context.WithValue(ctx, oauth.ScopeContext, claims.Scope)
+	ctx = context.WithValue(ctx, oauth.TokenTypeContext, claims.TokenType)
+	ctx = context.WithValue(ctx, oauth.AccessTokenContext, token)
+	if claims.Actor != nil {
+		ctx = context.WithValue(ctx, actorContextKey{}, claims.Actor.Subject)
+	}
+
+	return ctx, nil
+}
+
+func (s *Server) authenticateAPIKey(ctx context.Context, key string) (context.Context, error) {
+	if s.apiKeys == nil {
+		return ctx, problem.ErrInvalidToken
+	}
+
+	owner, scope, err := s.apiKeys.VerifyAPIKey(ctx, key)
+	if err != nil {
+		return ctx, errInvalidAPIKey
+	}
+
+	// the key acts for its owner, exactly like the owner's user token
+	ctx = context.WithValue(ctx, oauth.CredentialContext, owner)
+	ctx = context.WithValue(ctx, oauth.ScopeContext, scope)
+	ctx = context.WithValue(ctx, oauth.TokenTypeContext, oauth.UserToken)
+	ctx = context.WithValue(ctx, apiKeyContextKey{}, true)
+
+	return ctx, nil
+}
+
+// Credential returns the subject of the token the request was authorized with.
+func Credential(ctx context.Context) (string, bool) {
+	credential, ok := ctx.Value(oauth.CredentialContext).(string)
+
+	return credential, ok && credential != ""
+}
+
+// Scope returns the scope the request was authorized with.
+func Scope(ctx context.Context) string {
+	scope, _ := ctx.Value(oauth.ScopeContext).(string)
+
+	return scope
+}
+
+// ViaAPIKey reports whether the request was authorized with an API key.
+func ViaAPIKey(ctx context.Context) bool {
+	ok, _ := ctx.Value(apiKeyContextKey{}).(bool)
+
+	return ok
+}
+
+// Interactive reports whether the request was authorized with a token a
+// user got by signing in, rather than with an API key or a client token.
+func Interactive(ctx context.Context) bool {
+	tokenType, _ := ctx.Value(oauth.TokenTypeContext).(oauth.TokenType)
+
+	return tokenType == oauth.UserToken && !ViaAPIKey(ctx)
+}
+
+// RequireInteractive keeps API keys and client tokens away from routes
+// that manage credentials, so a leaked key cannot mint longer-lived ones
+// or weaken the sign-in of its owner.
+func RequireInteractive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Interactive(r.Context()) {
+			problem.Write(w, r, http.StatusForbidden, "interactive_login_required", "sign in as the user to do this")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
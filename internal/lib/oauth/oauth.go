@@ -1,20 +1,18 @@
 package oauth
 
 import (
+	"context"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/oauth"
 	"log/slog"
 	"net/http"
-	"time"
 )
 
-func AuthAPI(r *chi.Mux) {
-	s := oauth.NewBearerServer(
-		"yaroslav-the-best",
-		time.Hour*2,
-		&TestUserVerifier{},
-		nil)
+func AuthAPI(r *chi.Mux, s *Server) {
+	r.Get("/.well-known/jwks.json", s.JWKS)
+	r.Get("/oauth/authorize", s.AuthorizePage)
+	r.Post("/oauth/authorize", s.AuthorizeDecision)
 	r.Post("/token", func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("Received /token request")
 		s.UserCredentials(w, r)
@@ -25,34 +23,104 @@ func AuthAPI(r *chi.Mux) {
 	})
 }
 
-type TestUserVerifier struct {
+// UserVerifier checks users against the user store and clients against
+// the client registry.
+type UserVerifier struct {
+	Users   UserStore
+	Clients ClientStore
+	MFA     MFAVerifier
+	Guard   LoginGuard
 }
 
-// ValidateUser validates username and password returning an error if the user credentials are wrong
-func (*TestUserVerifier) ValidateUser(username, password, scope string, r *http.Request) error {
-	if username == "user1" && password == "password1" {
-		return nil
+// ValidateUser validates username and password returning an error if the user credentials are wrong.
+// Users with MFA enabled must also pass a code in the otp form parameter.
+func (v *UserVerifier) ValidateUser(username, password, scope string, r *http.Request) error {
+	ctx := r.Context()
+	ip := clientIP(r)
+
+	if v.Guard != nil {
+		if err := v.Guard.CheckLogin(ctx, username, ip); err != nil {
+			return err
+		}
+	}
+
+	user, err := v.Users.GetUser(ctx, username)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+
+	// external users have no password and sign in through the identity provider
+	if !checkPassword(user.PasswordHash, password) {
+		v.loginFailed(ctx, username, ip)
+		return errors.New("wrong user")
+	}
+
+	if user.Disabled {
+		return ErrUserDisabled
 	}
 
-	return errors.New("wrong user")
+	if v.MFA != nil {
+		err := v.MFA.CheckMFA(ctx, username, r.FormValue("otp"))
+		if errors.Is(err, ErrInvalidMFACode) {
+			v.loginFailed(ctx, username, ip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if v.Guard != nil {
+		v.Guard.LoginSucceeded(ctx, username, ip)
+	}
+
+	return nil
 }
 
-// ValidateClient validates clientID and secret returning an error if the client credentials are wrong
-func (*TestUserVerifier) ValidateClient(clientID, clientSecret, scope string, r *http.Request) error {
-	if clientID == "abcdef" && clientSecret == "12345" {
-		return nil
+func (v *UserVerifier) loginFailed(ctx context.Context, username, ip string) {
+	if v.Guard != nil {
+		v.Guard.LoginFailed(ctx, username, ip)
 	}
+}
 
-	return errors.New("wrong client")
+// ValidateClient validates clientID and secret against the client registry
+func (v *UserVerifier) ValidateClient(clientID, clientSecret, scope string, r *http.Request) error {
+	client, err := v.Clients.GetClient(r.Context(), clientID)
+	if err != nil {
+		return err
+	}
+
+	if !client.AllowsGrant(oauth.ClientCredentialsGrant) || !client.CheckSecret(clientSecret) {
+		return errors.New("wrong client")
+	}
+
+	return nil
 }
 
-// ValidateCode validates token ID
-func (*TestUserVerifier) ValidateCode(clientID, clientSecret, code, redirectURI string, r *http.Request) (string, error) {
-	return "", nil
+// AllowedScopes returns the scopes the user or client may request
+func (v *UserVerifier) AllowedScopes(ctx context.Context, tokenType oauth.TokenType, credential string) ([]string, error) {
+	if tokenType == oauth.ClientToken {
+		client, err := v.Clients.GetClient(ctx, credential)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.Scopes, nil
+	}
+
+	user, err := v.Users.GetUser(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	return RoleScopes(user.Role), nil
 }
 
 // AddClaims provides additional claims to the token
-func (*TestUserVerifier) AddClaims(tokenType oauth.TokenType, credential, tokenID, scope string, r *http.Request) (map[string]string, error) {
+func (*UserVerifier) AddClaims(tokenType oauth.TokenType, credential, tokenID, scope string, r *http.Request) (map[string]string, error) {
 	claims := make(map[string]string)
 	claims["customer_id"] = "1001"
 	claims["customer_data"] = `{"order_date":"2016-12-14","order_id":"9999"}`
@@ -60,18 +128,18 @@ func (*TestUserVerifier) AddClaims(tokenType oauth.TokenType, credential, tokenI
 }
 
 // AddProperties provides additional information to the token response
-func (*TestUserVerifier) AddProperties(tokenType oauth.TokenType, credential, tokenID, scope string, r *http.Request) (map[string]string, error) {
+func (*UserVerifier) AddProperties(tokenType oauth.TokenType, credential, tokenID, scope string, r *http.Request) (map[string]string, error) {
 	props := make(map[string]string)
 	props["customer_name"] = "Gopher"
 	return props, nil
 }
 
 // ValidateTokenID validates token ID
-func (*TestUserVerifier) ValidateTokenID(tokenType oauth.TokenType, credential, tokenID, refreshTokenID string) error {
+func (*UserVerifier) ValidateTokenID(tokenType oauth.TokenType, credential, tokenID, refreshTokenID string) error {
 	return nil
 }
 
 // StoreTokenID saves the token id generated for the user
-func (*TestUserVerifier) StoreTokenID(tokenType oauth.TokenType, credential, tokenID, refreshTokenID string) error {
+func (*UserVerifier) StoreTokenID(tokenType oauth.TokenType, credential, tokenID, refreshTokenID string) error {
 	return nil
 }
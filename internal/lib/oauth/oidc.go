@@ -0,0 +1,249 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
+	"golang.org/x/oauth2"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	tokenUseOIDCState = "oidc_state"
+	oidcStateCookie   = "oidc_login"
+	oidcStateTTL      = 10 * time.Minute
+)
+
+var (
+	ErrIdentityConflict = errors.New("username is taken by another identity")
+)
+
+// OIDCConfig describes the external identity provider. UsernameClaim is
+// the ID token claim that becomes the username of the provisioned user.
+type OIDCConfig struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+}
+
+// ExternalIdentity is the user as asserted by the identity provider.
+type ExternalIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Email    string
+}
+
+// Provisioner creates the local user for an external identity on its
+// first login and returns the username it is known by.
+type Provisioner interface {
+	ProvisionUser(ctx context.Context, identity ExternalIdentity) (string, error)
+}
+
+// OIDCLogin is the relying party side of an OpenID Connect login. After
+// the provider authenticates the user it issues the service's own tokens.
+type OIDCLogin struct {
+	server      *Server
+	config      OIDCConfig
+	oauth2      oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	provisioner Provisioner
+}
+
+// NewOIDCLogin runs discovery against the provider, so it fails when the
+// provider is unreachable.
+func NewOIDCLogin(ctx context.Context, cfg OIDCConfig, server *Server, provisioner Provisioner) (*OIDCLogin, error) {
+	const op = "oauth.NewOIDCLogin"
+
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "email"
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	return &OIDCLogin{
+		server: server,
+		config: cfg,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier:    provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		provisioner: provisioner,
+	}, nil
+}
+
+func OIDCAPI(r *chi.Mux, l *OIDCLogin) {
+	r.Get("/oauth/oidc/login", l.Login)
+	r.Get("/oauth/oidc/callback", l.Callback)
+}
+
+// Login redirects the browser to the provider. State, nonce and the PKCE
+// verifier travel in a short-lived cookie signed with the token keys, so
+// no server-side session is needed.
+func (l *OIDCLogin) Login(w http.ResponseWriter, r *http.Request) {
+	const op = "oauth.OIDCLogin.Login"
+
+	state, err := randomToken()
+	if err != nil {
+		slog.Error("failed to generate state", slog.String("op", op), slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		slog.Error("failed to generate nonce", slog.String("op", op), slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	cookie, err := l.server.sign(Claims{
+		RegisteredClaims: l.server.registered(state, state, time.Now().UTC(), oidcStateTTL),
+		TokenUse:         tokenUseOIDCState,
+		Extra:            map[string]string{"nonce": nonce, "verifier": verifier},
+	})
+	if err != nil {
+		slog.Error("failed to sign state", slog.String("op", op), slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookie,
+		Path:     "/oauth/oidc",
+		MaxAge:   int(oidcStateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Lax lets the cookie through on the top-level redirect back
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	url := l.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Callback finishes the login: it exchanges the code, validates the ID
+// token, provisions the user and responds with the service's tokens.
+func (l *OIDCLogin) Callback(w http.ResponseWriter, r *http.Request) {
+	const op = "oauth.OIDCLogin.Callback"
+
+	log := slog.With(slog.String("op", op))
+
+	// the state cookie is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/oauth/oidc", MaxAge: -1})
+
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		renderJSON(w, "Login failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		renderJSON(w, "Login session expired, start again", http.StatusBadRequest)
+		return
+	}
+
+	state, err := l.server.parse(cookie.Value, tokenUseOIDCState)
+	if err != nil || state.Subject != r.URL.Query().Get("state") {
+		renderJSON(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	token, err := l.oauth2.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(state.Extra["verifier"]))
+	if err != nil {
+		log.Warn("code exchange failed", slog.String("error", err.Error()))
+		renderJSON(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		renderJSON(w, "Not authorized: no id_token", http.StatusUnauthorized)
+		return
+	}
+
+	idToken, err := l.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		log.Warn("invalid id token", slog.String("error", err.Error()))
+		renderJSON(w, "Not authorized: invalid id_token", http.StatusUnauthorized)
+		return
+	}
+
+	if idToken.Nonce != state.Extra["nonce"] {
+		log.Warn("id token nonce mismatch")
+		renderJSON(w, "Not authorized: invalid id_token", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := l.identity(idToken)
+	if err != nil {
+		log.Warn("unusable id token", slog.String("error", err.Error()))
+		renderJSON(w, "Not authorized: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	username, err := l.provisioner.ProvisionUser(r.Context(), identity)
+	if err != nil {
+		if errors.Is(err, ErrIdentityConflict) {
+			renderJSON(w, "Username is already taken", http.StatusConflict)
+			return
+		}
+
+		log.Error("failed to provision user", slog.String("error", err.Error()))
+		renderJSON(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp, status := l.server.issue(oauth.UserToken, username, "", "", r)
+	renderJSON(w, resp, status)
+}
+
+func (l *OIDCLogin) identity(idToken *oidc.IDToken) (ExternalIdentity, error) {
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	username, _ := claims[l.config.UsernameClaim].(string)
+	if username == "" {
+		return ExternalIdentity{}, fmt.Errorf("claim %q is missing", l.config.UsernameClaim)
+	}
+
+	email, _ := claims["email"].(string)
+	if l.config.UsernameClaim == "email" {
+		// an unverified address could belong to someone else
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return ExternalIdentity{}, errors.New("email is not verified")
+		}
+	}
+
+	return ExternalIdentity{
+		Issuer:   idToken.Issuer,
+		Subject:  idToken.Subject,
+		Username: username,
+		Email:    email,
+	}, nil
+}
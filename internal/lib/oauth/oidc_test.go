@@ -0,0 +1,239 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// mockProvider - локальный OIDC-провайдер для тестов
+type mockProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	nonce     string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || S256Challenge(r.FormValue("code_verifier")) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   p.URL,
+			"aud":   "notes",
+			"sub":   "42",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": p.nonce,
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "mock"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// fakeProvisioner keeps the subject of every user it provisioned; users
+// without one are local.
+type fakeProvisioner struct {
+	users    memoryUsers
+	subjects map[string]string
+}
+
+func (f fakeProvisioner) ProvisionUser(ctx context.Context, identity ExternalIdentity) (string, error) {
+	if _, ok := f.users[identity.Username]; ok && f.subjects[identity.Username] != identity.Subject {
+		return "", ErrIdentityConflict
+	}
+	f.users[identity.Username] = User{Username: identity.Username, Role: RoleUser}
+	f.subjects[identity.Username] = identity.Subject
+
+	return identity.Username, nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		wrongState bool
+		wrongNonce bool
+		code       string
+		wantStatus int
+		wantUser   string
+	}{
+		{
+			name:       "login",
+			claims:     jwt.MapClaims{"email": "alice@corp.example", "email_verified": true},
+			wantStatus: http.StatusOK,
+			wantUser:   "alice@corp.example",
+		},
+		{
+			name:       "unverified email",
+			claims:     jwt.MapClaims{"email": "alice@corp.example"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "local username",
+			claims:     jwt.MapClaims{"email": "user1", "email_verified": true},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "taken by another identity",
+			claims:     jwt.MapClaims{"email": "bob@corp.example", "email_verified": true},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "wrong state",
+			claims:     jwt.MapClaims{"email": "alice@corp.example", "email_verified": true},
+			wrongState: true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "replayed nonce",
+			claims:     jwt.MapClaims{"email": "alice@corp.example", "email_verified": true},
+			wrongNonce: true,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "bad code",
+			claims:     jwt.MapClaims{"email": "alice@corp.example", "email_verified": true},
+			code:       "bad-code",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockProvider(t)
+			provider.claims = tt.claims
+
+			users := fakeProvisioner{users: newTestUsers(), subjects: map[string]string{}}
+			_, _ = users.ProvisionUser(context.Background(), ExternalIdentity{Username: "bob@corp.example", Subject: "someone else"})
+			keys, err := NewKeySet([]KeySpec{{PrivateKey: newEd25519(t)}}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier := &UserVerifier{Users: users.users, Clients: testAuthClients}
+			s := NewServer("notes-service", time.Hour, 24*time.Hour, keys, verifier, testAuthClients, newMemoryCodes(), testAPIKeys)
+
+			login, err := NewOIDCLogin(context.Background(), OIDCConfig{
+				IssuerURL:   provider.URL,
+				ClientID:    "notes",
+				RedirectURL: "http://localhost:8080/oauth/oidc/callback",
+			}, s, users)
+			if err != nil {
+				t.Fatalf("NewOIDCLogin() error = %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			login.Login(w, httptest.NewRequest("GET", "/oauth/oidc/login", nil))
+			if w.Code != http.StatusFound {
+				t.Fatalf("login status = %v", w.Code)
+			}
+
+			redirect, _ := url.Parse(w.Header().Get("Location"))
+			query := redirect.Query()
+			provider.nonce = query.Get("nonce")
+			provider.challenge = query.Get("code_challenge")
+			if tt.wrongNonce {
+				provider.nonce = "other"
+			}
+
+			state := query.Get("state")
+			if tt.wrongState {
+				state = "forged"
+			}
+			code := "good-code"
+			if tt.code != "" {
+				code = tt.code
+			}
+
+			req := httptest.NewRequest("GET", "/oauth/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+			for _, c := range w.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			w = httptest.NewRecorder()
+			login.Callback(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("callback status = %v, want %v, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantUser == "" {
+				return
+			}
+
+			var resp struct {
+				Token string `json:"access_token"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := s.ParseAccessToken(resp.Token)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if claims.Subject != tt.wantUser || claims.Scope != ScopeNotesRead+" "+ScopeNotesWrite {
+				t.Errorf("sub = %q, scope = %q", claims.Subject, claims.Scope)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+const PKCEMethodS256 = "S256"
+
+// RFC 7636: 43 to 128 characters of the unreserved set.
+var pkceValue = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+func validPKCEValue(v string) bool {
+	return pkceValue.MatchString(v)
+}
+
+// S256Challenge derives the code challenge for a code verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func verifyPKCE(challenge, verifier string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
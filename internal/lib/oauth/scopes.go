@@ -0,0 +1,78 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/oauth"
+	"net/http"
+	"slices"
+	"strings"
+	"testovoe/internal/lib/problem"
+)
+
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+	ScopeAdmin      = "admin"
+)
+
+var (
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// ScopeGranter decides which scopes a user or client may get. When a
+// verifier implements it, the server narrows every token to those scopes.
+type ScopeGranter interface {
+	AllowedScopes(ctx context.Context, tokenType oauth.TokenType, credential string) ([]string, error)
+}
+
+// ParseScope splits a space-delimited scope string.
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// HasScope reports whether the space-delimited scope contains the wanted one.
+func HasScope(scope, want string) bool {
+	return slices.Contains(ParseScope(scope), want)
+}
+
+// grantScope returns the scope to embed in a token: everything that is
+// allowed when nothing was requested, or the requested scopes when all of
+// them are allowed.
+func grantScope(allowed []string, requested string) (string, error) {
+	wanted := ParseScope(requested)
+	if len(wanted) == 0 {
+		return strings.Join(allowed, " "), nil
+	}
+
+	granted := make([]string, 0, len(wanted))
+	for _, s := range wanted {
+		if !slices.Contains(allowed, s) {
+			return "", fmt.Errorf("%w: %s", ErrInvalidScope, s)
+		}
+		if !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+
+	return strings.Join(granted, " "), nil
+}
+
+// RequireScope lets the request through only when the token verified by
+// Authorize carries the scope.
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted := Scope(r.Context())
+
+			if !HasScope(granted, scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+				problem.Write(w, r, http.StatusForbidden, "insufficient_scope", "insufficient scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
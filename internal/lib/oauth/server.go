@@ -0,0 +1,322 @@
+package oauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/oauth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+const (
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims is the payload of the access and refresh tokens issued by Server.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope     string            `json:"scope,omitempty"`
+	TokenType oauth.TokenType   `json:"token_type"`
+	TokenUse  string            `json:"token_use"`
+	TokenID   string            `json:"tid,omitempty"`
+	ClientID  string            `json:"azp,omitempty"`
+	Actor     *ActorClaim       `json:"act,omitempty"`
+	Extra     map[string]string `json:"claims,omitempty"`
+}
+
+// Server issues JWT bearer tokens signed with the active key of its key
+// set. It implements the same grants as the go-chi/oauth bearer server and
+// drives the same CredentialsVerifier, but its tokens can be verified by
+// anyone holding the published JWKS.
+type Server struct {
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	keys       *KeySet
+	verifier   oauth.CredentialsVerifier
+	clients    ClientStore
+	codes      CodeStore
+	apiKeys    APIKeyVerifier
+}
+
+func NewServer(issuer string, accessTTL, refreshTTL time.Duration, keys *KeySet, verifier oauth.CredentialsVerifier, clients ClientStore, codes CodeStore, apiKeys APIKeyVerifier) *Server {
+	return &Server{
+		issuer:     issuer,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		keys:       keys,
+		verifier:   verifier,
+		clients:    clients,
+		codes:      codes,
+		apiKeys:    apiKeys,
+	}
+}
+
+// UserCredentials manages password, authorization_code and refresh_token
+// grant requests.
+func (s *Server) UserCredentials(w http.ResponseWriter, r *http.Request) {
+	grantType := oauth.GrantType(r.FormValue("grant_type"))
+	scope := r.FormValue("scope")
+
+	switch grantType {
+	case oauth.RefreshTokenGrant:
+		resp, status := s.refresh(r.FormValue("refresh_token"), r)
+		renderJSON(w, resp, status)
+		return
+	case oauth.AuthCodeGrant:
+		resp, status := s.exchangeCode(r)
+		renderJSON(w, resp, status)
+		return
+	}
+
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+	if username == "" || password == "" {
+		var err error
+		username, password, err = oauth.GetBasicAuthentication(r)
+		if err != nil {
+			renderJSON(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if grantType != oauth.PasswordGrant {
+		renderJSON(w, "Invalid grant_type", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.verifier.ValidateUser(username, password, scope, r); err != nil {
+		var locked *LockedError
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", locked.retryAfterSeconds())
+			renderJSON(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		if errors.Is(err, ErrMFARequired) {
+			// the client retries the same request with the otp parameter
+			w.Header().Set("WWW-Authenticate", `Bearer error="mfa_required"`)
+			renderJSON(w, "MFA required: pass the code from the authenticator app as otp", http.StatusUnauthorized)
+			return
+		}
+
+		renderJSON(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp, status := s.issue(oauth.UserToken, username, scope, "", r)
+	renderJSON(w, resp, status)
+}
+
+// ClientCredentials manages client_credentials and refresh_token grant requests.
+func (s *Server) ClientCredentials(w http.ResponseWriter, r *http.Request) {
+	grantType := oauth.GrantType(r.FormValue("grant_type"))
+	scope := r.FormValue("scope")
+
+	if grantType == oauth.RefreshTokenGrant {
+		resp, status := s.refresh(r.FormValue("refresh_token"), r)
+		renderJSON(w, resp, status)
+		return
+	}
+
+	clientID := r.FormValue("client_id")
+	clientSecret := r.FormValue("client_secret")
+	if clientID == "" || clientSecret == "" {
+		var err error
+		clientID, clientSecret, err = oauth.GetBasicAuthentication(r)
+		if err != nil {
+			renderJSON(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if grantType != oauth.ClientCredentialsGrant {
+		renderJSON(w, "Invalid grant_type", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.verifier.ValidateClient(clientID, clientSecret, scope, r); err != nil {
+		renderJSON(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp, status := s.issue(oauth.ClientToken, clientID, scope, clientID, r)
+	renderJSON(w, resp, status)
+}
+
+// JWKS publishes the public keys tokens can be verified with.
+func (s *Server) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	renderJSON(w, s.keys.JWKS(), http.StatusOK)
+}
+
+// ParseAccessToken verifies the signature, issuer and lifetime of an
+// access token and returns its claims.
+func (s *Server) ParseAccessToken(token string) (*Claims, error) {
+	return s.parse(token, tokenUseAccess)
+}
+
+func (s *Server) issue(tokenType oauth.TokenType, credential, scope, clientID string, r *http.Request) (interface{}, int) {
+	if granter, ok := s.verifier.(ScopeGranter); ok {
+		allowed, err := granter.AllowedScopes(r.Context(), tokenType, credential)
+		if err != nil {
+			return "Not authorized", http.StatusUnauthorized
+		}
+
+		if scope, err = grantScope(allowed, scope); err != nil {
+			return "Invalid scope", http.StatusBadRequest
+		}
+	}
+
+	now := time.Now().UTC()
+	tokenID := uuid.NewString()
+	refreshID := uuid.NewString()
+
+	extra, err := s.verifier.AddClaims(tokenType, credential, tokenID, scope, r)
+	if err != nil {
+		return "Token generation failed, check claims", http.StatusInternalServerError
+	}
+
+	access, err := s.sign(Claims{
+		RegisteredClaims: s.registered(tokenID, credential, now, s.accessTTL),
+		Scope:            scope,
+		TokenType:        tokenType,
+		TokenUse:         tokenUseAccess,
+		ClientID:         clientID,
+		Extra:            extra,
+	})
+	if err != nil {
+		return "Token generation failed, check security provider", http.StatusInternalServerError
+	}
+
+	refresh, err := s.sign(Claims{
+		RegisteredClaims: s.registered(refreshID, credential, now, s.refreshTTL),
+		Scope:            scope,
+		TokenType:        tokenType,
+		TokenUse:         tokenUseRefresh,
+		TokenID:          tokenID,
+		ClientID:         clientID,
+	})
+	if err != nil {
+		return "Token generation failed, check security provider", http.StatusInternalServerError
+	}
+
+	if err := s.verifier.StoreTokenID(tokenType, credential, tokenID, refreshID); err != nil {
+		return "Storing Token ID failed", http.StatusInternalServerError
+	}
+
+	props, err := s.verifier.AddProperties(tokenType, credential, tokenID, scope, r)
+	if err != nil {
+		return "Token generation failed, check security provider", http.StatusInternalServerError
+	}
+
+	return &oauth.TokenResponse{
+		Token:        access,
+		RefreshToken: refresh,
+		TokenType:    oauth.BearerToken,
+		ExpiresIn:    int64(s.accessTTL / time.Second),
+		Properties:   props,
+	}, http.StatusOK
+}
+
+func (s *Server) refresh(token string, r *http.Request) (interface{}, int) {
+	claims, err := s.parse(token, tokenUseRefresh)
+	if err != nil {
+		return "Not authorized", http.StatusUnauthorized
+	}
+
+	err = s.verifier.ValidateTokenID(claims.TokenType, claims.Subject, claims.TokenID, claims.ID)
+	if err != nil {
+		return "Not authorized invalid token", http.StatusUnauthorized
+	}
+
+	// a disabled or deleted client can no longer refresh its tokens
+	if claims.ClientID != "" {
+		if _, err := s.clients.GetClient(r.Context(), claims.ClientID); err != nil {
+			return "Not authorized", http.StatusUnauthorized
+		}
+	}
+
+	return s.issue(claims.TokenType, claims.Subject, claims.Scope, claims.ClientID, r)
+}
+
+func (s *Server) registered(id, subject string, now time.Time, ttl time.Duration) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		ID:        id,
+		Issuer:    s.issuer,
+		Subject:   subject,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+}
+
+func (s *Server) sign(claims Claims) (string, error) {
+	key := s.keys.Active()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.private)
+}
+
+func (s *Server) parse(token, use string) (*Claims, error) {
+	const op = "oauth.parse"
+
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, s.keyFunc,
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidToken, err)
+	}
+
+	if claims.TokenUse != use || claims.Subject == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func (s *Server) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := s.keys.Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, ErrAlgorithmMismatch
+	}
+
+	return key.public, nil
+}
+
+// renderJSON mirrors the go-chi/oauth responses so clients see the same
+// bodies as before.
+func renderJSON(w http.ResponseWriter, v interface{}, statusCode int) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(true)
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(buf.Bytes())
+}
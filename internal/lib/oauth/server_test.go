@@ -0,0 +1,513 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/go-chi/oauth"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pemKey(t *testing.T, private any) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func newEd25519(t *testing.T) string {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pemKey(t, private)
+}
+
+func newTestServer(t *testing.T, specs []KeySpec, activeID string) *Server {
+	t.Helper()
+
+	keys, err := NewKeySet(specs, activeID)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	return NewServer("notes-service", time.Hour, 24*time.Hour, keys, &UserVerifier{Users: newTestUsers(), Clients: testAuthClients}, testAuthClients, newMemoryCodes(), testAPIKeys)
+}
+
+func requestToken(t *testing.T, s *Server, form url.Values) oauth.TokenResponse {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.UserCredentials(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("token status = %v, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp oauth.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func authorizeStatus(s *Server, token string) (int, string) {
+	var credential string
+
+	h := s.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential, _ = Credential(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/get-notes", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w.Code, credential
+}
+
+func TestServer_PasswordGrant(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{ID: "k1", PrivateKey: newEd25519(t)}}, "")
+
+	resp := requestToken(t, s, url.Values{
+		"grant_type": {"password"},
+		"username":   {"user1"},
+		"password":   {"password1"},
+	})
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(resp.Token, &Claims{})
+	if err != nil {
+		t.Fatalf("access token is not a JWT: %v", err)
+	}
+	if parsed.Header["kid"] != "k1" || parsed.Header["alg"] != AlgEdDSA {
+		t.Errorf("header = %v", parsed.Header)
+	}
+
+	if code, credential := authorizeStatus(s, resp.Token); code != http.StatusOK || credential != "user1" {
+		t.Errorf("Authorize() = %v, %q, want 200, user1", code, credential)
+	}
+
+	if code, _ := authorizeStatus(s, resp.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh token accepted as access token, status = %v", code)
+	}
+
+	refreshed := requestToken(t, s, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {resp.RefreshToken},
+	})
+	if code, credential := authorizeStatus(s, refreshed.Token); code != http.StatusOK || credential != "user1" {
+		t.Errorf("refreshed Authorize() = %v, %q, want 200, user1", code, credential)
+	}
+}
+
+func TestServer_WrongPassword(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	form := url.Values{"grant_type": {"password"}, "username": {"user1"}, "password": {"nope"}}
+	req := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.UserCredentials(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %v, want 401", w.Code)
+	}
+}
+
+func TestServer_ClientCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientID   string
+		secret     string
+		wantStatus int
+	}{
+		{name: "registered client", clientID: "service", secret: "s3cret", wantStatus: http.StatusOK},
+		{name: "wrong secret", clientID: "service", secret: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "grant not allowed", clientID: "backend", secret: "s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "public client", clientID: "web", secret: "", wantStatus: http.StatusUnauthorized},
+		{name: "unknown client", clientID: "abcdef", secret: "12345", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+			form := url.Values{"grant_type": {"client_credentials"}}
+			req := httptest.NewRequest("POST", "/auth", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth(tt.clientID, tt.secret)
+			w := httptest.NewRecorder()
+
+			s.ClientCredentials(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp oauth.TokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := s.ParseAccessToken(resp.Token)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if claims.Subject != tt.clientID || claims.Scope != ScopeNotesRead {
+				t.Errorf("sub = %q, scope = %q", claims.Subject, claims.Scope)
+			}
+		})
+	}
+}
+
+type fakeAPIKeys map[string][2]string
+
+func (f fakeAPIKeys) VerifyAPIKey(ctx context.Context, key string) (string, string, error) {
+	k, ok := f[key]
+	if !ok {
+		return "", "", errors.New("unknown key")
+	}
+
+	return k[0], k[1], nil
+}
+
+var testAPIKeys = fakeAPIKeys{"nsk_readonly": {"user1", ScopeNotesRead}}
+
+func TestServer_AuthorizeAPIKey(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		scope      string
+		wantStatus int
+	}{
+		{name: "X-API-Key header", header: "X-API-Key", value: "nsk_readonly", scope: ScopeNotesRead, wantStatus: http.StatusOK},
+		{name: "bearer", header: "Authorization", value: "Bearer nsk_readonly", scope: ScopeNotesRead, wantStatus: http.StatusOK},
+		{name: "unknown key", header: "X-API-Key", value: "nsk_nope", scope: ScopeNotesRead, wantStatus: http.StatusUnauthorized},
+		{name: "scope not on key", header: "X-API-Key", value: "nsk_readonly", scope: ScopeNotesWrite, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var credential string
+			h := s.Authorize(RequireScope(tt.scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				credential, _ = Credential(r.Context())
+			})))
+
+			req := httptest.NewRequest("GET", "/get-notes", nil)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && credential != "user1" {
+				t.Errorf("credential = %q, want user1", credential)
+			}
+		})
+	}
+}
+
+type fakeMFA string
+
+func (f fakeMFA) CheckMFA(ctx context.Context, username, code string) error {
+	switch code {
+	case "":
+		return ErrMFARequired
+	case string(f):
+		return nil
+	default:
+		return ErrInvalidMFACode
+	}
+}
+
+func TestServer_PasswordGrantMFA(t *testing.T) {
+	keys, err := NewKeySet([]KeySpec{{PrivateKey: newEd25519(t)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &UserVerifier{Users: newTestUsers(), Clients: testAuthClients, MFA: fakeMFA("123456")}
+	s := NewServer("notes-service", time.Hour, 24*time.Hour, keys, verifier, testAuthClients, newMemoryCodes(), testAPIKeys)
+
+	tests := []struct {
+		name       string
+		otp        string
+		wantStatus int
+		wantHeader string
+	}{
+		{name: "missing code", wantStatus: http.StatusUnauthorized, wantHeader: `Bearer error="mfa_required"`},
+		{name: "wrong code", otp: "000000", wantStatus: http.StatusUnauthorized},
+		{name: "valid code", otp: "123456", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"grant_type": {"password"}, "username": {"user1"}, "password": {"password1"}, "otp": {tt.otp}}
+			req := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			s.UserCredentials(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.wantHeader {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+type lockedGuard struct{}
+
+func (lockedGuard) CheckLogin(ctx context.Context, username, ip string) error {
+	return &LockedError{RetryAfter: 1500 * time.Millisecond}
+}
+
+func (lockedGuard) LoginFailed(ctx context.Context, username, ip string) {}
+
+func (lockedGuard) LoginSucceeded(ctx context.Context, username, ip string) {}
+
+func TestServer_PasswordGrantLocked(t *testing.T) {
+	keys, err := NewKeySet([]KeySpec{{PrivateKey: newEd25519(t)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &UserVerifier{Users: newTestUsers(), Clients: testAuthClients, Guard: lockedGuard{}}
+	s := NewServer("notes-service", time.Hour, 24*time.Hour, keys, verifier, testAuthClients, newMemoryCodes(), testAPIKeys)
+
+	form := url.Values{"grant_type": {"password"}, "username": {"user1"}, "password": {"password1"}}
+	req := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.UserCredentials(w, req)
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("status = %v, Retry-After = %q, want 429, 2", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestServer_KeyRotation(t *testing.T) {
+	oldKey := newEd25519(t)
+	newKey := newEd25519(t)
+
+	before := newTestServer(t, []KeySpec{{ID: "old", PrivateKey: oldKey}}, "old")
+	token := requestToken(t, before, url.Values{
+		"grant_type": {"password"}, "username": {"user1"}, "password": {"password1"},
+	}).Token
+
+	during := newTestServer(t, []KeySpec{{ID: "old", PrivateKey: oldKey}, {ID: "new", PrivateKey: newKey}}, "new")
+	if code, _ := authorizeStatus(during, token); code != http.StatusOK {
+		t.Errorf("token signed with the previous key rejected, status = %v", code)
+	}
+
+	after := newTestServer(t, []KeySpec{{ID: "new", PrivateKey: newKey}}, "new")
+	if code, _ := authorizeStatus(after, token); code != http.StatusUnauthorized {
+		t.Errorf("token signed with a removed key accepted, status = %v", code)
+	}
+}
+
+func TestServer_RejectsForgedTokens(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{ID: "k1", PrivateKey: newEd25519(t)}}, "")
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "admin",
+			Issuer:    "notes-service",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		TokenUse: tokenUseAccess,
+	})
+	unsigned.Header["kid"] = "k1"
+	none, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{"alg none": none, "garbage": "abc.def.ghi"} {
+		if code, _ := authorizeStatus(s, token); code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %v, want 401", name, code)
+		}
+	}
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeySet([]KeySpec{
+		{ID: "rsa", PrivateKey: pemKey(t, rsaKey)},
+		{PrivateKey: newEd25519(t)},
+	}, "rsa")
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("len(keys) = %d, want 2", len(set.Keys))
+	}
+
+	if k := set.Keys[0]; k.KeyType != "RSA" || k.Algorithm != AlgRS256 || k.N == "" || k.E != "AQAB" {
+		t.Errorf("RSA JWK = %+v", k)
+	}
+	if k := set.Keys[1]; k.KeyType != "OKP" || k.Curve != "Ed25519" || k.Algorithm != AlgEdDSA || k.KeyID == "" {
+		t.Errorf("Ed25519 JWK = %+v", k)
+	}
+
+	if _, err := NewKeySet([]KeySpec{{ID: "rsa", Algorithm: AlgEdDSA, PrivateKey: pemKey(t, rsaKey)}}, ""); err == nil {
+		t.Errorf("NewKeySet() accepted a key with a mismatching algorithm")
+	}
+}
+
+func TestServer_Scopes(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	tests := []struct {
+		name      string
+		scope     string
+		wantCode  int
+		wantScope string
+	}{
+		{name: "Default Scopes", scope: "", wantCode: http.StatusOK, wantScope: "notes:read notes:write"},
+		{name: "Read Only", scope: "notes:read", wantCode: http.StatusOK, wantScope: "notes:read"},
+		{name: "Not Allowed", scope: "notes:read admin", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"grant_type": {"password"}, "username": {"user1"}, "password": {"password1"}, "scope": {tt.scope}}
+			req := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			s.UserCredentials(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp oauth.TokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := s.ParseAccessToken(resp.Token)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if claims.Scope != tt.wantScope {
+				t.Errorf("scope = %q, want %q", claims.Scope, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	readOnly := requestToken(t, s, url.Values{
+		"grant_type": {"password"}, "username": {"user1"}, "password": {"password1"}, "scope": {"notes:read"},
+	}).Token
+
+	h := s.Authorize(RequireScope(ScopeNotesWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	req := httptest.NewRequest("POST", "/add-note", nil)
+	req.Header.Set("Authorization", "Bearer "+readOnly)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %v, want 403", w.Code)
+	}
+	if !strings.Contains(w.Header().Get("WWW-Authenticate"), "insufficient_scope") {
+		t.Errorf("WWW-Authenticate = %q", w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestRequireInteractive(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	userToken := requestToken(t, s, url.Values{
+		"grant_type": {"password"}, "username": {"user1"}, "password": {"password1"},
+	}).Token
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req := httptest.NewRequest("POST", "/auth", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("service", "s3cret")
+	w := httptest.NewRecorder()
+	s.ClientCredentials(w, req)
+
+	var clientToken oauth.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &clientToken); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{name: "user token", header: "Authorization", value: "Bearer " + userToken, wantStatus: http.StatusCreated},
+		{name: "client token", header: "Authorization", value: "Bearer " + clientToken.Token, wantStatus: http.StatusForbidden},
+		{name: "API key", header: "X-API-Key", value: "nsk_readonly", wantStatus: http.StatusForbidden},
+		{name: "API key as bearer", header: "Authorization", value: "Bearer nsk_readonly", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := s.Authorize(RequireInteractive(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			})))
+
+			req := httptest.NewRequest("POST", "/api-keys", nil)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
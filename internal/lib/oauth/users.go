@@ -0,0 +1,149 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/oauth"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/problem"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserDisabled = errors.New("user is disabled")
+
+	errNotAuthorized    = apperr.Unauthorized("unauthorized", "not authorized")
+	errAccountDisabled  = apperr.Unauthorized("account_disabled", "account is disabled")
+	errInsufficientRole = apperr.Forbidden("insufficient_role", "insufficient role")
+)
+
+var roleScopes = map[string][]string{
+	RoleUser:  {ScopeNotesRead, ScopeNotesWrite},
+	RoleAdmin: {ScopeNotesRead, ScopeNotesWrite, ScopeAdmin},
+}
+
+// User is what authentication needs to know about a user. External users
+// (signed in through OIDC) have no password.
+type User struct {
+	Username     string
+	PasswordHash string
+	Role         string
+	Disabled     bool
+}
+
+type UserStore interface {
+	GetUser(ctx context.Context, username string) (User, error)
+}
+
+// ValidRole reports whether the role is known.
+func ValidRole(role string) bool {
+	_, ok := roleScopes[role]
+
+	return ok
+}
+
+// RoleScopes returns the scopes a user with the role may get.
+func RoleScopes(role string) []string {
+	return roleScopes[role]
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// dummyHash is compared against when the user does not exist, so that
+// unknown usernames take as long to reject as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func checkPassword(hash, password string) bool {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// AccessControl enforces user status and roles on top of Authorize, which
+// only proves the token is valid. Both look the user up on every request,
+// so disabling an account or taking a role away applies to tokens that
+// were already issued.
+type AccessControl struct {
+	users UserStore
+}
+
+func NewAccessControl(users UserStore) *AccessControl {
+	return &AccessControl{
+		users: users,
+	}
+}
+
+// RequireActive rejects requests of disabled users. Client tokens are
+// not tied to a user and pass through.
+func (a *AccessControl) RequireActive(next http.Handler) http.Handler {
+	return a.RequireRole()(next)
+}
+
+// RequireRole lets the request through only when the user is active and
+// has one of the roles; without roles any active user passes.
+func (a *AccessControl) RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := a.checkRole(r.Context(), roles...); err != nil {
+				problem.Error(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CheckActive is RequireActive for transports other than HTTP.
+func (a *AccessControl) CheckActive(ctx context.Context) error {
+	return a.checkRole(ctx)
+}
+
+func (a *AccessControl) checkRole(ctx context.Context, roles ...string) error {
+	if tokenType, _ := ctx.Value(oauth.TokenTypeContext).(oauth.TokenType); tokenType == oauth.ClientToken && len(roles) == 0 {
+		return nil
+	}
+
+	username, ok := Credential(ctx)
+	if !ok {
+		return errNotAuthorized
+	}
+
+	user, err := a.users.GetUser(ctx, username)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.Error("failed to get user", slog.String("error", err.Error()))
+		}
+
+		return errNotAuthorized
+	}
+
+	if user.Disabled {
+		return errAccountDisabled
+	}
+
+	if len(roles) > 0 && !slices.Contains(roles, user.Role) {
+		return errInsufficientRole
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package oauth
+
+import (
+	"context"
+	"github.com/go-chi/oauth"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type memoryUsers map[string]User
+
+func (m memoryUsers) GetUser(ctx context.Context, username string) (User, error) {
+	user, ok := m[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func testHash(password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(hash)
+}
+
+// newTestUsers returns the users the tests sign in with: user1/password1
+// and admin/admin.
+func newTestUsers() memoryUsers {
+	return memoryUsers{
+		"user1": {Username: "user1", PasswordHash: testHash("password1"), Role: RoleUser},
+		"admin": {Username: "admin", PasswordHash: testHash("admin"), Role: RoleAdmin},
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	users := newTestUsers()
+	users["blocked"] = User{Username: "blocked", PasswordHash: testHash("password1"), Role: RoleUser, Disabled: true}
+	users["external"] = User{Username: "external", Role: RoleUser}
+	verifier := &UserVerifier{Users: users}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{name: "valid", username: "user1", password: "password1"},
+		{name: "wrong password", username: "user1", password: "password2", wantErr: true},
+		{name: "unknown user", username: "nobody", password: "password1", wantErr: true},
+		{name: "disabled", username: "blocked", password: "password1", wantErr: true},
+		// у внешних пользователей нет пароля
+		{name: "external user", username: "external", password: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.ValidateUser(tt.username, tt.password, "", httptest.NewRequest("POST", "/token", nil))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	users := newTestUsers()
+	users["blocked"] = User{Username: "blocked", Role: RoleAdmin, Disabled: true}
+	access := NewAccessControl(users)
+
+	tests := []struct {
+		name       string
+		credential string
+		tokenType  oauth.TokenType
+		roles      []string
+		wantStatus int
+	}{
+		{name: "admin", credential: "admin", tokenType: oauth.UserToken, roles: []string{RoleAdmin}, wantStatus: http.StatusOK},
+		{name: "user is not admin", credential: "user1", tokenType: oauth.UserToken, roles: []string{RoleAdmin}, wantStatus: http.StatusForbidden},
+		{name: "disabled admin", credential: "blocked", tokenType: oauth.UserToken, roles: []string{RoleAdmin}, wantStatus: http.StatusUnauthorized},
+		{name: "deleted user", credential: "nobody", tokenType: oauth.UserToken, wantStatus: http.StatusUnauthorized},
+		{name: "active user", credential: "user1", tokenType: oauth.UserToken, wantStatus: http.StatusOK},
+		{name: "client token", credential: "backend", tokenType: oauth.ClientToken, wantStatus: http.StatusOK},
+		{name: "client token without role", credential: "backend", tokenType: oauth.ClientToken, roles: []string{RoleAdmin}, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := access.RequireRole(tt.roles...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest("GET", "/admin/users", nil)
+			ctx := context.WithValue(req.Context(), oauth.CredentialContext, tt.credential)
+			ctx = context.WithValue(ctx, oauth.TokenTypeContext, tt.tokenType)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestImpersonate(t *testing.T) {
+	s := newTestServer(t, []KeySpec{{PrivateKey: newEd25519(t)}}, "")
+
+	resp, err := s.Impersonate("admin", "user1", ScopeNotesRead)
+	if err != nil {
+		t.Fatalf("Impersonate() error = %v", err)
+	}
+
+	if resp.RefreshToken != "" {
+		t.Error("impersonation token must not come with a refresh token")
+	}
+	if resp.ExpiresIn > int64(maxImpersonationTTL.Seconds()) {
+		t.Errorf("ExpiresIn = %v", resp.ExpiresIn)
+	}
+
+	var actor string
+	var credential string
+	h := s.Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential, _ = Credential(r.Context())
+		actor, _ = ImpersonatedBy(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/get-notes", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if credential != "user1" || actor != "admin" {
+		t.Errorf("credential = %q, actor = %q", credential, actor)
+	}
+
+	w := httptest.NewRecorder()
+	h = s.Authorize(RejectImpersonation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("RejectImpersonation status = %v", w.Code)
+	}
+}
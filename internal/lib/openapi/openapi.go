@@ -0,0 +1,206 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/go-chi/chi/v5"
+	"mime"
+	"net/http"
+	"strings"
+	"testovoe/internal/lib/problem"
+)
+
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRequestTooLarge      = "request_too_large"
+)
+
+// MaxBodySize bounds the JSON bodies Validate reads into memory. The
+// largest one an operation takes is a JSON import.
+const MaxBodySize = 32 << 20
+
+// Spec is a loaded OpenAPI document.
+type Spec struct {
+	doc         *openapi3.T
+	json        []byte
+	maxBodySize int64
+}
+
+// Load parses and validates the document.
+func Load(data []byte) (*Spec, error) {
+	const op = "openapi.Load"
+
+	loader := openapi3.NewLoader()
+
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Spec{
+		doc:         doc,
+		json:        raw,
+		maxBodySize: MaxBodySize,
+	}, nil
+}
+
+// Operation returns the documented operation for a chi route pattern.
+func (s *Spec) Operation(method, pattern string) (*openapi3.PathItem, *openapi3.Operation) {
+	pathItem := s.doc.Paths.Value(pattern)
+	if pathItem == nil {
+		return nil, nil
+	}
+
+	return pathItem, pathItem.GetOperation(method)
+}
+
+// ServeJSON serves the document as JSON.
+func (s *Spec) ServeJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, _ = w.Write(s.json)
+}
+
+// Validate rejects requests whose parameters or JSON body do not match the
+// documented operation, and with 415 bodies in a media type the operation
+// does not declare. It looks the operation up by the chi route pattern, so
+// like the rate limiter it belongs inside a group, where the pattern is
+// complete. Bodies over MaxBodySize get a 413. Authorization is left to the
+// auth middleware, and routes missing from the document pass through.
+func (s *Spec) Validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx := chi.RouteContext(r.Context())
+		pattern := rctx.RoutePattern()
+
+		pathItem, operation := s.Operation(r.Method, pattern)
+		if operation == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		validateBody, ok := checkMediaType(operation, r)
+		if !ok {
+			problem.Write(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+				fmt.Sprintf("content type %q is not accepted here", r.Header.Get("Content-Type")))
+			return
+		}
+
+		if validateBody {
+			r.Body = http.MaxBytesReader(w, r.Body, s.maxBodySize)
+		}
+
+		params := make(map[string]string, len(rctx.URLParams.Keys))
+		for i, key := range rctx.URLParams.Keys {
+			params[key] = rctx.URLParams.Values[i]
+		}
+
+		err := openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route: &routers.Route{
+				Spec:      s.doc,
+				Path:      pattern,
+				PathItem:  pathItem,
+				Method:    r.Method,
+				Operation: operation,
+			},
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: !validateBody,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		})
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(w, r, http.StatusRequestEntityTooLarge, CodeRequestTooLarge,
+				fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit))
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, CodeInvalidRequest, describe(err))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// describe turns a validation error into a short message without the
+// schema dump kin-openapi adds to its errors.
+func describe(err error) string {
+	var where string
+
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.Parameter != nil:
+			where = fmt.Sprintf("parameter %q", reqErr.Parameter.Name)
+		case reqErr.RequestBody != nil:
+			where = "request body"
+		}
+	}
+
+	reason := err.Error()
+	var schemaErr *openapi3.SchemaError
+	switch {
+	case errors.As(err, &schemaErr):
+		reason = schemaErr.Reason
+		if ptr := schemaErr.JSONPointer(); len(ptr) > 0 {
+			reason = fmt.Sprintf("/%s: %s", strings.Join(ptr, "/"), reason)
+		}
+	case reqErr != nil && reqErr.Err != nil:
+		reason = reqErr.Err.Error()
+	case reqErr != nil && reqErr.Reason != "":
+		reason = reqErr.Reason
+	}
+
+	if where == "" {
+		return reason
+	}
+
+	return where + ": " + reason
+}
+
+// checkMediaType reports whether the body of r is JSON to validate against
+// the operation, and false for ok when its content type is not one the
+// operation declares. Bodies in other declared media types, such as
+// archives and ENEX files, are left to the handler.
+func checkMediaType(operation *openapi3.Operation, r *http.Request) (validate, ok bool) {
+	if operation.RequestBody == nil || operation.RequestBody.Value == nil {
+		return false, true
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" && r.ContentLength == 0 {
+		// a missing required body is reported by the validator
+		return true, true
+	}
+
+	if operation.RequestBody.Value.Content.Get(contentType) == nil {
+		return false, false
+	}
+
+	return isJSON(contentType), true
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
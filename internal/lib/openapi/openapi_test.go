@@ -0,0 +1,216 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testovoe/api"
+	"testovoe/internal/lib/problem"
+)
+
+func TestLoad(t *testing.T) {
+	spec, err := Load(api.Spec)
+	if err != nil {
+		t.Fatalf("failed to load the document: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	spec.ServeJSON(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("document is not JSON: %v", err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec, err := Load(api.Spec)
+	if err != nil {
+		t.Fatalf("failed to load the document: %v", err)
+	}
+
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(spec.Validate)
+		r.Post("/add-note", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		})
+		r.Get("/notes/sync", func(w http.ResponseWriter, r *http.Request) {})
+		r.Post("/notes/import", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})
+		r.Get("/undocumented", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		contentType  string
+		body         string
+		expectedCode int
+		expectedMsg  string
+	}{
+		{
+			name:         "Valid Body",
+			method:       http.MethodPost,
+			target:       "/add-note",
+			contentType:  "application/json",
+			body:         `{"content": "hello"}`,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "Missing Field",
+			method:       http.MethodPost,
+			target:       "/add-note",
+			contentType:  "application/json",
+			body:         `{}`,
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "content",
+		},
+		{
+			name:         "Wrong Type",
+			method:       http.MethodPost,
+			target:       "/add-note",
+			contentType:  "application/json",
+			body:         `{"content": 42}`,
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "/content",
+		},
+		{
+			name:         "Invalid Query Parameter",
+			method:       http.MethodGet,
+			target:       "/notes/sync?limit=many",
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  `parameter "limit"`,
+		},
+		{
+			// архивы проверяет импорт, а не схема
+			name:         "Binary Body Is Not Validated",
+			method:       http.MethodPost,
+			target:       "/notes/import?format=zip",
+			contentType:  "application/zip",
+			body:         "PK",
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "JSON Body Sent As Text",
+			method:       http.MethodPost,
+			target:       "/add-note",
+			contentType:  "text/plain",
+			body:         `{"content": 42}`,
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			// без Content-Type тело не должно уходить мимо схемы
+			name:         "JSON Body Without Content Type",
+			method:       http.MethodPost,
+			target:       "/add-note",
+			body:         `{"content": 42}`,
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:         "Missing Body",
+			method:       http.MethodPost,
+			target:       "/add-note",
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "request body",
+		},
+		{
+			name:         "Declared XML Body Is Not Validated",
+			method:       http.MethodPost,
+			target:       "/notes/import?format=enex",
+			contentType:  "application/xml; charset=utf-8",
+			body:         "<en-export/>",
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "Undeclared Binary Body",
+			method:       http.MethodPost,
+			target:       "/notes/import?format=zip",
+			contentType:  "application/octet-stream",
+			body:         "PK",
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:         "Undocumented Route",
+			method:       http.MethodGet,
+			target:       "/undocumented?limit=many",
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("status = %v, want %v, body = %s", w.Code, tt.expectedCode, w.Body.String())
+			}
+
+			wantCode := map[int]string{
+				http.StatusBadRequest:           CodeInvalidRequest,
+				http.StatusUnsupportedMediaType: CodeUnsupportedMediaType,
+			}[tt.expectedCode]
+			if wantCode == "" {
+				return
+			}
+
+			var details problem.Details
+			if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+			if details.Code != wantCode || !strings.Contains(details.Detail, tt.expectedMsg) {
+				t.Errorf("problem = %+v, want detail mentioning %q", details, tt.expectedMsg)
+			}
+		})
+	}
+}
+
+func TestValidate_BodyTooLarge(t *testing.T) {
+	spec, err := Load(api.Spec)
+	if err != nil {
+		t.Fatalf("failed to load the document: %v", err)
+	}
+	// чтобы не собирать в тесте тело на 32 МБ
+	spec.maxBodySize = 64
+
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(spec.Validate)
+		r.Post("/add-note", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		})
+	})
+
+	body := `{"content": "` + strings.Repeat("a", 100) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/add-note", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %v, want %v, body = %s", w.Code, http.StatusRequestEntityTooLarge, w.Body.String())
+	}
+
+	var details problem.Details
+	if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	if details.Code != CodeRequestTooLarge {
+		t.Errorf("code = %q, want %q", details.Code, CodeRequestTooLarge)
+	}
+}
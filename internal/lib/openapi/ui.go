@@ -0,0 +1,37 @@
+package openapi
+
+import (
+	"fmt"
+	swaggerFiles "github.com/swaggo/files/v2"
+	"net/http"
+	"strings"
+)
+
+const initializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: %q,
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// UI serves the embedded Swagger UI under prefix, pointed at the document
+// served at specURL.
+func UI(prefix, specURL string) http.Handler {
+	files := http.StripPrefix(prefix, http.FileServer(http.FS(swaggerFiles.FS)))
+	script := []byte(fmt.Sprintf(initializer, specURL))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, prefix) == "/swagger-initializer.js" {
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			_, _ = w.Write(script)
+			return
+		}
+
+		files.ServeHTTP(w, r)
+	})
+}
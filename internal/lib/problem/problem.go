@@ -0,0 +1,96 @@
+package problem
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+)
+
+// ContentType is the media type of RFC 7807 problem details.
+const ContentType = "application/problem+json"
+
+const CodeInternal = "internal_error"
+
+var (
+	ErrInvalidJSON  = apperr.Validation("invalid_json", "request body is not valid JSON")
+	ErrUnauthorized = apperr.Unauthorized("unauthorized", "authentication required")
+	ErrInvalidToken = apperr.Unauthorized("invalid_token", "invalid token")
+)
+
+// Details is an RFC 7807 problem with two extension members: a stable
+// machine readable code and the ID of the request for support.
+type Details struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+var statuses = map[apperr.Kind]int{
+	apperr.KindValidation:   http.StatusBadRequest,
+	apperr.KindUnauthorized: http.StatusUnauthorized,
+	apperr.KindForbidden:    http.StatusForbidden,
+	apperr.KindNotFound:     http.StatusNotFound,
+	apperr.KindConflict:     http.StatusConflict,
+	apperr.KindUnavailable:  http.StatusServiceUnavailable,
+}
+
+// Status returns the HTTP status for err.
+func Status(err error) int {
+	if e, ok := apperr.As(err); ok {
+		if status, ok := statuses[e.Kind]; ok {
+			return status
+		}
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Error writes err as a problem. Domain errors keep their code and message;
+// anything else is logged and reported as a bare internal error, so
+// internals do not leak to clients.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	status := Status(err)
+
+	e, ok := apperr.As(err)
+	if !ok || status == http.StatusInternalServerError {
+		logger.FromContext(r.Context(), slog.Default()).ErrorContext(r.Context(), "request failed",
+			slog.String("error", err.Error()),
+		)
+		Write(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if status == http.StatusServiceUnavailable {
+		logger.FromContext(r.Context(), slog.Default()).WarnContext(r.Context(), "dependency unavailable",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	Write(w, r, status, e.Code, e.Message)
+}
+
+// Write writes a problem with the given status, code and detail.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+	if err != nil {
+		return
+	}
+}
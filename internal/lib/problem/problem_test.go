@@ -0,0 +1,102 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testovoe/internal/lib/apperr"
+)
+
+func TestError(t *testing.T) {
+	errNotFound := apperr.NotFound("note_not_found", "note not found")
+	errInvalid := apperr.Validation("invalid_client", "invalid client")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{
+			name:       "Wrapped Domain Error",
+			err:        fmt.Errorf("notesService.GetNote: %w", errNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   "note_not_found",
+			wantDetail: "note not found",
+		},
+		{
+			name:       "Detailed Domain Error",
+			err:        errInvalid.Detailf("name is required"),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_client",
+			wantDetail: "name is required",
+		},
+		{
+			name:       "Unavailable Upstream",
+			err:        fmt.Errorf("check: %w: %w", apperr.Unavailable("speller_unavailable", "spell checker is unavailable"), errors.New("dial tcp: timeout")),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "speller_unavailable",
+			wantDetail: "spell checker is unavailable",
+		},
+		{
+			// внутренние ошибки не должны попадать в ответ
+			name:       "Internal Error",
+			err:        errors.New("pq: password authentication failed"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   CodeInternal,
+			wantDetail: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/notes/1", nil)
+			var reqID string
+			middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				reqID = middleware.GetReqID(req.Context())
+				r = req
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			w := httptest.NewRecorder()
+			Error(w, r, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentType {
+				t.Errorf("content type = %v, want %v", ct, ContentType)
+			}
+
+			var got Details
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+
+			if got.Status != tt.wantStatus || got.Code != tt.wantCode || got.Detail != tt.wantDetail {
+				t.Errorf("problem = %+v", got)
+			}
+			if got.RequestID == "" || got.RequestID != reqID {
+				t.Errorf("request id = %q, want %q", got.RequestID, reqID)
+			}
+			if got.Instance != "/notes/1" {
+				t.Errorf("instance = %q", got.Instance)
+			}
+		})
+	}
+}
+
+func TestDetailfMatchesSentinel(t *testing.T) {
+	sentinel := apperr.Validation("invalid_api_key", "invalid api key")
+
+	if !errors.Is(fmt.Errorf("create: %w", sentinel.Detailf("name is required")), sentinel) {
+		t.Errorf("detailed error does not match its sentinel")
+	}
+	if errors.Is(sentinel, apperr.Validation("invalid_client", "invalid client")) {
+		t.Errorf("errors with different codes match")
+	}
+}
@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/problem"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Burst requests and refills at
+// Rate requests per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerPeriod builds the limit allowing requests per period on average.
+func PerPeriod(requests int, period time.Duration, burst int) Limit {
+	if burst < 1 {
+		burst = requests
+	}
+
+	return Limit{
+		Rate:  float64(requests) / period.Seconds(),
+		Burst: burst,
+	}
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Result describes the bucket after a request took (or failed to take) a
+// token from it.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Store keeps the buckets. MemoryStore is enough for a single instance;
+// instances sharing limits need a store backed by the database.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result turns the tokens left in a bucket into a Result.
+func result(limit Limit, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+// Limiter applies the limit of the matched route, or the default one, to
+// every caller separately. Routes are keyed by method and chi pattern, as
+// in "POST /api/v1/notes", or by the route set with CountAs.
+type Limiter struct {
+	log    *slog.Logger
+	store  Store
+	def    Limit
+	routes map[string]Limit
+}
+
+func New(log *slog.Logger, store Store, def Limit, routes map[string]Limit) *Limiter {
+	return &Limiter{
+		log:    log,
+		store:  store,
+		def:    def,
+		routes: routes,
+	}
+}
+
+// Middleware must run after oauth Authorize, so that callers are told apart
+// by their token, and inside a chi group, so that the route pattern is
+// already known. When the store fails, requests are let through.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+
+		limit, res, err := l.Allow(r.Context(), route, callerKey(r))
+		if err != nil || limit.Unlimited() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(res.Reset/time.Second)))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter/time.Second)))
+			problem.Write(w, r, http.StatusTooManyRequests, "rate_limited", "too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allow takes a token from the caller's bucket of route, for the servers
+// that are not HTTP. Routes without a limit of their own get the default
+// one; when the limit is unlimited nothing is taken. Errors of the store
+// are logged, and the caller is expected to let the request through.
+func (l *Limiter) Allow(ctx context.Context, route, caller string) (Limit, Result, error) {
+	limit, ok := l.routes[route]
+	if !ok {
+		limit = l.def
+	}
+
+	if limit.Unlimited() {
+		return limit, Result{Allowed: true}, nil
+	}
+
+	res, err := l.store.Take(ctx, route+" "+caller, limit)
+	if err != nil {
+		l.log.Error("rate limiter failed", slog.String("route", route), slog.String("error", err.Error()))
+		return limit, Result{}, err
+	}
+
+	return limit, res, nil
+}
+
+type routeKey struct{}
+
+// CountAs makes the limiter count requests against the route name returns,
+// given as method and pattern like the limits, instead of the one they
+// matched. Aliases of a route use it to share the route's limit and
+// buckets. Like the limiter it belongs inside a group, in front of it.
+func CountAs(name func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), routeKey{}, name(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Caller is the key of the user or client a verified token was issued to,
+// which requests count against. Anonymous callers are told apart by their
+// address instead.
+func Caller(ctx context.Context) (string, bool) {
+	credential, ok := oa.Credential(ctx)
+	if !ok {
+		return "", false
+	}
+
+	if tokenType, _ := ctx.Value(oauth.TokenTypeContext).(oauth.TokenType); tokenType == oauth.ClientToken {
+		return "client:" + credential, true
+	}
+
+	return "user:" + credential, true
+}
+
+func routeOf(r *http.Request) string {
+	if route, ok := r.Context().Value(routeKey{}).(string); ok {
+		return route
+	}
+
+	return r.Method + " " + chi.RouteContext(r.Context()).RoutePattern()
+}
+
+// callerKey identifies who the request counts against: the user or the
+// client the token was issued to, or the address of anonymous callers.
+func callerKey(r *http.Request) string {
+	if caller, ok := Caller(r.Context()); ok {
+		return caller
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RealIP stores a bare address, without the port
+		return "ip:" + r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	now := time.Date(2024, 10, 20, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := PerPeriod(60, time.Minute, 2)
+
+	tests := []struct {
+		name          string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "first", wantAllowed: true, wantRemaining: 1},
+		{name: "burst", wantAllowed: true, wantRemaining: 0},
+		{name: "empty", wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+		// за секунду набегает один токен
+		{name: "refilled", advance: time.Second, wantAllowed: true, wantRemaining: 0},
+		{name: "capped at burst", advance: time.Hour, wantAllowed: true, wantRemaining: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+
+			res, err := store.Take(context.Background(), "user:user1", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Allowed != tt.wantAllowed || res.Remaining != tt.wantRemaining || res.RetryAfter != tt.wantRetry {
+				t.Errorf("Take() = %+v, want allowed %v, remaining %v, retry %v", res, tt.wantAllowed, tt.wantRemaining, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	limiter := New(slog.New(slog.NewTextHandler(io.Discard, nil)), NewMemoryStore(), PerPeriod(100, time.Minute, 100), map[string]Limit{
+		"POST /add-note": PerPeriod(1, time.Minute, 1),
+	})
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(limiter.Middleware)
+		r.Post("/add-note", func(w http.ResponseWriter, r *http.Request) {})
+		r.Get("/get-notes", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	send := func(method, path, credential string, tokenType oauth.TokenType) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if credential != "" {
+			ctx := context.WithValue(req.Context(), oauth.CredentialContext, credential)
+			ctx = context.WithValue(ctx, oauth.TokenTypeContext, tokenType)
+			req = req.WithContext(ctx)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	if w := send("POST", "/add-note", "user1", oauth.UserToken); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %v", w.Code)
+	}
+
+	w := send("POST", "/add-note", "user1", oauth.UserToken)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %v", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "60" || w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("headers = %v", w.Header())
+	}
+
+	// other callers and routes have their own buckets
+	if w := send("POST", "/add-note", "user2", oauth.UserToken); w.Code != http.StatusOK {
+		t.Errorf("other user status = %v", w.Code)
+	}
+	if w := send("POST", "/add-note", "user1", oauth.ClientToken); w.Code != http.StatusOK {
+		t.Errorf("client with the same name status = %v", w.Code)
+	}
+	if w := send("POST", "/add-note", "", ""); w.Code != http.StatusOK {
+		t.Errorf("anonymous status = %v", w.Code)
+	}
+	if w := send("GET", "/get-notes", "user1", oauth.UserToken); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "100" {
+		t.Errorf("default limit status = %v, headers = %v", w.Code, w.Header())
+	}
+}
+
+func TestCountAs(t *testing.T) {
+	limiter := New(slog.New(slog.NewTextHandler(io.Discard, nil)), NewMemoryStore(), PerPeriod(100, time.Minute, 100), map[string]Limit{
+		"POST /api/v1/notes": PerPeriod(1, time.Minute, 1),
+	})
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(limiter.Middleware)
+		r.Post("/api/v1/notes", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(CountAs(func(r *http.Request) string { return "POST /api/v1/notes" }))
+		r.Use(limiter.Middleware)
+		r.Post("/add-note", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	send := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), oauth.CredentialContext, "user1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	if w := send("/api/v1/notes"); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %v", w.Code)
+	}
+	// старый адрес того же маршрута не даёт второй бакет
+	if w := send("/add-note"); w.Code != http.StatusTooManyRequests || w.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("alias status = %v, headers = %v, want the versioned route's limit", w.Code, w.Header())
+	}
+}
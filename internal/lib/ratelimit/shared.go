@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often SharedStore deletes buckets idle for
+// pruneAfter. A bucket that needs longer than that to refill is forgotten
+// early, which only makes the limit more lenient.
+const (
+	pruneInterval = 10 * time.Minute
+	pruneAfter    = time.Hour
+)
+
+// TokenStore keeps buckets in the database, so all instances share them.
+// TakeRateLimitToken refills the bucket, takes a token when there is one, and
+// returns the tokens left.
+type TokenStore interface {
+	TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (float64, bool, error)
+	PruneRateLimits(ctx context.Context, idle time.Duration) error
+}
+
+type SharedStore struct {
+	log *slog.Logger
+	db  TokenStore
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewSharedStore(log *slog.Logger, db TokenStore) *SharedStore {
+	return &SharedStore{
+		log: log,
+		db:  db,
+	}
+}
+
+func (s *SharedStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.prune(ctx)
+
+	tokens, allowed, err := s.db.TakeRateLimitToken(ctx, key, limit.Rate, limit.Burst)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(limit, tokens, allowed), nil
+}
+
+func (s *SharedStore) prune(ctx context.Context) {
+	s.mu.Lock()
+	due := time.Since(s.lastPrune) >= pruneInterval
+	if due {
+		s.lastPrune = time.Now()
+	}
+	s.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	if err := s.db.PruneRateLimits(ctx, pruneAfter); err != nil {
+		s.log.Error("failed to prune rate limits", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,18 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// JSON writes v as the JSON body of a response with the given status. The
+// responses are private to the caller and must not be cached.
+func JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := newRecorder(t)
+
+	var buf bytes.Buffer
+	log := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil)))
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/notes/{id}/render", func(w http.ResponseWriter, r *http.Request) {
+		log.InfoContext(r.Context(), "rendering note")
+	})
+
+	req := httptest.NewRequest("GET", "/notes/42/render", nil)
+	// вызывающая сторона уже начала трассу
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "GET /notes/{id}/render" {
+		t.Errorf("span name = %q", span.Name())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id = %s, the caller's trace was not continued", span.SpanContext().TraceID())
+	}
+
+	if !strings.Contains(buf.String(), "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("log line has no trace id: %s", buf.String())
+	}
+}
+
+func TestTransport(t *testing.T) {
+	newRecorder(t)
+
+	var traceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer backend.Close()
+
+	ctx, span := Start(context.Background(), "test", "parent")
+	defer span.End()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", backend.URL, nil)
+	resp, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !strings.Contains(traceparent, span.SpanContext().TraceID().String()) {
+		t.Errorf("traceparent = %q, want trace %s", traceparent, span.SpanContext().TraceID())
+	}
+}
+
+func TestSetup_NoBaggage(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{ServiceName: "test", Exporter: ExporterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+	var header http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", backend.URL, nil)
+		resp, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	// багаж вызывающей стороны не должен уходить к спеллеру
+	req.Header.Set("baggage", "user=alice")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(header.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("traceparent = %q, the trace was not continued", header.Get("traceparent"))
+	}
+	if header.Get("baggage") != "" {
+		t.Errorf("baggage = %q, want none", header.Get("baggage"))
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := newRecorder(t)
+
+	_, ok := Start(context.Background(), "test", "ok")
+	End(ok, nil)
+
+	_, failed := Start(context.Background(), "test", "failed")
+	End(failed, errors.New("connection refused"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+
+	if spans[0].Status().Code != codes.Unset || len(spans[0].Events()) != 0 {
+		t.Errorf("successful span status = %v, events = %v", spans[0].Status(), spans[0].Events())
+	}
+
+	status := spans[1].Status()
+	if status.Code != codes.Error || status.Description != "connection refused" {
+		t.Errorf("failed span status = %v, want an error", status)
+	}
+	// RecordError оставляет событие exception с текстом ошибки
+	if events := spans[1].Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("failed span events = %v, want the recorded error", events)
+	}
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecated marks the responses of legacy routes with the Deprecation
+// (RFC 9745) and Sunset (RFC 8594) headers, and links the route that
+// replaces the requested one as its successor version.
+func Deprecated(deprecatedAt, sunset time.Time, successor func(r *http.Request) string) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	sunsetAt := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetAt)
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor(r)))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
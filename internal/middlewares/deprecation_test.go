@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecated(t *testing.T) {
+	deprecatedAt := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	handler := Deprecated(deprecatedAt, sunset, func(r *http.Request) string {
+		return "/api/v1" + r.URL.Path
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/notes/export", nil))
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status code = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get("Deprecation"); got != "@1730419200" {
+		t.Errorf("Deprecation = %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Thu, 01 May 2025 00:00:00 GMT" {
+		t.Errorf("Sunset = %q", got)
+	}
+	if got := w.Header().Get("Link"); got != `</api/v1/notes/export>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+}
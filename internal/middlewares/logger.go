@@ -1,15 +1,19 @@
 package middlewares
 
 import (
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"log/slog"
 	"net/http"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
 	"time"
 )
 
 func New(log *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		log = log.With(slog.String("component", "middleware/logger"))
+		base := log
+		log := log.With(slog.String("component", "middleware/logger"))
 
 		log.Info("logger middleware enabled")
 
@@ -27,15 +31,33 @@ func New(log *slog.Logger) func(http.Handler) http.Handler {
 			t1 := time.Now()
 
 			defer func() {
-				entry.Info("request completed",
+				entry.InfoContext(r.Context(), "request completed",
+					slog.String("route", chi.RouteContext(r.Context()).RoutePattern()),
 					slog.Int("status", ww.Status()),
 					slog.Int("size", ww.BytesWritten()),
 					slog.String("duration", time.Since(t1).String()),
 				)
 			}()
-			next.ServeHTTP(ww, r)
+
+			// services and storage log through the request logger, see LogContext
+			reqLog := base.With(slog.String("request_id", middleware.GetReqID(r.Context())))
+			next.ServeHTTP(ww, r.WithContext(logger.WithLogger(r.Context(), reqLog)))
 		}
 
 		return http.HandlerFunc(fn)
 	}
 }
+
+// LogContext adds the authenticated user and the route pattern to the
+// request logger. It belongs after Authorize, inside a chi group, where
+// both are known.
+func LogContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		args := []any{slog.String("route", chi.RouteContext(r.Context()).RoutePattern())}
+		if user, ok := oa.Credential(r.Context()); ok {
+			args = append(args, slog.String("user", user))
+		}
+
+		next.ServeHTTP(w, r.WithContext(logger.With(r.Context(), slog.Default(), args...)))
+	})
+}
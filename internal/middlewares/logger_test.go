@@ -0,0 +1,76 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/oauth"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testovoe/internal/lib/logger"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(New(log))
+	router.Group(func(r chi.Router) {
+		// подставляем пользователя вместо Authorize
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), oauth.CredentialContext, "user1")))
+			})
+		})
+		r.Use(LogContext)
+		r.Get("/notes/{id}", func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context(), slog.Default()).InfoContext(r.Context(), "from service")
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/notes/42", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var e map[string]any
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("bad log line %q: %v", line, err)
+		}
+		if e["msg"] == "from service" {
+			entry = e
+		}
+	}
+	if entry == nil {
+		t.Fatalf("service log line not found in %s", buf.String())
+	}
+
+	want := map[string]string{
+		"request_id": "req-1",
+		"user":       "user1",
+		"route":      "/notes/{id}",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %q", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["component"]; ok {
+		t.Errorf("middleware component leaked into the request logger")
+	}
+}
+
+func TestFromContextFallback(t *testing.T) {
+	fallback := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+
+	if got := logger.FromContext(context.Background(), fallback); got != fallback {
+		t.Errorf("expected fallback logger outside of requests")
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// APIKey is a personal key that scripts use instead of the owner's
+// password. Only the SHA-256 of the key is stored; Prefix is kept so the
+// owner can tell keys apart.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Owner      string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	AuditUserDisabled  = "user_disabled"
+	AuditUserEnabled   = "user_enabled"
+	AuditPasswordReset = "password_reset"
+	AuditRoleChanged   = "role_changed"
+	AuditImpersonated  = "impersonated"
+)
+
+// AuditEvent is an entry of the admin audit trail: Actor did Action to
+// the user named by Target.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
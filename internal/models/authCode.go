@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AuthCode is an OAuth2 authorization code. Only the SHA-256 of the code
+// itself is stored.
+type AuthCode struct {
+	CodeHash      string
+	ClientID      string
+	RedirectURI   string
+	Username      string
+	Scope         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Client is an OAuth client registered through the admin API. Only the
+// hash of its secret is kept; public clients have none.
+type Client struct {
+	ID           string     `json:"client_id"`
+	Name         string     `json:"name"`
+	SecretHash   string     `json:"-"`
+	GrantTypes   []string   `json:"grant_types"`
+	Scopes       []string   `json:"scopes"`
+	RedirectURIs []string   `json:"redirect_uris"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	ImportStatusPending = "pending"
+	ImportStatusRunning = "running"
+	ImportStatusDone    = "done"
+	ImportStatusFailed  = "failed"
+)
+
+type ImportJob struct {
+	ID         string        `json:"id"`
+	Owner      string        `json:"-"`
+	Format     string        `json:"format"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Imported   int           `json:"imported"`
+	Failed     int           `json:"failed"`
+	Errors     []ImportError `json:"errors"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+type ImportError struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
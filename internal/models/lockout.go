@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	LockoutEventLocked   = "locked"
+	LockoutEventUnlocked = "unlocked"
+)
+
+// LockoutEvent is an entry of the lockout audit trail. Subject is
+// "user:<username>" or "ip:<address>"; Actor is the admin who unlocked it.
+type LockoutEvent struct {
+	ID          int64      `json:"id"`
+	Subject     string     `json:"subject"`
+	Event       string     `json:"event"`
+	Failures    int        `json:"failures,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	Actor       string     `json:"actor,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// MFA is the TOTP enrollment of a user. Until ConfirmedAt is set the
+// enrollment is pending and logins do not ask for a code. LastStep is the
+// last accepted TOTP time step, so that a code cannot be replayed.
+type MFA struct {
+	Username    string
+	Secret      string
+	ConfirmedAt *time.Time
+	LastStep    int64
+}
@@ -1,7 +1,15 @@
 package models
 
+import "time"
+
 type Note struct {
 	ID      string `json:"id"`
 	Content string `json:"content"`
 	Owner   string `json:"owner"`
+	// only read by the export and GraphQL
+	Tags []string `json:"-"`
+	// slash separated path of the notebook, empty for notes outside one
+	Notebook  string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
 }
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// NoteShare gives Username read access to a note of another user.
+type NoteShare struct {
+	NoteID    string
+	Username  string
+	CreatedAt time.Time
+}
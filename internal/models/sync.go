@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+const (
+	SyncStatusApplied  = "applied"
+	SyncStatusConflict = "conflict"
+	SyncStatusRejected = "rejected"
+)
+
+// NoteChange is the state of a note at a point of the owner's change
+// sequence. Deleted notes are reported as tombstones without content.
+type NoteChange struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content,omitempty"`
+	Version   int64     `json:"version"`
+	Deleted   bool      `json:"deleted"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Seq       int64     `json:"-"`
+}
+
+type ChangeSet struct {
+	Changes   []NoteChange `json:"changes"`
+	NextToken string       `json:"next_token"`
+	HasMore   bool         `json:"has_more"`
+}
+
+// PushChange is a local modification made by a client on top of
+// BaseVersion, which is 0 for notes created on the client.
+type PushChange struct {
+	ID          string `json:"id"`
+	BaseVersion int64  `json:"base_version"`
+	Content     string `json:"content,omitempty"`
+	Deleted     bool   `json:"deleted,omitempty"`
+}
+
+type PushResult struct {
+	ID      string      `json:"id"`
+	Status  string      `json:"status"`
+	Version int64       `json:"version,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Server  *NoteChange `json:"server,omitempty"`
+}
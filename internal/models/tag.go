@@ -0,0 +1,13 @@
+package models
+
+// Tag and Notebook count the live notes of an owner carrying the tag or
+// filed in the notebook.
+type Tag struct {
+	Name  string
+	Notes int
+}
+
+type Notebook struct {
+	Path  string
+	Notes int
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// User is either a local user with a password or a user provisioned on the
+// first login through the external identity provider, identified there by
+// Issuer and Subject. Local users have an empty Issuer.
+type User struct {
+	Username     string     `json:"username"`
+	Issuer       string     `json:"issuer,omitempty"`
+	Subject      string     `json:"subject,omitempty"`
+	Email        string     `json:"email,omitempty"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	NoteCount    int64      `json:"note_count"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  time.Time  `json:"last_login_at"`
+}
+
+func (u User) Local() bool {
+	return u.Issuer == ""
+}
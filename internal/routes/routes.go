@@ -4,19 +4,31 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/go-chi/oauth"
 	"log/slog"
+	"net/http"
+	"testovoe/internal/config"
+	"testovoe/internal/handlers/adminHandlers"
+	"testovoe/internal/handlers/apiKeysHandlers"
+	"testovoe/internal/handlers/graphqlHandlers"
+	"testovoe/internal/handlers/mfaHandlers"
 	"testovoe/internal/handlers/notesHandlers"
+	"testovoe/internal/lib/health"
+	"testovoe/internal/lib/metrics"
 	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/lib/openapi"
+	"testovoe/internal/lib/ratelimit"
+	"testovoe/internal/lib/tracing"
 	"testovoe/internal/middlewares"
 )
 
-func InitRoutes(log *slog.Logger, notesHandlers *notesHandlers.NotesHandlers, router *chi.Mux) *chi.Mux {
+func InitRoutes(log *slog.Logger, notesHandlers *notesHandlers.NotesHandlers, adminHandlers *adminHandlers.AdminHandlers, apiKeysHandlers *apiKeysHandlers.APIKeysHandlers, mfaHandlers *mfaHandlers.MFAHandlers, graphqlHandlers *graphqlHandlers.GraphQLHandlers, authServer *oa.Server, access *oa.AccessControl, limiter *ratelimit.Limiter, checker *health.Checker, metrics *metrics.Metrics, spec *openapi.Spec, oidcLogin *oa.OIDCLogin, legacy config.LegacyAPIConfig, router *chi.Mux) *chi.Mux {
 	router.Use(middleware.RequestID)
 	router.Use(middleware.RealIP)
+	// before the logger, so the request log line carries the trace ID
+	router.Use(tracing.Middleware)
+	router.Use(metrics.Middleware)
 	router.Use(middlewares.New(log))
 	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
 
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
@@ -27,17 +39,211 @@ func InitRoutes(log *slog.Logger, notesHandlers *notesHandlers.NotesHandlers, ro
 		MaxAge:           300,
 	}))
 
-	oa.AuthAPI(router)
-	registerAPI(router, notesHandlers)
+	router.Get("/healthz", checker.Live)
+	router.Get("/readyz", checker.Ready)
+
+	// on the root router, where URLFormat cannot strip the extension
+	router.Get("/openapi.json", spec.ServeJSON)
+	router.Get("/docs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+	})
+	router.Handle("/docs/*", openapi.UI("/docs", "/openapi.json"))
+
+	oa.AuthAPI(router, authServer)
+	if oidcLogin != nil {
+		oa.OIDCAPI(router, oidcLogin)
+	}
+	registerAPI(router, notesHandlers, authServer, access, limiter, spec, legacy)
+	registerAPIKeys(router, apiKeysHandlers, authServer, access, limiter, spec)
+	registerMFA(router, mfaHandlers, authServer, access, limiter, spec)
+	registerGraphQL(router, graphqlHandlers, authServer, access, limiter, spec)
+	registerAdmin(router, adminHandlers, authServer, access, spec)
 
 	return router
 }
 
-func registerAPI(r *chi.Mux, notesHandlers *notesHandlers.NotesHandlers) {
+func registerAPI(r *chi.Mux, notesHandlers *notesHandlers.NotesHandlers, authServer *oa.Server, access *oa.AccessControl, limiter *ratelimit.Limiter, spec *openapi.Spec, legacy config.LegacyAPIConfig) {
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(middleware.URLFormat)
+		r.Use(authServer.Authorize)
+		r.Use(access.RequireActive)
+
+		r.Route("/notes", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(oa.RequireScope(oa.ScopeNotesRead))
+				r.Use(middlewares.LogContext)
+				r.Use(limiter.Middleware)
+				r.Use(spec.Validate)
+				r.Get("/", notesHandlers.GetNotes)
+				r.Get("/export", notesHandlers.ExportNotes)
+				r.Get("/sync", notesHandlers.GetChanges)
+				r.Get("/import/{id}", notesHandlers.GetImportJob)
+				r.Get("/{id}", notesHandlers.GetNote)
+				r.Get("/{id}/render", notesHandlers.RenderNote)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(oa.RequireScope(oa.ScopeNotesWrite))
+				r.Use(middlewares.LogContext)
+				r.Use(limiter.Middleware)
+				r.Use(spec.Validate)
+				r.Post("/", notesHandlers.AddNote)
+				r.Post("/batch", notesHandlers.Batch)
+				r.Post("/sync", notesHandlers.PushChanges)
+				r.Post("/import", notesHandlers.ImportNotes)
+				r.Put("/{id}", notesHandlers.UpdateNote)
+				r.Delete("/{id}", notesHandlers.DeleteNote)
+			})
+		})
+	})
+
+	registerLegacyAPI(r, notesHandlers, authServer, access, limiter, spec, legacy)
+}
+
+// registerLegacyAPI keeps the routes from before /api/v1 working as aliases
+// of the versioned ones, announced as deprecated and removed after the
+// configured sunset.
+func registerLegacyAPI(r *chi.Mux, notesHandlers *notesHandlers.NotesHandlers, authServer *oa.Server, access *oa.AccessControl, limiter *ratelimit.Limiter, spec *openapi.Spec, legacy config.LegacyAPIConfig) {
+	notes := middlewares.Deprecated(legacy.DeprecatedAt, legacy.Sunset, func(r *http.Request) string {
+		return "/api/v1/notes"
+	})
+	// /notes/... only moved under the prefix
+	prefixed := middlewares.Deprecated(legacy.DeprecatedAt, legacy.Sunset, func(r *http.Request) string {
+		return "/api/v1" + r.URL.Path
+	})
+
 	r.Route("/", func(r chi.Router) {
+		// kept off the auth routes, where it would turn /.well-known/jwks.json
+		// into /.well-known/jwks before routing
+		r.Use(middleware.URLFormat)
 		// use the Bearer Authentication middleware
-		r.Use(oauth.Authorize("yaroslav-the-best", nil))
-		r.Post("/add-note", notesHandlers.AddNote)
-		r.Get("/get-notes", notesHandlers.GetNotes)
+		r.Use(authServer.Authorize)
+		r.Use(access.RequireActive)
+
+		r.Group(func(r chi.Router) {
+			r.Use(oa.RequireScope(oa.ScopeNotesRead))
+			r.Use(middlewares.LogContext)
+			r.Use(ratelimit.CountAs(versionedRoute))
+			r.Use(limiter.Middleware)
+			r.Use(spec.Validate)
+			r.With(notes).Get("/get-notes", notesHandlers.GetNotes)
+			r.With(prefixed).Get("/notes/export", notesHandlers.ExportNotes)
+			r.With(prefixed).Get("/notes/sync", notesHandlers.GetChanges)
+			r.With(prefixed).Get("/notes/import/{id}", notesHandlers.GetImportJob)
+			r.With(prefixed).Get("/notes/{id}/render", notesHandlers.RenderNote)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(oa.RequireScope(oa.ScopeNotesWrite))
+			r.Use(middlewares.LogContext)
+			r.Use(ratelimit.CountAs(versionedRoute))
+			r.Use(limiter.Middleware)
+			r.Use(spec.Validate)
+			r.With(notes).Post("/add-note", notesHandlers.AddNote)
+			r.With(prefixed).Post("/notes/batch", notesHandlers.Batch)
+			r.With(prefixed).Post("/notes/sync", notesHandlers.PushChanges)
+			r.With(prefixed).Post("/notes/import", notesHandlers.ImportNotes)
+		})
+	})
+}
+
+// versionedRoute names the /api/v1 route a legacy one is an alias of, so
+// that both count against the same rate limit.
+func versionedRoute(r *http.Request) string {
+	pattern := chi.RouteContext(r.Context()).RoutePattern()
+	switch pattern {
+	case "/get-notes", "/add-note":
+		pattern = "/notes"
+	}
+
+	return r.Method + " /api/v1" + pattern
+}
+
+func registerAPIKeys(r *chi.Mux, apiKeysHandlers *apiKeysHandlers.APIKeysHandlers, authServer *oa.Server, access *oa.AccessControl, limiter *ratelimit.Limiter, spec *openapi.Spec) {
+	r.Route("/api-keys", func(r chi.Router) {
+		r.Use(authServer.Authorize)
+		r.Use(access.RequireActive)
+		r.Use(oa.RejectImpersonation)
+
+		// in a group, so the middlewares below see the full route pattern
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.LogContext)
+			r.Use(limiter.Middleware)
+			r.Use(spec.Validate)
+			r.Get("/", apiKeysHandlers.ListKeys)
+			r.With(oa.RequireInteractive).Post("/", apiKeysHandlers.CreateKey)
+			r.Delete("/{id}", apiKeysHandlers.DeleteKey)
+		})
+	})
+}
+
+func registerGraphQL(r *chi.Mux, graphqlHandlers *graphqlHandlers.GraphQLHandlers, authServer *oa.Server, access *oa.AccessControl, limiter *ratelimit.Limiter, spec *openapi.Spec) {
+	r.Group(func(r chi.Router) {
+		r.Use(authServer.Authorize)
+		r.Use(access.RequireActive)
+		// mutations additionally need notes:write, checked per operation
+		r.Use(oa.RequireScope(oa.ScopeNotesRead))
+		r.Use(middlewares.LogContext)
+		r.Use(limiter.Middleware)
+		r.Use(spec.Validate)
+		r.Post("/graphql", graphqlHandlers.Query)
+	})
+
+	// WebSocket clients authenticate in the connection_init message, so the
+	// handler applies the limiter itself once it knows the caller
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.LogContext)
+		r.Use(spec.Validate)
+		r.Get("/graphql", graphqlHandlers.Subscriptions)
+	})
+}
+
+func registerMFA(r *chi.Mux, mfaHandlers *mfaHandlers.MFAHandlers, authServer *oa.Server, access *oa.AccessControl, limiter *ratelimit.Limiter, spec *openapi.Spec) {
+	r.Route("/mfa/totp", func(r chi.Router) {
+		r.Use(authServer.Authorize)
+		r.Use(access.RequireActive)
+		r.Use(oa.RejectImpersonation)
+		r.Use(oa.RequireInteractive)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.LogContext)
+			r.Use(limiter.Middleware)
+			r.Use(spec.Validate)
+			r.Post("/", mfaHandlers.Enroll)
+			r.Post("/verify", mfaHandlers.Confirm)
+			r.Delete("/", mfaHandlers.Disable)
+		})
+	})
+}
+
+func registerAdmin(r *chi.Mux, adminHandlers *adminHandlers.AdminHandlers, authServer *oa.Server, access *oa.AccessControl, spec *openapi.Spec) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(authServer.Authorize)
+		r.Use(oa.RequireScope(oa.ScopeAdmin))
+		r.Use(access.RequireRole(oa.RoleAdmin))
+		r.Use(oa.RequireInteractive)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.LogContext)
+			r.Use(spec.Validate)
+
+			r.Get("/clients", adminHandlers.ListClients)
+			r.Post("/clients", adminHandlers.CreateClient)
+			r.Post("/clients/{id}/secret", adminHandlers.RotateClientSecret)
+			r.Delete("/clients/{id}", adminHandlers.DisableClient)
+
+			r.Get("/lockouts/events", adminHandlers.ListLockoutEvents)
+			r.Post("/lockouts/unlock", adminHandlers.Unlock)
+
+			r.Get("/users", adminHandlers.ListUsers)
+			r.Get("/users/{username}", adminHandlers.GetUser)
+			r.Post("/users/{username}/disable", adminHandlers.DisableUser)
+			r.Post("/users/{username}/enable", adminHandlers.EnableUser)
+			r.Post("/users/{username}/password", adminHandlers.ResetPassword)
+			r.Put("/users/{username}/role", adminHandlers.SetRole)
+			r.Post("/users/{username}/impersonate", adminHandlers.Impersonate)
+
+			r.Get("/audit", adminHandlers.ListAudit)
+		})
 	})
 }
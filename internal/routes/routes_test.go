@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testovoe/api"
+	"testovoe/internal/config"
+	"testovoe/internal/lib/openapi"
+)
+
+// TestRoutesDocumented keeps the OpenAPI document in step with the router.
+func TestRoutesDocumented(t *testing.T) {
+	spec, err := openapi.Load(api.Spec)
+	if err != nil {
+		t.Fatalf("failed to load the document: %v", err)
+	}
+
+	// обработчики не вызываются, нужны только маршруты
+	router := InitRoutes(slog.Default(), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, spec, nil, config.LegacyAPIConfig{}, chi.NewRouter())
+
+	undocumented := map[string]bool{
+		"/openapi.json": true,
+		"/docs":         true,
+		"/docs/*":       true,
+	}
+
+	err = chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.ReplaceAll(route, "/*/", "/")
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+
+		if undocumented[route] {
+			return nil
+		}
+
+		if _, operation := spec.Operation(method, route); operation == nil {
+			t.Errorf("%s %s is not documented", method, route)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk routes: %v", err)
+	}
+}
+
+// TestLegacyRoutesCountAsVersioned checks that every legacy route shares
+// the rate limit of an existing /api/v1 route.
+func TestLegacyRoutesCountAsVersioned(t *testing.T) {
+	spec, err := openapi.Load(api.Spec)
+	if err != nil {
+		t.Fatalf("failed to load the document: %v", err)
+	}
+
+	router := InitRoutes(slog.Default(), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, spec, nil, config.LegacyAPIConfig{}, chi.NewRouter())
+
+	routes := make(map[string]bool)
+	_ = chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// как в RoutePattern() при запросе, без слэша в конце
+		routes[method+" "+strings.TrimSuffix(strings.ReplaceAll(route, "/*/", "/"), "/")] = true
+		return nil
+	})
+
+	legacy := []string{
+		"GET /get-notes",
+		"GET /notes/export",
+		"GET /notes/sync",
+		"GET /notes/import/{id}",
+		"GET /notes/{id}/render",
+		"POST /add-note",
+		"POST /notes/batch",
+		"POST /notes/sync",
+		"POST /notes/import",
+	}
+	for _, route := range legacy {
+		if !routes[route] {
+			t.Errorf("%s is not registered", route)
+			continue
+		}
+
+		method, pattern, _ := strings.Cut(route, " ")
+		rctx := chi.NewRouteContext()
+		rctx.RoutePatterns = []string{pattern}
+		req := httptest.NewRequest(method, pattern, nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		if versioned := versionedRoute(req); !routes[versioned] {
+			t.Errorf("%s counts as %s, which is not a route", route, versioned)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package apiKeysService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"slices"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+	"testovoe/internal/storage/postgres"
+	"time"
+)
+
+const (
+	DefaultKeyTTL = 90 * 24 * time.Hour
+	MaxKeyTTL     = 365 * 24 * time.Hour
+
+	// visible part of the key kept for listing, e.g. "nsk_Ab12Cd34"
+	prefixLength = len(oa.APIKeyPrefix) + 8
+)
+
+var (
+	ErrAPIKeyNotFound = apperr.NotFound("api_key_not_found", "api key not found")
+	ErrInvalidAPIKey  = apperr.Validation("invalid_api_key", "invalid api key")
+)
+
+type APIKeysStorage interface {
+	CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context, owner string) ([]models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, keyId, owner string) error
+	UseAPIKey(ctx context.Context, keyHash string) (models.APIKey, error)
+}
+
+type APIKeysService struct {
+	log *slog.Logger
+	db  APIKeysStorage
+}
+
+func NewAPIKeysService(log *slog.Logger, db *postgres.Storage) *APIKeysService {
+	return &APIKeysService{
+		log: log,
+		db:  db,
+	}
+}
+
+// CreateKey issues a key for the owner and returns it with the plaintext,
+// which is not stored and cannot be shown again. The key can never have
+// more scopes than the token it was created with (granted).
+func (s *APIKeysService) CreateKey(ctx context.Context, owner, name string, scopes []string, granted string, ttl time.Duration) (models.APIKey, string, error) {
+	const op = "apiKeysService.CreateKey"
+
+	if strings.TrimSpace(name) == "" {
+		return models.APIKey{}, "", ErrInvalidAPIKey.Detailf("name is required")
+	}
+
+	if ttl == 0 {
+		ttl = DefaultKeyTTL
+	}
+	if ttl < 0 || ttl > MaxKeyTTL {
+		return models.APIKey{}, "", ErrInvalidAPIKey.Detailf("expiry must be within %d days", MaxKeyTTL/(24*time.Hour))
+	}
+
+	// keys never carry the admin scope, administration needs a signed in admin
+	if len(scopes) == 0 {
+		scopes = slices.DeleteFunc(oa.ParseScope(granted), func(scope string) bool {
+			return scope == oa.ScopeAdmin
+		})
+	}
+	if slices.Contains(scopes, oa.ScopeAdmin) {
+		return models.APIKey{}, "", ErrInvalidAPIKey.Detailf("scope %q cannot be given to a key", oa.ScopeAdmin)
+	}
+	if len(scopes) == 0 {
+		return models.APIKey{}, "", ErrInvalidAPIKey.Detailf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !oa.HasScope(granted, scope) {
+			return models.APIKey{}, "", ErrInvalidAPIKey.Detailf("scope %q is not granted", scope)
+		}
+	}
+
+	secret, err := oa.NewClientSecret()
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	plaintext := oa.APIKeyPrefix + secret
+
+	key, err := s.db.CreateAPIKey(ctx, models.APIKey{
+		ID:        uuid.NewString(),
+		Owner:     owner,
+		Name:      name,
+		Prefix:    plaintext[:prefixLength],
+		KeyHash:   oa.HashSecret(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "api key created", slog.String("owner", owner), slog.String("key_id", key.ID))
+
+	return key, plaintext, nil
+}
+
+func (s *APIKeysService) ListKeys(ctx context.Context, owner string) ([]models.APIKey, error) {
+	const op = "apiKeysService.ListKeys"
+
+	keys, err := s.db.ListAPIKeys(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeysService) DeleteKey(ctx context.Context, keyId, owner string) error {
+	const op = "apiKeysService.DeleteKey"
+
+	if uuid.Validate(keyId) != nil {
+		return fmt.Errorf("%s: %w", op, ErrAPIKeyNotFound)
+	}
+
+	if err := s.db.DeleteAPIKey(ctx, keyId, owner); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAPIKeyNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "api key deleted", slog.String("owner", owner), slog.String("key_id", keyId))
+
+	return nil
+}
+
+// VerifyAPIKey implements oauth.APIKeyVerifier.
+func (s *APIKeysService) VerifyAPIKey(ctx context.Context, key string) (string, string, error) {
+	const op = "apiKeysService.VerifyAPIKey"
+
+	apiKey, err := s.db.UseAPIKey(ctx, oa.HashSecret(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrAPIKeyNotFound)
+		}
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apiKey.Owner, strings.Join(apiKey.Scopes, " "), nil
+}
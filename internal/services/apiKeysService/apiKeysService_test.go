@@ -0,0 +1,82 @@
+package apiKeysService
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+)
+
+// memoryStorage - хранилище ключей в памяти
+type memoryStorage struct {
+	keys []models.APIKey
+}
+
+func (m *memoryStorage) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	m.keys = append(m.keys, key)
+
+	return key, nil
+}
+
+func (m *memoryStorage) ListAPIKeys(ctx context.Context, owner string) ([]models.APIKey, error) {
+	return m.keys, nil
+}
+
+func (m *memoryStorage) DeleteAPIKey(ctx context.Context, keyId, owner string) error {
+	return nil
+}
+
+func (m *memoryStorage) UseAPIKey(ctx context.Context, keyHash string) (models.APIKey, error) {
+	return models.APIKey{}, errors.New("not implemented")
+}
+
+func TestAPIKeysService_CreateKey_Scopes(t *testing.T) {
+	granted := "notes:read notes:write admin"
+
+	tests := []struct {
+		name       string
+		scopes     []string
+		wantScopes []string
+		wantErr    bool
+	}{
+		{
+			name:       "defaults to the granted scopes without admin",
+			wantScopes: []string{oa.ScopeNotesRead, oa.ScopeNotesWrite},
+		},
+		{
+			name:       "requested scopes",
+			scopes:     []string{oa.ScopeNotesRead},
+			wantScopes: []string{oa.ScopeNotesRead},
+		},
+		{
+			name:    "admin scope refused",
+			scopes:  []string{oa.ScopeNotesRead, oa.ScopeAdmin},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &APIKeysService{log: slog.New(slog.NewTextHandler(io.Discard, nil)), db: &memoryStorage{}}
+
+			key, _, err := s.CreateKey(context.Background(), "admin", "ci", tt.scopes, granted, 0)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAPIKey) {
+					t.Fatalf("CreateKey() error = %v, want ErrInvalidAPIKey", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateKey() error = %v", err)
+			}
+
+			if !slices.Equal(key.Scopes, tt.wantScopes) {
+				t.Errorf("scopes = %v, want %v", key.Scopes, tt.wantScopes)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package clientsService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/oauth"
+	"github.com/google/uuid"
+	"log/slog"
+	"net/url"
+	"slices"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+	"testovoe/internal/storage/postgres"
+)
+
+var (
+	ErrClientNotFound = apperr.NotFound("client_not_found", "client not found")
+	ErrInvalidClient  = apperr.Validation("invalid_client", "invalid client")
+)
+
+var (
+	knownGrantTypes = []string{
+		string(oauth.ClientCredentialsGrant),
+		string(oauth.AuthCodeGrant),
+		string(oauth.RefreshTokenGrant),
+	}
+	knownScopes = []string{oa.ScopeNotesRead, oa.ScopeNotesWrite, oa.ScopeAdmin}
+)
+
+type ClientsStorage interface {
+	CreateClient(ctx context.Context, client models.Client) (models.Client, error)
+	GetClient(ctx context.Context, clientID string) (models.Client, error)
+	ListClients(ctx context.Context) ([]models.Client, error)
+	UpdateClientSecret(ctx context.Context, clientID, secretHash string) error
+	DisableClient(ctx context.Context, clientID string) error
+}
+
+type ClientsService struct {
+	log *slog.Logger
+	db  ClientsStorage
+}
+
+func NewClientsService(log *slog.Logger, db *postgres.Storage) *ClientsService {
+	return &ClientsService{
+		log: log,
+		db:  db,
+	}
+}
+
+// CreateClient registers a client and returns it together with its secret,
+// which is not stored and cannot be shown again. Public clients get no
+// secret.
+func (s *ClientsService) CreateClient(ctx context.Context, client models.Client, public bool) (models.Client, string, error) {
+	const op = "clientsService.CreateClient"
+
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{string(oauth.ClientCredentialsGrant)}
+	}
+
+	// validation errors are returned as is, they are shown to the caller
+	if err := validateClient(client, public); err != nil {
+		return models.Client{}, "", err
+	}
+
+	// text[] columns are NOT NULL, and pgx encodes a nil slice as NULL
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	client.ID = uuid.NewString()
+
+	var secret string
+	if !public {
+		var err error
+		secret, err = oa.NewClientSecret()
+		if err != nil {
+			return models.Client{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+		client.SecretHash = oa.HashSecret(secret)
+	}
+
+	created, err := s.db.CreateClient(ctx, client)
+	if err != nil {
+		return models.Client{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "client created", slog.String("client_id", created.ID))
+
+	return created, secret, nil
+}
+
+func (s *ClientsService) ListClients(ctx context.Context) ([]models.Client, error) {
+	const op = "clientsService.ListClients"
+
+	clients, err := s.db.ListClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clients, nil
+}
+
+// RotateSecret replaces the client secret. The old secret stops working
+// immediately.
+func (s *ClientsService) RotateSecret(ctx context.Context, clientID string) (string, error) {
+	const op = "clientsService.RotateSecret"
+
+	client, err := s.db.GetClient(ctx, clientID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	if client.SecretHash == "" {
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidClient.Detailf("public client has no secret"))
+	}
+
+	secret, err := oa.NewClientSecret()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.db.UpdateClientSecret(ctx, clientID, oa.HashSecret(secret)); err != nil {
+		return "", fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "client secret rotated", slog.String("client_id", clientID))
+
+	return secret, nil
+}
+
+func (s *ClientsService) DisableClient(ctx context.Context, clientID string) error {
+	const op = "clientsService.DisableClient"
+
+	if err := s.db.DisableClient(ctx, clientID); err != nil {
+		return fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "client disabled", slog.String("client_id", clientID))
+
+	return nil
+}
+
+// GetClient implements oauth.ClientStore. Disabled clients are reported
+// as not found.
+func (s *ClientsService) GetClient(ctx context.Context, clientID string) (oa.Client, error) {
+	const op = "clientsService.GetClient"
+
+	client, err := s.db.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return oa.Client{}, oa.ErrClientNotFound
+		}
+
+		return oa.Client{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if client.DisabledAt != nil {
+		return oa.Client{}, oa.ErrClientNotFound
+	}
+
+	return oa.Client{
+		ID:           client.ID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash,
+		GrantTypes:   client.GrantTypes,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+	}, nil
+}
+
+func validateClient(client models.Client, public bool) error {
+	if client.Name == "" {
+		return ErrInvalidClient.Detailf("name is required")
+	}
+
+	for _, grantType := range client.GrantTypes {
+		if !slices.Contains(knownGrantTypes, grantType) {
+			return ErrInvalidClient.Detailf("unsupported grant type %q", grantType)
+		}
+	}
+
+	for _, scope := range client.Scopes {
+		if !slices.Contains(knownScopes, scope) {
+			return ErrInvalidClient.Detailf("unknown scope %q", scope)
+		}
+	}
+
+	if public && slices.Contains(client.GrantTypes, string(oauth.ClientCredentialsGrant)) {
+		return ErrInvalidClient.Detailf("public clients cannot use client_credentials")
+	}
+
+	if slices.Contains(client.GrantTypes, string(oauth.AuthCodeGrant)) && len(client.RedirectURIs) == 0 {
+		return ErrInvalidClient.Detailf("authorization_code requires a redirect URI")
+	}
+
+	for _, uri := range client.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return ErrInvalidClient.Detailf("invalid redirect URI %q", uri)
+		}
+	}
+
+	return nil
+}
+
+func mapStorageError(err error) error {
+	if errors.Is(err, storage.ErrClientNotFound) {
+		return ErrClientNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,218 @@
+package importService
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/middlewares"
+	"testovoe/internal/models"
+	"time"
+)
+
+const (
+	FormatZip  = "zip"
+	FormatJSON = "json"
+	FormatENEX = "enex"
+
+	// finished jobs are kept around this long so clients can poll the result
+	jobTTL = time.Hour
+)
+
+var (
+	ErrUnsupportedFormat = apperr.Validation("unsupported_format", "unsupported import format")
+	ErrJobNotFound       = apperr.NotFound("import_job_not_found", "import job not found")
+	ErrEmptyNote         = apperr.Validation("empty_note", "note is empty")
+)
+
+type NotesImporter interface {
+	ImportNote(ctx context.Context, content, owner string, checkSpelling bool) (string, error)
+}
+
+type ImportService struct {
+	log   *slog.Logger
+	notes NotesImporter
+
+	mu   sync.Mutex
+	jobs map[string]*models.ImportJob
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewImportService(log *slog.Logger, notes NotesImporter) *ImportService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ImportService{
+		log:    log,
+		notes:  notes,
+		jobs:   make(map[string]*models.ImportJob),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// StartImport parses the uploaded data and schedules a background job that
+// stores the notes one by one. Parsing happens up front so that malformed
+// uploads are rejected before a job is created.
+func (s *ImportService) StartImport(ctx context.Context, owner, format string, data []byte, checkSpelling bool) (models.ImportJob, error) {
+	const op = "importService.StartImport"
+
+	log := logger.For(ctx, s.log, op).With(
+		slog.String("owner", owner),
+		slog.String("format", format),
+	)
+
+	var (
+		items []item
+		err   error
+	)
+
+	switch format {
+	case FormatZip:
+		items, err = parseMarkdownZip(data)
+	case FormatJSON:
+		items, err = parseJSON(data)
+	case FormatENEX:
+		items, err = parseENEX(data)
+	default:
+		return models.ImportJob{}, fmt.Errorf("%s: %w", op, ErrUnsupportedFormat)
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	jobId, err := middlewares.UUIDGenerator()
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	job := &models.ImportJob{
+		ID:        jobId.String(),
+		Owner:     owner,
+		Format:    format,
+		Status:    models.ImportStatusPending,
+		Total:     len(items),
+		Errors:    []models.ImportError{},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	s.pruneLocked()
+	s.jobs[job.ID] = job
+	snapshot := snapshotLocked(job)
+	s.mu.Unlock()
+
+	log.InfoContext(ctx, "import job scheduled", slog.String("job_id", job.ID), slog.Int("total", len(items)))
+
+	s.wg.Add(1)
+	go s.run(job, items, checkSpelling)
+
+	return snapshot, nil
+}
+
+func (s *ImportService) GetImportJob(ctx context.Context, jobId, owner string) (models.ImportJob, error) {
+	const op = "importService.GetImportJob"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobId]
+	if !ok || job.Owner != owner {
+		return models.ImportJob{}, fmt.Errorf("%s: %w", op, ErrJobNotFound)
+	}
+
+	return snapshotLocked(job), nil
+}
+
+// Close cancels the running jobs and waits for their workers to exit.
+func (s *ImportService) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *ImportService) run(job *models.ImportJob, items []item, checkSpelling bool) {
+	const op = "importService.run"
+
+	defer s.wg.Done()
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("job_id", job.ID),
+		slog.String("owner", job.Owner),
+	)
+
+	s.update(job, func(job *models.ImportJob) {
+		job.Status = models.ImportStatusRunning
+	})
+
+	for _, it := range items {
+		if err := s.ctx.Err(); err != nil {
+			log.Warn("import job interrupted", slog.String("error", err.Error()))
+			s.finish(job, models.ImportStatusFailed)
+			return
+		}
+
+		err := it.err
+		if err == nil && it.content == "" {
+			err = ErrEmptyNote
+		}
+		if err == nil {
+			_, err = s.notes.ImportNote(s.ctx, it.content, job.Owner, checkSpelling)
+		}
+
+		if err != nil {
+			log.Warn("failed to import note", slog.String("item", it.name), slog.String("error", err.Error()))
+		}
+
+		s.update(job, func(job *models.ImportJob) {
+			job.Processed++
+
+			if err != nil {
+				job.Failed++
+				job.Errors = append(job.Errors, models.ImportError{Item: it.name, Error: apperr.PublicMessage(err)})
+				return
+			}
+
+			job.Imported++
+		})
+	}
+
+	s.finish(job, models.ImportStatusDone)
+
+	log.Info("import job finished")
+}
+
+func (s *ImportService) update(job *models.ImportJob, fn func(job *models.ImportJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(job)
+}
+
+func (s *ImportService) finish(job *models.ImportJob, status string) {
+	s.update(job, func(job *models.ImportJob) {
+		now := time.Now().UTC()
+		job.Status = status
+		job.FinishedAt = &now
+	})
+}
+
+func (s *ImportService) pruneLocked() {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func snapshotLocked(job *models.ImportJob) models.ImportJob {
+	snapshot := *job
+	snapshot.Errors = make([]models.ImportError, len(job.Errors))
+	copy(snapshot.Errors, job.Errors)
+
+	return snapshot
+}
@@ -0,0 +1,70 @@
+package importService
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"testovoe/internal/models"
+	"time"
+)
+
+// failingImporter - сохраняет заметки с ошибкой, как упавшая база
+type failingImporter struct {
+	err error
+}
+
+func (f failingImporter) ImportNote(ctx context.Context, content, owner string, checkSpelling bool) (string, error) {
+	return "", f.err
+}
+
+func TestImportService_JobErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantError string
+	}{
+		{
+			name:      "domain error keeps its message",
+			err:       ErrEmptyNote,
+			wantError: "note is empty",
+		},
+		{
+			name:      "internal error is hidden",
+			err:       errors.New("storage.postgres.AddNote: dial tcp 10.0.0.5:5432: connection refused"),
+			wantError: "internal error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewImportService(slog.New(slog.NewTextHandler(io.Discard, nil)), failingImporter{err: tt.err})
+
+			job, err := s.StartImport(context.Background(), "user1", FormatJSON, []byte(`[{"content":"hello"}]`), false)
+			if err != nil {
+				t.Fatalf("StartImport() error = %v", err)
+			}
+			defer s.Close()
+
+			// ждём, пока фоновая задача закончит
+			for deadline := time.Now().Add(time.Second); job.FinishedAt == nil && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Millisecond)
+				job, err = s.GetImportJob(context.Background(), job.ID, "user1")
+				if err != nil {
+					t.Fatalf("GetImportJob() error = %v", err)
+				}
+			}
+
+			if job.Failed != 1 || len(job.Errors) != 1 {
+				t.Fatalf("job = %+v, want one failed item", job)
+			}
+			if job.Errors[0].Error != tt.wantError {
+				t.Errorf("error = %q, want %q", job.Errors[0].Error, tt.wantError)
+			}
+			if job.Status != models.ImportStatusDone {
+				t.Errorf("status = %q, want %q", job.Status, models.ImportStatusDone)
+			}
+		})
+	}
+}
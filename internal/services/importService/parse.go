@@ -0,0 +1,358 @@
+package importService
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/frontmatter"
+	"testovoe/internal/models"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxNoteSize caps a single imported note, which also keeps a malicious
+// archive from inflating into memory.
+const maxNoteSize = 1 << 20
+
+var (
+	ErrNoteTooLarge = apperr.Validation("note_too_large", "note is too large")
+	ErrInvalidData  = apperr.Validation("invalid_import_data", "invalid import data")
+)
+
+type item struct {
+	name    string
+	content string
+	err     error
+}
+
+type markdownFrontMatter struct {
+	Title string `yaml:"title"`
+}
+
+func parseMarkdownZip(data []byte) ([]item, error) {
+	const op = "importService.parseMarkdownZip"
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidData, err)
+	}
+
+	items := make([]item, 0, len(zr.File))
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isMarkdownFile(f.Name) {
+			continue
+		}
+
+		it := item{name: f.Name}
+
+		raw, err := readZipFile(f)
+		if err != nil {
+			it.err = err
+			items = append(items, it)
+			continue
+		}
+
+		var meta markdownFrontMatter
+		body, err := frontmatter.Parse(raw, &meta)
+		if err != nil {
+			it.err = err
+			items = append(items, it)
+			continue
+		}
+
+		it.content = withTitle(meta.Title, body)
+		items = append(items, it)
+	}
+
+	return items, nil
+}
+
+func isMarkdownFile(name string) bool {
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+		return false
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+
+	return ext == ".md" || ext == ".markdown"
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(rc, maxNoteSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) > maxNoteSize {
+		return nil, ErrNoteTooLarge
+	}
+
+	return raw, nil
+}
+
+// withTitle keeps a front-matter title that is not already the first line
+// of the body, since notes have no separate title field.
+func withTitle(title, body string) string {
+	title = strings.TrimSpace(title)
+	body = strings.TrimSpace(body)
+
+	if title == "" {
+		return body
+	}
+
+	firstLine, _, _ := strings.Cut(body, "\n")
+	if strings.TrimSpace(strings.TrimLeft(firstLine, "#")) == title {
+		return body
+	}
+
+	if body == "" {
+		return "# " + title
+	}
+
+	return "# " + title + "\n\n" + body
+}
+
+func parseJSON(data []byte) ([]item, error) {
+	const op = "importService.parseJSON"
+
+	var notes []models.Note
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidData, err)
+	}
+
+	items := make([]item, 0, len(notes))
+
+	for i, note := range notes {
+		it := item{name: fmt.Sprintf("#%d", i), content: strings.TrimSpace(note.Content)}
+		if note.ID != "" {
+			it.name = note.ID
+		}
+		if len(it.content) > maxNoteSize {
+			it.err = ErrNoteTooLarge
+		}
+
+		items = append(items, it)
+	}
+
+	return items, nil
+}
+
+type enexExport struct {
+	Notes []enexNote `xml:"note"`
+}
+
+type enexNote struct {
+	Title   string `xml:"title"`
+	Content string `xml:"content"`
+}
+
+func parseENEX(data []byte) ([]item, error) {
+	const op = "importService.parseENEX"
+
+	var export enexExport
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// ENEX files carry a DOCTYPE pointing at the Evernote DTD
+	dec.Strict = false
+	if err := dec.Decode(&export); err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidData, err)
+	}
+
+	items := make([]item, 0, len(export.Notes))
+
+	for i, note := range export.Notes {
+		it := item{name: note.Title}
+		if it.name == "" {
+			it.name = fmt.Sprintf("#%d", i)
+		}
+
+		if len(note.Content) > maxNoteSize {
+			it.err = ErrNoteTooLarge
+			items = append(items, it)
+			continue
+		}
+
+		body, err := enmlToMarkdown(note.Content)
+		if err != nil {
+			it.err = err
+			items = append(items, it)
+			continue
+		}
+
+		it.content = withTitle(note.Title, body)
+		items = append(items, it)
+	}
+
+	return items, nil
+}
+
+// enmlToMarkdown converts the XHTML subset used by Evernote notes into
+// Markdown. Only the structure that has a Markdown counterpart is kept;
+// attachments (en-media, en-crypt) are dropped.
+func enmlToMarkdown(enml string) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(enml))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var (
+		b       strings.Builder
+		lists   []string
+		ordinal []int
+		hrefs   []string
+		skip    int
+	)
+
+	newline := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+	paragraph := func() {
+		newline()
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+
+			if skip > 0 || name == "en-media" || name == "en-crypt" {
+				skip++
+				continue
+			}
+
+			switch name {
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				paragraph()
+				b.WriteString(strings.Repeat("#", int(name[1]-'0')) + " ")
+			case "p", "div", "blockquote", "table", "pre":
+				paragraph()
+			case "br":
+				b.WriteString("\n")
+			case "hr":
+				paragraph()
+				b.WriteString("---\n\n")
+			case "ul", "ol":
+				newline()
+				lists = append(lists, name)
+				ordinal = append(ordinal, 0)
+			case "li":
+				newline()
+				depth := len(lists)
+				if depth == 0 {
+					b.WriteString("- ")
+					continue
+				}
+				b.WriteString(strings.Repeat("  ", depth-1))
+				if lists[depth-1] == "ol" {
+					ordinal[depth-1]++
+					b.WriteString(fmt.Sprintf("%d. ", ordinal[depth-1]))
+				} else {
+					b.WriteString("- ")
+				}
+			case "en-todo":
+				if attr(t, "checked") == "true" {
+					b.WriteString("[x] ")
+				} else {
+					b.WriteString("[ ] ")
+				}
+			case "b", "strong":
+				b.WriteString("**")
+			case "i", "em":
+				b.WriteString("_")
+			case "a":
+				hrefs = append(hrefs, attr(t, "href"))
+				b.WriteString("[")
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			switch name {
+			case "h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "blockquote", "table", "pre":
+				paragraph()
+			case "tr":
+				newline()
+			case "ul", "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+					ordinal = ordinal[:len(ordinal)-1]
+				}
+				if len(lists) == 0 {
+					paragraph()
+				}
+			case "b", "strong":
+				b.WriteString("**")
+			case "i", "em":
+				b.WriteString("_")
+			case "a":
+				href := ""
+				if len(hrefs) > 0 {
+					href = hrefs[len(hrefs)-1]
+					hrefs = hrefs[:len(hrefs)-1]
+				}
+				b.WriteString("](" + href + ")")
+			}
+		case xml.CharData:
+			if skip > 0 {
+				continue
+			}
+			text := strings.Join(strings.Fields(string(t)), " ")
+			if text == "" {
+				continue
+			}
+			raw := string(t)
+			first, _ := utf8.DecodeRuneInString(raw)
+			last, _ := utf8.DecodeLastRuneInString(raw)
+			if unicode.IsSpace(first) && !strings.HasSuffix(b.String(), " ") && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString(" ")
+			}
+			b.WriteString(text)
+			if unicode.IsSpace(last) {
+				b.WriteString(" ")
+			}
+		}
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+
+	return ""
+}
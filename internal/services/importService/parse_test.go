@@ -0,0 +1,100 @@
+package importService
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestParseENEX(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="20240101T000000Z" application="Evernote">
+  <note>
+    <title>Groceries</title>
+    <content><![CDATA[<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><div>Buy <b>milk</b>&nbsp;today</div><ul><li><en-todo checked="true"/>eggs</li><li><en-todo/>bread</li></ul><en-media type="image/png" hash="abc"/><div><a href="https://example.com">shop</a></div></en-note>]]></content>
+    <created>20240101T000000Z</created>
+  </note>
+  <note>
+    <title></title>
+    <content><![CDATA[<en-note></en-note>]]></content>
+  </note>
+</en-export>`
+
+	items, err := parseENEX([]byte(data))
+	if err != nil {
+		t.Fatalf("parseENEX() error = %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("len(items) = %d, want 2", len(items))
+	}
+
+	want := "# Groceries\n\nBuy **milk** today\n\n- [x] eggs\n- [ ] bread\n\n[shop](https://example.com)"
+	if items[0].content != want {
+		t.Errorf("content = %q, want %q", items[0].content, want)
+	}
+
+	if items[1].name != "#1" || items[1].content != "" {
+		t.Errorf("items[1] = %+v, want empty note named #1", items[1])
+	}
+}
+
+func TestParseMarkdownZip(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"Work/plan.md":        "---\nid: 1\ntitle: Plan\n---\n\nstep one\n",
+		"Work/readme.txt":     "not a note",
+		"__MACOSX/._plan.md":  "resource fork",
+		"Personal/# Diary.md": "# Diary\n\nentry\n",
+	}
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := parseMarkdownZip(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parseMarkdownZip() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, it := range items {
+		got[it.name] = it.content
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("items = %+v, want 2 markdown files", items)
+	}
+	if got["Work/plan.md"] != "# Plan\n\nstep one" {
+		t.Errorf("plan.md content = %q", got["Work/plan.md"])
+	}
+	if got["Personal/# Diary.md"] != "# Diary\n\nentry" {
+		t.Errorf("Diary.md content = %q", got["Personal/# Diary.md"])
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	if _, err := parseJSON([]byte(`{"content":"not an array"}`)); err == nil {
+		t.Errorf("parseJSON() expected error for non-array payload")
+	}
+
+	items, err := parseJSON([]byte(`[{"id":"a","content":" first "},{"content":"second"}]`))
+	if err != nil {
+		t.Fatalf("parseJSON() error = %v", err)
+	}
+
+	if len(items) != 2 || items[0].name != "a" || items[0].content != "first" || items[1].name != "#1" {
+		t.Errorf("items = %+v", items)
+	}
+}
@@ -0,0 +1,199 @@
+package lockoutService
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"testovoe/internal/storage/postgres"
+	"time"
+)
+
+const (
+	// failures allowed before attempts start being delayed
+	freeAttempts = 3
+	maxDelay     = 30 * time.Second
+)
+
+var (
+	ErrNothingToUnlock = apperr.Validation("nothing_to_unlock", "username or ip is required")
+)
+
+type LockoutStorage interface {
+	RecordLoginFailure(ctx context.Context, subject string, window time.Duration) (int, error)
+	LockLogin(ctx context.Context, subject string, until time.Time) error
+	GetLoginLock(ctx context.Context, subjects []string) (time.Time, error)
+	ClearLoginFailures(ctx context.Context, subject string) (bool, error)
+	AddLockoutEvent(ctx context.Context, event models.LockoutEvent) error
+	ListLockoutEvents(ctx context.Context, limit int) ([]models.LockoutEvent, error)
+}
+
+// Policy sets how many failed logins in a row, within Window, lock a
+// username or an address for Duration.
+type Policy struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	Duration        time.Duration
+	Window          time.Duration
+}
+
+type LockoutService struct {
+	log    *slog.Logger
+	db     LockoutStorage
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLockoutService(log *slog.Logger, db *postgres.Storage, policy Policy) *LockoutService {
+	return &LockoutService{
+		log:    log,
+		db:     db,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+func userSubject(username string) string {
+	return "user:" + username
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// CheckLogin implements oauth.LoginGuard.
+func (s *LockoutService) CheckLogin(ctx context.Context, username, ip string) error {
+	const op = "lockoutService.CheckLogin"
+
+	until, err := s.db.GetLoginLock(ctx, []string{userSubject(username), ipSubject(ip)})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if retry := until.Sub(s.now()); retry > 0 {
+		return &oa.LockedError{RetryAfter: retry}
+	}
+
+	return nil
+}
+
+// LoginFailed implements oauth.LoginGuard. After a few failures every
+// further attempt for the username has to wait twice as long as the
+// previous one; reaching the limit locks the username or the address.
+func (s *LockoutService) LoginFailed(ctx context.Context, username, ip string) {
+	s.recordFailure(ctx, userSubject(username), s.policy.MaxUserFailures, true)
+	s.recordFailure(ctx, ipSubject(ip), s.policy.MaxIPFailures, false)
+}
+
+// LoginSucceeded implements oauth.LoginGuard. Only the username counter
+// is reset: a valid login of one account says nothing about the others
+// tried from the same address.
+func (s *LockoutService) LoginSucceeded(ctx context.Context, username, ip string) {
+	const op = "lockoutService.LoginSucceeded"
+
+	if _, err := s.db.ClearLoginFailures(ctx, userSubject(username)); err != nil {
+		logger.For(ctx, s.log, op).ErrorContext(ctx, "failed to reset login failures", slog.String("error", err.Error()))
+	}
+}
+
+func (s *LockoutService) recordFailure(ctx context.Context, subject string, maxFailures int, progressive bool) {
+	const op = "lockoutService.recordFailure"
+
+	log := logger.For(ctx, s.log, op).With(slog.String("subject", subject))
+
+	failures, err := s.db.RecordLoginFailure(ctx, subject, s.policy.Window)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to record login failure", slog.String("error", err.Error()))
+		return
+	}
+
+	var lockFor time.Duration
+	switch {
+	case failures >= maxFailures:
+		lockFor = s.policy.Duration
+	case progressive && failures > freeAttempts:
+		lockFor = min(time.Second<<(failures-freeAttempts-1), maxDelay)
+	default:
+		return
+	}
+
+	until := s.now().Add(lockFor)
+	if err := s.db.LockLogin(ctx, subject, until); err != nil {
+		log.ErrorContext(ctx, "failed to lock login", slog.String("error", err.Error()))
+		return
+	}
+
+	// lockouts go to the audit trail, the first one and every re-lock
+	// after it, but not the delays before them
+	if failures < maxFailures {
+		return
+	}
+
+	log.WarnContext(ctx, "login locked", slog.Int("failures", failures), slog.Time("until", until))
+
+	err = s.db.AddLockoutEvent(ctx, models.LockoutEvent{
+		Subject:     subject,
+		Event:       models.LockoutEventLocked,
+		Failures:    failures,
+		LockedUntil: &until,
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to store lockout event", slog.String("error", err.Error()))
+	}
+}
+
+// Unlock clears the lock and the failure counters of a username and/or an
+// address and records who did it.
+func (s *LockoutService) Unlock(ctx context.Context, username, ip, actor string) error {
+	const op = "lockoutService.Unlock"
+
+	subjects := make([]string, 0, 2)
+	if username != "" {
+		subjects = append(subjects, userSubject(username))
+	}
+	if ip != "" {
+		subjects = append(subjects, ipSubject(ip))
+	}
+
+	if len(subjects) == 0 {
+		return fmt.Errorf("%s: %w", op, ErrNothingToUnlock)
+	}
+
+	for _, subject := range subjects {
+		wasLocked, err := s.db.ClearLoginFailures(ctx, subject)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if !wasLocked {
+			continue
+		}
+
+		logger.For(ctx, s.log, op).InfoContext(ctx, "login unlocked", slog.String("subject", subject), slog.String("actor", actor))
+
+		err = s.db.AddLockoutEvent(ctx, models.LockoutEvent{
+			Subject: subject,
+			Event:   models.LockoutEventUnlocked,
+			Actor:   actor,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *LockoutService) ListEvents(ctx context.Context, limit int) ([]models.LockoutEvent, error) {
+	const op = "lockoutService.ListEvents"
+
+	events, err := s.db.ListLockoutEvents(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
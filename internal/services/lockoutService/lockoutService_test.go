@@ -0,0 +1,151 @@
+package lockoutService
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"time"
+)
+
+// memoryStorage - хранилище в памяти вместо postgres
+type memoryStorage struct {
+	now      func() time.Time
+	failures map[string]int
+	locked   map[string]time.Time
+	events   []models.LockoutEvent
+}
+
+func (m *memoryStorage) RecordLoginFailure(ctx context.Context, subject string, window time.Duration) (int, error) {
+	m.failures[subject]++
+
+	return m.failures[subject], nil
+}
+
+func (m *memoryStorage) LockLogin(ctx context.Context, subject string, until time.Time) error {
+	m.locked[subject] = until
+
+	return nil
+}
+
+func (m *memoryStorage) GetLoginLock(ctx context.Context, subjects []string) (time.Time, error) {
+	var until time.Time
+	for _, s := range subjects {
+		if t := m.locked[s]; t.After(m.now()) && t.After(until) {
+			until = t
+		}
+	}
+
+	return until, nil
+}
+
+func (m *memoryStorage) ClearLoginFailures(ctx context.Context, subject string) (bool, error) {
+	wasLocked := m.locked[subject].After(m.now())
+	delete(m.failures, subject)
+	delete(m.locked, subject)
+
+	return wasLocked, nil
+}
+
+func (m *memoryStorage) AddLockoutEvent(ctx context.Context, event models.LockoutEvent) error {
+	m.events = append(m.events, event)
+
+	return nil
+}
+
+func (m *memoryStorage) ListLockoutEvents(ctx context.Context, limit int) ([]models.LockoutEvent, error) {
+	return m.events, nil
+}
+
+func TestLockoutService(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 10, 5, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	db := &memoryStorage{now: clock, failures: map[string]int{}, locked: map[string]time.Time{}}
+	s := &LockoutService{
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		db:     db,
+		policy: Policy{MaxUserFailures: 6, MaxIPFailures: 100, Duration: 15 * time.Minute, Window: time.Hour},
+		now:    clock,
+	}
+
+	// первые попытки без задержки, затем 1s, 2s, а на шестой - блокировка
+	wantRetry := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 15 * time.Minute}
+	for i, want := range wantRetry {
+		s.LoginFailed(ctx, "user1", "10.0.0.1")
+
+		err := s.CheckLogin(ctx, "user1", "10.0.0.2")
+
+		var locked *oa.LockedError
+		switch {
+		case want == 0 && err != nil:
+			t.Fatalf("failure %d: CheckLogin() = %v, want nil", i+1, err)
+		case want != 0 && (!errors.As(err, &locked) || locked.RetryAfter != want):
+			t.Fatalf("failure %d: CheckLogin() = %v, want retry after %v", i+1, err, want)
+		}
+	}
+
+	if len(db.events) != 1 || db.events[0].Event != models.LockoutEventLocked || db.events[0].Subject != "user:user1" {
+		t.Fatalf("events = %+v, want one lock of user:user1", db.events)
+	}
+
+	// после истечения блокировки следующая ошибка снова блокирует и тоже попадает в аудит
+	now = now.Add(16 * time.Minute)
+	s.LoginFailed(ctx, "user1", "10.0.0.1")
+	if len(db.events) != 2 || db.events[1].Event != models.LockoutEventLocked || db.events[1].Failures != 7 {
+		t.Fatalf("events = %+v, want a second lock after 7 failures", db.events)
+	}
+
+	// другие пользователи с того же адреса не заблокированы
+	if err := s.CheckLogin(ctx, "user2", "10.0.0.1"); err != nil {
+		t.Errorf("CheckLogin(user2) = %v", err)
+	}
+
+	if err := s.Unlock(ctx, "", "", "admin"); !errors.Is(err, ErrNothingToUnlock) {
+		t.Errorf("Unlock() with nothing = %v", err)
+	}
+
+	if err := s.Unlock(ctx, "user1", "", "admin"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := s.CheckLogin(ctx, "user1", "10.0.0.1"); err != nil {
+		t.Errorf("CheckLogin() after unlock = %v", err)
+	}
+	if last := db.events[len(db.events)-1]; last.Event != models.LockoutEventUnlocked || last.Actor != "admin" {
+		t.Errorf("last event = %+v, want unlock by admin", last)
+	}
+}
+
+func TestLockoutService_LogsWithRequestLogger(t *testing.T) {
+	var fallback, request bytes.Buffer
+
+	db := &memoryStorage{now: time.Now, failures: map[string]int{}, locked: map[string]time.Time{}}
+	s := &LockoutService{
+		log:    slog.New(slog.NewTextHandler(&fallback, nil)),
+		db:     db,
+		policy: Policy{MaxUserFailures: 1, MaxIPFailures: 100, Duration: time.Minute, Window: time.Hour},
+		now:    time.Now,
+	}
+
+	// логгер запроса, как его кладёт middleware
+	ctx := logger.WithLogger(context.Background(), slog.New(slog.NewTextHandler(&request, nil)).With(slog.String("request_id", "req-1")))
+
+	s.LoginFailed(ctx, "user1", "10.0.0.1")
+
+	if !strings.Contains(request.String(), "login locked") || !strings.Contains(request.String(), "request_id=req-1") {
+		t.Errorf("request log = %q, want the lock with the request ID", request.String())
+	}
+	if !strings.Contains(request.String(), "op=lockoutService.recordFailure") {
+		t.Errorf("request log = %q, want the op", request.String())
+	}
+	if fallback.Len() != 0 {
+		t.Errorf("service log = %q, want nothing outside of the request logger", fallback.String())
+	}
+}
@@ -0,0 +1,289 @@
+package mfaService
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"image/png"
+	"log/slog"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+	"testovoe/internal/storage/postgres"
+	"time"
+)
+
+const (
+	totpPeriod        = 30
+	totpSkew          = 1
+	qrSize            = 256
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrNotEnrolled    = apperr.Conflict("mfa_not_enrolled", "mfa is not enrolled")
+	ErrAlreadyEnabled = apperr.Conflict("mfa_already_enabled", "mfa is already enabled")
+	ErrInvalidCode    = apperr.Validation("invalid_code", "invalid code")
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Skew:      totpSkew,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+type MFAStorage interface {
+	GetMFA(ctx context.Context, username string) (models.MFA, error)
+	SaveMFASecret(ctx context.Context, username, secret string) error
+	EnableMFA(ctx context.Context, username string, step int64, recoveryHashes []string) error
+	DisableMFA(ctx context.Context, username string) error
+	UseTOTPStep(ctx context.Context, username string, step int64) error
+	UseRecoveryCode(ctx context.Context, username, codeHash string) error
+}
+
+// Enrollment is what the user needs to add the account to an
+// authenticator app.
+type Enrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     []byte `json:"qr_png"`
+}
+
+type MFAService struct {
+	log    *slog.Logger
+	db     MFAStorage
+	issuer string
+	now    func() time.Time
+}
+
+func NewMFAService(log *slog.Logger, db *postgres.Storage, issuer string) *MFAService {
+	return &MFAService{
+		log:    log,
+		db:     db,
+		issuer: issuer,
+		now:    time.Now,
+	}
+}
+
+// Enroll generates a new TOTP secret for the user. It takes effect only
+// after Confirm, so an abandoned enrollment never locks the user out.
+func (s *MFAService) Enroll(ctx context.Context, username string) (Enrollment, error) {
+	const op = "mfaService.Enroll"
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.issuer,
+		AccountName: username,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.db.SaveMFASecret(ctx, username, key.Secret()); err != nil {
+		if errors.Is(err, storage.ErrMFAEnabled) {
+			return Enrollment{}, fmt.Errorf("%s: %w", op, ErrAlreadyEnabled)
+		}
+
+		return Enrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	img, err := key.Image(qrSize, qrSize)
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, img); err != nil {
+		return Enrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "mfa enrollment started", slog.String("owner", username))
+
+	return Enrollment{
+		Secret:     key.Secret(),
+		OTPAuthURI: key.URL(),
+		QRCode:     qr.Bytes(),
+	}, nil
+}
+
+// Confirm enables MFA once the user proves the authenticator works and
+// returns the recovery codes, which are shown only this once.
+func (s *MFAService) Confirm(ctx context.Context, username, code string) ([]string, error) {
+	const op = "mfaService.Confirm"
+
+	mfa, err := s.db.GetMFA(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrNotEnrolled)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if mfa.ConfirmedAt != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrAlreadyEnabled)
+	}
+
+	step, ok := matchStep(mfa.Secret, code, s.now())
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidCode)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		c, err := newRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		codes = append(codes, c)
+		hashes = append(hashes, oa.HashSecret(normalizeRecoveryCode(c)))
+	}
+
+	if err := s.db.EnableMFA(ctx, username, step, hashes); err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrNotEnrolled)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "mfa enabled", slog.String("owner", username))
+
+	return codes, nil
+}
+
+// Disable turns MFA off. It needs a current code from the authenticator,
+// so neither a stolen session nor a recovery code alone can remove the
+// second factor.
+func (s *MFAService) Disable(ctx context.Context, username, code string) error {
+	const op = "mfaService.Disable"
+
+	mfa, err := s.db.GetMFA(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNotEnrolled)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	step, ok := matchStep(mfa.Secret, strings.TrimSpace(code), s.now())
+	if !ok {
+		return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+	}
+
+	if mfa.ConfirmedAt != nil {
+		if err := s.db.UseTOTPStep(ctx, username, step); err != nil {
+			if errors.Is(err, storage.ErrMFACodeUsed) {
+				return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+			}
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := s.db.DisableMFA(ctx, username); err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNotEnrolled)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "mfa disabled", slog.String("owner", username))
+
+	return nil
+}
+
+// CheckMFA implements oauth.MFAVerifier. The code is either a TOTP code or
+// one of the recovery codes; both can be used only once.
+func (s *MFAService) CheckMFA(ctx context.Context, username, code string) error {
+	const op = "mfaService.CheckMFA"
+
+	mfa, err := s.db.GetMFA(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if mfa.ConfirmedAt == nil {
+		return nil
+	}
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return oa.ErrMFARequired
+	}
+
+	if step, ok := matchStep(mfa.Secret, code, s.now()); ok {
+		err = s.db.UseTOTPStep(ctx, username, step)
+	} else {
+		err = s.db.UseRecoveryCode(ctx, username, oa.HashSecret(normalizeRecoveryCode(code)))
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrMFACodeUsed) {
+			return oa.ErrInvalidMFACode
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// matchStep returns the time step the code was generated for, within the
+// allowed clock skew.
+func matchStep(secret, code string, now time.Time) (int64, bool) {
+	if len(code) != totpOpts.Digits.Length() {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totpOpts)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCode returns a code like "k3j5q-7hx2m".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	c := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+
+	return c[:5] + "-" + c[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,224 @@
+package mfaService
+
+import (
+	"context"
+	"errors"
+	"github.com/pquerna/otp/totp"
+	"io"
+	"log/slog"
+	"testing"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+	"time"
+)
+
+// memoryStorage - хранилище в памяти с той же семантикой, что и postgres
+type memoryStorage struct {
+	mfa      map[string]models.MFA
+	recovery map[string]bool
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{mfa: make(map[string]models.MFA), recovery: make(map[string]bool)}
+}
+
+func (m *memoryStorage) GetMFA(ctx context.Context, username string) (models.MFA, error) {
+	mfa, ok := m.mfa[username]
+	if !ok {
+		return models.MFA{}, storage.ErrMFANotFound
+	}
+
+	return mfa, nil
+}
+
+func (m *memoryStorage) SaveMFASecret(ctx context.Context, username, secret string) error {
+	if mfa, ok := m.mfa[username]; ok && mfa.ConfirmedAt != nil {
+		return storage.ErrMFAEnabled
+	}
+	m.mfa[username] = models.MFA{Username: username, Secret: secret}
+
+	return nil
+}
+
+func (m *memoryStorage) EnableMFA(ctx context.Context, username string, step int64, recoveryHashes []string) error {
+	mfa, ok := m.mfa[username]
+	if !ok || mfa.ConfirmedAt != nil {
+		return storage.ErrMFANotFound
+	}
+	now := time.Now()
+	mfa.ConfirmedAt, mfa.LastStep = &now, step
+	m.mfa[username] = mfa
+	for _, h := range recoveryHashes {
+		m.recovery[username+h] = true
+	}
+
+	return nil
+}
+
+func (m *memoryStorage) DisableMFA(ctx context.Context, username string) error {
+	if _, ok := m.mfa[username]; !ok {
+		return storage.ErrMFANotFound
+	}
+	delete(m.mfa, username)
+
+	return nil
+}
+
+func (m *memoryStorage) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	mfa := m.mfa[username]
+	if mfa.LastStep >= step {
+		return storage.ErrMFACodeUsed
+	}
+	mfa.LastStep = step
+	m.mfa[username] = mfa
+
+	return nil
+}
+
+func (m *memoryStorage) UseRecoveryCode(ctx context.Context, username, codeHash string) error {
+	if !m.recovery[username+codeHash] {
+		return storage.ErrMFACodeUsed
+	}
+	m.recovery[username+codeHash] = false
+
+	return nil
+}
+
+func TestMFAService(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 9, 30, 12, 0, 0, 0, time.UTC)
+	s := &MFAService{
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		db:     newMemoryStorage(),
+		issuer: "notes-service",
+		now:    func() time.Time { return now },
+	}
+
+	// без MFA код не нужен
+	if err := s.CheckMFA(ctx, "user1", ""); err != nil {
+		t.Fatalf("CheckMFA() without enrollment = %v", err)
+	}
+
+	enrollment, err := s.Enroll(ctx, "user1")
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if len(enrollment.QRCode) == 0 || enrollment.OTPAuthURI == "" {
+		t.Fatalf("Enroll() = %+v", enrollment)
+	}
+
+	// незавершённая регистрация не блокирует вход
+	if err := s.CheckMFA(ctx, "user1", ""); err != nil {
+		t.Fatalf("CheckMFA() with pending enrollment = %v", err)
+	}
+
+	if _, err := s.Confirm(ctx, "user1", "000000"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Confirm(wrong code) error = %v, want ErrInvalidCode", err)
+	}
+
+	code, _ := totp.GenerateCode(enrollment.Secret, now)
+	recovery, err := s.Confirm(ctx, "user1", code)
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes", len(recovery))
+	}
+
+	if _, err := s.Enroll(ctx, "user1"); !errors.Is(err, ErrAlreadyEnabled) {
+		t.Errorf("Enroll() after confirm error = %v, want ErrAlreadyEnabled", err)
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		code    func(at time.Time) string
+		wantErr error
+	}{
+		{name: "missing code", at: now, code: func(time.Time) string { return "" }, wantErr: oa.ErrMFARequired},
+		{name: "confirmation code replayed", at: now, code: func(time.Time) string { return code }, wantErr: oa.ErrInvalidMFACode},
+		{name: "next code", at: now.Add(30 * time.Second), code: totpCode(t, enrollment.Secret)},
+		{name: "next code replayed", at: now.Add(30 * time.Second), code: totpCode(t, enrollment.Secret), wantErr: oa.ErrInvalidMFACode},
+		{name: "recovery code", at: now, code: func(time.Time) string { return recovery[0] }},
+		{name: "recovery code without dash", at: now, code: func(time.Time) string { return "  " + recovery[1][:5] + recovery[1][6:] }},
+		{name: "recovery code reused", at: now, code: func(time.Time) string { return recovery[0] }, wantErr: oa.ErrInvalidMFACode},
+		{name: "wrong code", at: now.Add(time.Hour), code: func(time.Time) string { return "123456" }, wantErr: oa.ErrInvalidMFACode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.now = func() time.Time { return tt.at }
+
+			if err := s.CheckMFA(ctx, "user1", tt.code(tt.at)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckMFA() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func totpCode(t *testing.T, secret string) func(at time.Time) string {
+	return func(at time.Time) string {
+		code, err := totp.GenerateCode(secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return code
+	}
+}
+
+func TestMFAService_Disable(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 9, 30, 12, 0, 0, 0, time.UTC)
+	s := &MFAService{
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		db:     newMemoryStorage(),
+		issuer: "notes-service",
+		now:    func() time.Time { return now },
+	}
+
+	if err := s.Disable(ctx, "user1", "123456"); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("Disable() without enrollment error = %v, want ErrNotEnrolled", err)
+	}
+
+	enrollment, err := s.Enroll(ctx, "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpCode(t, enrollment.Secret)
+	recovery, err := s.Confirm(ctx, "user1", code(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := now.Add(30 * time.Second)
+	s.now = func() time.Time { return later }
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{name: "missing code", code: ""},
+		{name: "wrong code", code: "000000"},
+		// код подтверждения уже использован
+		{name: "replayed code", code: code(now)},
+		// код восстановления не заменяет аутентификатор
+		{name: "recovery code", code: recovery[0]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Disable(ctx, "user1", tt.code); !errors.Is(err, ErrInvalidCode) {
+				t.Errorf("Disable() error = %v, want ErrInvalidCode", err)
+			}
+		})
+	}
+
+	if err := s.Disable(ctx, "user1", code(later)); err != nil {
+		t.Fatalf("Disable() error = %v", err)
+	}
+	if err := s.CheckMFA(ctx, "user1", ""); err != nil {
+		t.Errorf("CheckMFA() after Disable error = %v", err)
+	}
+}
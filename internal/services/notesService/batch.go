@@ -0,0 +1,162 @@
+package notesService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/lib/tracing"
+	"testovoe/internal/models"
+)
+
+var (
+	ErrInvalidOperation = apperr.Validation("invalid_operation", "invalid batch operation")
+	ErrBatchAborted     = errors.New("batch aborted")
+)
+
+// Batch applies the operations in order. In atomic mode they run in a
+// single transaction that is rolled back on the first failure, and the
+// operations after it are not attempted; otherwise every operation is
+// applied on its own. The returned results always match ops one to one,
+// and the flag reports whether anything was persisted.
+func (s *NotesService) Batch(ctx context.Context, ops []models.BatchOperation, owner string, atomic bool) (_ []models.BatchResult, _ bool, err error) {
+	const op = "notesService.Batch"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "applying batch",
+		slog.String("owner", owner),
+		slog.Int("operations", len(ops)),
+		slog.Bool("atomic", atomic),
+	)
+
+	results := make([]models.BatchResult, len(ops))
+	for i, o := range ops {
+		results[i] = models.BatchResult{Index: i, Op: o.Op, ID: o.ID, Status: models.BatchStatusSkipped}
+	}
+
+	if !atomic {
+		committed := false
+		for i, o := range ops {
+			if s.applyBatchOperation(ctx, o, owner, &results[i], true) {
+				committed = true
+			}
+		}
+		s.countCreated(ops, results)
+
+		return results, committed, nil
+	}
+
+	// the speller is asked before the transaction opens, so that it is
+	// not held across network calls
+	for i, o := range ops {
+		if err := s.checkBatchOperation(ctx, o, owner); err != nil {
+			results[i].Status = models.BatchStatusError
+			results[i].Error = apperr.PublicMessage(err)
+			return results, false, nil
+		}
+	}
+
+	err = s.db.InTx(ctx, func(ctx context.Context) error {
+		for i, o := range ops {
+			if !s.applyBatchOperation(ctx, o, owner, &results[i], false) {
+				return ErrBatchAborted
+			}
+		}
+
+		return nil
+	})
+	if err == nil {
+		s.countCreated(ops, results)
+		return results, true, nil
+	}
+
+	for i := range results {
+		if results[i].Status == models.BatchStatusOK {
+			results[i].Status = models.BatchStatusRolledBack
+			if ops[i].Op == models.BatchOpCreate {
+				results[i].ID = ""
+			}
+		}
+	}
+
+	if !errors.Is(err, ErrBatchAborted) {
+		log.ErrorContext(ctx, "failed to commit batch", slog.String("error", err.Error()))
+		return results, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, false, nil
+}
+
+// checkBatchOperation validates the operation and spellchecks its content.
+func (s *NotesService) checkBatchOperation(ctx context.Context, o models.BatchOperation, owner string) error {
+	if err := validateBatchOperation(o); err != nil {
+		return err
+	}
+
+	if o.Op == models.BatchOpDelete {
+		return nil
+	}
+
+	return s.checkSpelling(ctx, o.Content, owner)
+}
+
+func validateBatchOperation(o models.BatchOperation) error {
+	switch o.Op {
+	case models.BatchOpCreate:
+		if o.Content == "" {
+			return ErrInvalidOperation
+		}
+	case models.BatchOpUpdate:
+		if o.ID == "" || o.Content == "" {
+			return ErrInvalidOperation
+		}
+	case models.BatchOpDelete:
+		if o.ID == "" {
+			return ErrInvalidOperation
+		}
+	default:
+		return ErrInvalidOperation
+	}
+
+	return nil
+}
+
+func (s *NotesService) applyBatchOperation(ctx context.Context, o models.BatchOperation, owner string, result *models.BatchResult, checkSpelling bool) bool {
+	err := validateBatchOperation(o)
+	if err == nil {
+		switch o.Op {
+		case models.BatchOpCreate:
+			result.ID, err = s.addNote(ctx, o.Content, owner, checkSpelling)
+		case models.BatchOpUpdate:
+			err = s.updateNote(ctx, o.ID, o.Content, owner, checkSpelling)
+		case models.BatchOpDelete:
+			err = s.DeleteNote(ctx, o.ID, owner)
+		}
+	}
+
+	if err != nil {
+		result.Status = models.BatchStatusError
+		result.Error = apperr.PublicMessage(err)
+		return false
+	}
+
+	result.Status = models.BatchStatusOK
+
+	return true
+}
+
+// countCreated counts the notes a batch has persisted, which is only known
+// once its transaction is committed.
+func (s *NotesService) countCreated(ops []models.BatchOperation, results []models.BatchResult) {
+	for i, o := range ops {
+		if o.Op == models.BatchOpCreate && results[i].Status == models.BatchStatusOK {
+			s.metrics.NoteCreated()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package notesService
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testovoe/internal/lib/frontmatter"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/lib/tracing"
+	"testovoe/internal/models"
+	"time"
+	"unicode"
+)
+
+const maxFileNameLen = 64
+
+type exportFrontMatter struct {
+	ID        string    `yaml:"id"`
+	Title     string    `yaml:"title,omitempty"`
+	Owner     string    `yaml:"owner"`
+	Tags      []string  `yaml:"tags,omitempty"`
+	Notebook  string    `yaml:"notebook,omitempty"`
+	CreatedAt time.Time `yaml:"created_at"`
+	UpdatedAt time.Time `yaml:"updated_at"`
+}
+
+// ExportNotes writes every note of the owner to w as a ZIP archive with one
+// Markdown file per note, placed in the directory of its notebook. Notes
+// are read and compressed one at a time, so memory usage does not grow with
+// the size of the account.
+func (s *NotesService) ExportNotes(ctx context.Context, owner string, w io.Writer) (err error) {
+	const op = "notesService.ExportNotes"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "exporting notes", slog.String("owner", owner))
+
+	zw := zip.NewWriter(w)
+	used := make(map[string]struct{})
+	count := 0
+
+	err = s.db.IterateNotes(ctx, owner, func(note models.Note) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		title := noteTitle(note.Content)
+
+		f, err := zw.Create(uniqueFileName(used, notebookDir(note.Notebook), title, note.ID))
+		if err != nil {
+			return err
+		}
+
+		count++
+
+		return frontmatter.Write(f, exportFrontMatter{
+			ID:        note.ID,
+			Title:     title,
+			Owner:     note.Owner,
+			Tags:      note.Tags,
+			Notebook:  note.Notebook,
+			CreatedAt: note.CreatedAt.UTC(),
+			UpdatedAt: note.UpdatedAt.UTC(),
+		}, note.Content)
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to export notes", slog.String("owner", owner), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "notes exported", slog.String("owner", owner), slog.Int("count", count))
+
+	return nil
+}
+
+// noteTitle takes the first non-empty line of the content, without
+// Markdown heading markers, as the title of the note.
+func noteTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		if line != "" {
+			return line
+		}
+	}
+
+	return ""
+}
+
+// notebookDir turns a slash separated notebook path into the directory of
+// its notes in the archive, dropping segments that sanitize to nothing.
+func notebookDir(notebook string) string {
+	var dirs []string
+
+	for _, segment := range strings.Split(notebook, "/") {
+		if dir := sanitizeFileName(segment); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return strings.Join(dirs, "/")
+}
+
+// uniqueFileName turns a title into a safe archive path inside dir, falling
+// back to the note ID when the title is empty and disambiguating duplicates
+// with it.
+func uniqueFileName(used map[string]struct{}, dir, title, noteId string) string {
+	name := sanitizeFileName(title)
+	if name == "" {
+		name = noteId
+	}
+	if dir != "" {
+		name = dir + "/" + name
+	}
+
+	if _, ok := used[name]; ok {
+		name = fmt.Sprintf("%s-%s", name, noteId)
+	}
+	used[name] = struct{}{}
+
+	return name + ".md"
+}
+
+func sanitizeFileName(title string) string {
+	var b strings.Builder
+
+	for _, r := range title {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_', r == ' ':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+
+	name := strings.Trim(b.String(), " -")
+
+	if runes := []rune(name); len(runes) > maxFileNameLen {
+		name = strings.TrimRight(string(runes[:maxFileNameLen]), " -")
+	}
+
+	return name
+}
@@ -0,0 +1,58 @@
+package notesService
+
+import "testing"
+
+func TestUniqueFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		notebook string
+		title    string
+		noteId   string
+		expected string
+	}{
+		{
+			name:     "Title",
+			title:    "Shopping list",
+			noteId:   "1",
+			expected: "Shopping list.md",
+		},
+		{
+			name:     "Empty Title",
+			noteId:   "2",
+			expected: "2.md",
+		},
+		{
+			name:     "Nested Notebook",
+			notebook: "Work/Projects",
+			title:    "Roadmap",
+			noteId:   "3",
+			expected: "Work/Projects/Roadmap.md",
+		},
+		{
+			name:     "Notebook Escaping The Archive",
+			notebook: "../../etc//",
+			title:    "passwd",
+			noteId:   "4",
+			expected: "etc/passwd.md",
+		},
+		{
+			name:     "Duplicate In Notebook",
+			notebook: "Work/Projects",
+			title:    "Roadmap",
+			noteId:   "5",
+			expected: "Work/Projects/Roadmap-5.md",
+		},
+	}
+
+	// имена уникальны в пределах всего архива, поэтому used общий для всех случаев
+	used := make(map[string]struct{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uniqueFileName(used, notebookDir(tt.notebook), tt.title, tt.noteId)
+			if got != tt.expected {
+				t.Errorf("uniqueFileName() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
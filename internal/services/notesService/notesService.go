@@ -2,94 +2,348 @@ package notesService
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 	"log/slog"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/lib/markdown"
+	"testovoe/internal/lib/metrics"
+	"testovoe/internal/lib/tracing"
 	"testovoe/internal/middlewares"
 	"testovoe/internal/models"
 	spellcheck "testovoe/internal/services/spellchecker"
+	"testovoe/internal/storage"
 	"testovoe/internal/storage/postgres"
+	"time"
+)
+
+const tracerName = "testovoe/internal/services/notesService"
+
+var (
+	ErrNoteNotFound       = apperr.NotFound("note_not_found", "note not found")
+	ErrSpellingErrors     = apperr.Validation("spelling_errors", "content has spelling errors")
+	ErrSpellerUnavailable = apperr.Unavailable("speller_unavailable", "spell checker is unavailable")
+	ErrEmptyQuery         = apperr.Validation("empty_query", "search query is empty")
 )
 
 type NotesStorage interface {
-	AddNote(noteId, content, owner string) (string, error)
-	GetNotes(owner string) ([]models.Note, error)
+	AddNote(ctx context.Context, noteId, content, owner string) (string, error)
+	GetNotes(ctx context.Context, owner string) ([]models.Note, error)
+	GetNote(ctx context.Context, noteId, owner string) (models.Note, error)
+	GetNotesByIDs(ctx context.Context, owner string, ids []string) ([]models.Note, error)
+	SearchNotes(ctx context.Context, owner, query string, limit int) ([]models.Note, error)
+	IterateNotes(ctx context.Context, owner string, fn func(note models.Note) error) error
+	UpdateNote(ctx context.Context, noteId, content, owner string, baseVersion int64) (int64, error)
+	DeleteNote(ctx context.Context, noteId, owner string, baseVersion int64) (int64, error)
+	GetNoteState(ctx context.Context, noteId, owner string) (models.NoteChange, error)
+	GetChanges(ctx context.Context, owner string, since int64, limit int) ([]models.NoteChange, error)
+	GetChangeSeq(ctx context.Context, owner string) (int64, error)
+	ListTags(ctx context.Context, owner string, limit int) ([]models.Tag, error)
+	ListNotebooks(ctx context.Context, owner string, limit int) ([]models.Notebook, error)
+	ShareNote(ctx context.Context, noteId, owner, username string, limit int) error
+	UnshareNote(ctx context.Context, noteId, owner, username string) error
+	GetNoteShares(ctx context.Context, owner string, ids []string) ([]models.NoteShare, error)
+	GetSharedNotes(ctx context.Context, username string, limit int) ([]models.Note, error)
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
 	Close()
 }
 
+type Renderer interface {
+	Render(source string) (string, error)
+}
+
+type Metrics interface {
+	ObserveSpellcheck(d time.Duration, err error)
+	NoteCreated()
+}
+
 type NotesService struct {
-	log *slog.Logger
-	db  NotesStorage
+	log      *slog.Logger
+	db       NotesStorage
+	renderer Renderer
+	metrics  Metrics
 }
 
-func NewNotesService(log *slog.Logger, db *postgres.Storage) *NotesService {
+func NewNotesService(log *slog.Logger, db *postgres.Storage, renderer *markdown.Renderer, metrics *metrics.Metrics) *NotesService {
 	return &NotesService{
-		log: log,
-		db:  db,
+		log:      log,
+		db:       db,
+		renderer: renderer,
+		metrics:  metrics,
 	}
 }
 
 func (s *NotesService) AddNote(ctx context.Context, content, owner string) (string, error) {
-	const op = "notesService.AddNote"
-
-	s.log.With(
-		slog.String("op", op),
-		slog.String(owner, owner),
-		slog.String("request id", middleware.GetReqID(ctx)),
-	)
+	noteID, err := s.addNote(ctx, content, owner, true)
+	if err == nil {
+		s.metrics.NoteCreated()
+	}
 
-	s.log.Info("checking if content has spelling errors", slog.String("owner", owner))
+	return noteID, err
+}
 
-	spellErrors, err := spellcheck.CheckSpelling(content)
-	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+// ImportNote stores a note coming from a bulk import, where spellchecking
+// is optional so that large archives do not have to go through the speller.
+func (s *NotesService) ImportNote(ctx context.Context, content, owner string, checkSpelling bool) (string, error) {
+	noteID, err := s.addNote(ctx, content, owner, checkSpelling)
+	if err == nil {
+		s.metrics.NoteCreated()
 	}
 
-	if len(spellErrors) > 0 {
-		return "", fmt.Errorf("content has spelling errors")
+	return noteID, err
+}
+
+// addNote stores the note without counting it, since inside a batch
+// transaction it may still be rolled back.
+
+func (s *NotesService) addNote(ctx context.Context, content, owner string, checkSpelling bool) (_ string, err error) {
+	const op = "notesService.addNote"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	if checkSpelling {
+		if err := s.checkSpelling(ctx, content, owner); err != nil {
+			return "", err
+		}
 	}
 
-	s.log.Info("creating uuid for note", slog.String("owner", owner))
+	log.InfoContext(ctx, "creating uuid for note", slog.String("owner", owner))
 
 	noteId, err := middlewares.UUIDGenerator()
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	s.log.Info("adding note", slog.String("owner", owner))
+	log.InfoContext(ctx, "adding note", slog.String("owner", owner))
 
-	noteID, err := s.db.AddNote(noteId.String(), content, owner)
+	noteID, err := s.db.AddNote(ctx, noteId.String(), content, owner)
 	if err != nil {
-		s.log.Error("failed to add note to the database", slog.String("error", err.Error()))
+		log.ErrorContext(ctx, "failed to add note to the database", slog.String("error", err.Error()))
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	s.log.Info("note added", slog.String("owner", owner))
+	log.InfoContext(ctx, "note added", slog.String("owner", owner))
 
 	return noteID, nil
 }
 
-func (s *NotesService) GetNotes(ctx context.Context, owner string) ([]models.Note, error) {
+func (s *NotesService) GetNotes(ctx context.Context, owner string) (_ []models.Note, err error) {
 	const op = "notesService.GetNotes"
 
-	s.log.With(
-		slog.String("op", op),
-		slog.String(owner, owner),
-		slog.String("request id", middleware.GetReqID(ctx)),
-	)
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "getting notes", slog.String("owner", owner))
+
+	notes, err := s.db.GetNotes(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "got notes", slog.String("owner", owner))
+
+	return notes, nil
+}
+
+// GetNotesByIDs returns the owner's notes among noteIds in one query, for
+// callers that batch lookups. Unknown IDs are left out.
+func (s *NotesService) GetNotesByIDs(ctx context.Context, noteIds []string, owner string) (_ []models.Note, err error) {
+	const op = "notesService.GetNotesByIDs"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
 
-	s.log.Info("getting notes", slog.String("owner", owner))
+	log.InfoContext(ctx, "getting notes by id", slog.String("owner", owner), slog.Int("count", len(noteIds)))
 
-	notes, err := s.db.GetNotes(owner)
+	notes, err := s.db.GetNotesByIDs(ctx, owner, noteIds)
 	if err != nil {
+		log.ErrorContext(ctx, "failed to get notes from the database", slog.String("error", err.Error()))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	s.log.Info("got notes", slog.String("owner", owner))
+	return notes, nil
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchNotes returns the owner's notes matching the full-text query, best
+// match first. A limit out of range falls back to the default or maximum.
+func (s *NotesService) SearchNotes(ctx context.Context, owner, query string, limit int) (_ []models.Note, err error) {
+	const op = "notesService.SearchNotes"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrEmptyQuery)
+	}
+
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	log.InfoContext(ctx, "searching notes", slog.String("owner", owner))
+
+	notes, err := s.db.SearchNotes(ctx, owner, query, limit)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to search notes in the database", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
 	return notes, nil
 }
 
+func (s *NotesService) UpdateNote(ctx context.Context, noteId, content, owner string) error {
+	return s.updateNote(ctx, noteId, content, owner, true)
+}
+
+func (s *NotesService) updateNote(ctx context.Context, noteId, content, owner string, checkSpelling bool) (err error) {
+	const op = "notesService.UpdateNote"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	if uuid.Validate(noteId) != nil {
+		return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+	}
+
+	if checkSpelling {
+		if err := s.checkSpelling(ctx, content, owner); err != nil {
+			return err
+		}
+	}
+
+	log.InfoContext(ctx, "updating note", slog.String("owner", owner), slog.String("note_id", noteId))
+
+	if _, err := s.db.UpdateNote(ctx, noteId, content, owner, 0); err != nil {
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to update note in the database", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *NotesService) DeleteNote(ctx context.Context, noteId, owner string) (err error) {
+	const op = "notesService.DeleteNote"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	if uuid.Validate(noteId) != nil {
+		return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+	}
+
+	log.InfoContext(ctx, "deleting note", slog.String("owner", owner), slog.String("note_id", noteId))
+
+	if _, err := s.db.DeleteNote(ctx, noteId, owner, 0); err != nil {
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to delete note from the database", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *NotesService) GetNote(ctx context.Context, noteId, owner string) (_ models.Note, err error) {
+	const op = "notesService.GetNote"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	if uuid.Validate(noteId) != nil {
+		return models.Note{}, fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+	}
+
+	log.InfoContext(ctx, "getting note", slog.String("owner", owner), slog.String("note_id", noteId))
+
+	note, err := s.db.GetNote(ctx, noteId, owner)
+	if err != nil {
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			return models.Note{}, fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+		}
+
+		return models.Note{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return note, nil
+}
+
+func (s *NotesService) RenderNote(ctx context.Context, noteId, owner string) (_ string, err error) {
+	const op = "notesService.RenderNote"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	note, err := s.GetNote(ctx, noteId, owner)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "rendering note", slog.String("owner", owner), slog.String("note_id", noteId))
+
+	html, err := s.renderer.Render(note.Content)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return html, nil
+}
+
+func (s *NotesService) checkSpelling(ctx context.Context, content, owner string) (err error) {
+	const op = "notesService.checkSpelling"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "checking if content has spelling errors", slog.String("owner", owner))
+
+	start := time.Now()
+	spellErrors, err := spellcheck.CheckSpelling(ctx, content)
+	s.metrics.ObserveSpellcheck(time.Since(start), err)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrSpellerUnavailable, err)
+	}
+
+	if len(spellErrors) > 0 {
+		return ErrSpellingErrors
+	}
+
+	return nil
+}
+
 func (s *NotesService) Close() {
 	s.db.Close()
 }
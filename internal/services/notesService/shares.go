@@ -0,0 +1,189 @@
+package notesService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/lib/tracing"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+const (
+	// MaxNoteShares is how many users one note can be shared with.
+	MaxNoteShares = 50
+
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+var (
+	ErrShareWithOwner    = apperr.Validation("share_with_owner", "a note cannot be shared with its owner")
+	ErrShareUserNotFound = apperr.NotFound("user_not_found", "user not found")
+	ErrShareLimit        = apperr.Conflict("share_limit_reached", "note is shared with too many users")
+)
+
+// ShareNote gives username read access to a note of the owner. Sharing it
+// again with the same user is not an error.
+func (s *NotesService) ShareNote(ctx context.Context, noteId, username, owner string) (err error) {
+	const op = "notesService.ShareNote"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	if uuid.Validate(noteId) != nil {
+		return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return fmt.Errorf("%s: %w", op, ErrShareUserNotFound)
+	}
+	if username == owner {
+		return fmt.Errorf("%s: %w", op, ErrShareWithOwner)
+	}
+
+	log.InfoContext(ctx, "sharing note", slog.String("owner", owner), slog.String("note_id", noteId), slog.String("username", username))
+
+	if err := s.db.ShareNote(ctx, noteId, owner, username, MaxNoteShares); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNoteNotFound):
+			return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+		case errors.Is(err, storage.ErrUserNotFound):
+			return fmt.Errorf("%s: %w", op, ErrShareUserNotFound)
+		case errors.Is(err, storage.ErrShareLimit):
+			return fmt.Errorf("%s: %w", op, ErrShareLimit)
+		}
+
+		log.ErrorContext(ctx, "failed to share note in the database", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UnshareNote takes back the access of username to a note of the owner.
+func (s *NotesService) UnshareNote(ctx context.Context, noteId, username, owner string) (err error) {
+	const op = "notesService.UnshareNote"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	if uuid.Validate(noteId) != nil {
+		return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+	}
+
+	log.InfoContext(ctx, "unsharing note", slog.String("owner", owner), slog.String("note_id", noteId), slog.String("username", username))
+
+	if err := s.db.UnshareNote(ctx, noteId, owner, strings.TrimSpace(username)); err != nil {
+		if errors.Is(err, storage.ErrNoteNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNoteNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to unshare note in the database", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetNoteShares returns who the owner's notes among noteIds are shared
+// with, in one query, for callers that batch lookups.
+func (s *NotesService) GetNoteShares(ctx context.Context, noteIds []string, owner string) (_ []models.NoteShare, err error) {
+	const op = "notesService.GetNoteShares"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "getting note shares", slog.String("owner", owner), slog.Int("count", len(noteIds)))
+
+	shares, err := s.db.GetNoteShares(ctx, owner, noteIds)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get note shares from the database", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return shares, nil
+}
+
+// GetSharedNotes returns the notes other users shared with username, most
+// recently updated first.
+func (s *NotesService) GetSharedNotes(ctx context.Context, username string, limit int) (_ []models.Note, err error) {
+	const op = "notesService.GetSharedNotes"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "getting shared notes", slog.String("username", username))
+
+	notes, err := s.db.GetSharedNotes(ctx, username, listLimit(limit))
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get shared notes from the database", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return notes, nil
+}
+
+// ListTags returns the owner's tags with the number of notes carrying
+// each, most used first.
+func (s *NotesService) ListTags(ctx context.Context, owner string, limit int) (_ []models.Tag, err error) {
+	const op = "notesService.ListTags"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "listing tags", slog.String("owner", owner))
+
+	tags, err := s.db.ListTags(ctx, owner, listLimit(limit))
+	if err != nil {
+		log.ErrorContext(ctx, "failed to list tags in the database", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tags, nil
+}
+
+// ListNotebooks returns the owner's notebooks with the number of notes in
+// each, by path.
+func (s *NotesService) ListNotebooks(ctx context.Context, owner string, limit int) (_ []models.Notebook, err error) {
+	const op = "notesService.ListNotebooks"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	log.InfoContext(ctx, "listing notebooks", slog.String("owner", owner))
+
+	notebooks, err := s.db.ListNotebooks(ctx, owner, listLimit(limit))
+	if err != nil {
+		log.ErrorContext(ctx, "failed to list notebooks in the database", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return notebooks, nil
+}
+
+func listLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultListLimit
+	}
+
+	return min(limit, MaxListLimit)
+}
@@ -0,0 +1,232 @@
+package notesService
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/lib/tracing"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+const (
+	DefaultSyncLimit = 100
+	MaxSyncLimit     = 1000
+
+	syncTokenPrefix = "v1:"
+)
+
+var (
+	ErrInvalidSyncToken = apperr.Validation("invalid_sync_token", "invalid sync token")
+)
+
+// GetChanges returns the notes created, updated or deleted since the point
+// of the owner's change sequence encoded in token. An empty token starts
+// from the beginning. NextToken resumes after the last returned change.
+func (s *NotesService) GetChanges(ctx context.Context, owner, token string, limit int) (_ models.ChangeSet, err error) {
+	const op = "notesService.GetChanges"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.For(ctx, s.log, op)
+
+	since, err := decodeSyncToken(token)
+	if err != nil {
+		return models.ChangeSet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if limit <= 0 || limit > MaxSyncLimit {
+		limit = DefaultSyncLimit
+	}
+
+	log.InfoContext(ctx, "getting changes", slog.String("owner", owner), slog.Int64("since", since))
+
+	// one extra row tells whether there is another page
+	changes, err := s.db.GetChanges(ctx, owner, since, limit+1)
+	if err != nil {
+		return models.ChangeSet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	set := models.ChangeSet{
+		Changes:   changes,
+		NextToken: token,
+	}
+
+	if len(changes) > limit {
+		set.Changes = changes[:limit]
+		set.HasMore = true
+	}
+
+	if n := len(set.Changes); n > 0 {
+		set.NextToken = encodeSyncToken(set.Changes[n-1].Seq)
+	} else if token == "" {
+		set.NextToken = encodeSyncToken(0)
+	}
+
+	return set, nil
+}
+
+// CurrentSyncToken returns a token pointing at the owner's latest change,
+// for clients interested only in what changes from now on.
+func (s *NotesService) CurrentSyncToken(ctx context.Context, owner string) (_ string, err error) {
+	const op = "notesService.CurrentSyncToken"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer func() { tracing.End(span, err) }()
+
+	seq, err := s.db.GetChangeSeq(ctx, owner)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return encodeSyncToken(seq), nil
+}
+
+// PushChanges applies changes made on a client while it was offline. A
+// change is only applied when the note is still at the version the client
+// based it on; otherwise it is reported as a conflict together with the
+// current server state so the client can merge and retry.
+func (s *NotesService) PushChanges(ctx context.Context, changes []models.PushChange, owner string) []models.PushResult {
+	const op = "notesService.PushChanges"
+
+	log := logger.For(ctx, s.log, op)
+	log.InfoContext(ctx, "pushing changes", slog.String("owner", owner), slog.Int("changes", len(changes)))
+
+	results := make([]models.PushResult, len(changes))
+
+	for i, change := range changes {
+		results[i] = s.pushChange(ctx, change, owner)
+	}
+
+	return results
+}
+
+func (s *NotesService) pushChange(ctx context.Context, change models.PushChange, owner string) models.PushResult {
+	const op = "notesService.pushChange"
+
+	ctx, span := tracing.Start(ctx, tracerName, op)
+	defer span.End()
+
+	log := logger.For(ctx, s.log, op)
+
+	result := models.PushResult{ID: change.ID}
+
+	reject := func(err error) models.PushResult {
+		tracing.Fail(span, err)
+		result.Status = models.SyncStatusRejected
+		result.Error = apperr.PublicMessage(err)
+		return result
+	}
+	conflict := func() models.PushResult {
+		current, err := s.db.GetNoteState(ctx, change.ID, owner)
+		if err != nil {
+			return reject(err)
+		}
+		result.Status = models.SyncStatusConflict
+		result.Server = &current
+		return result
+	}
+
+	if uuid.Validate(change.ID) != nil || change.BaseVersion < 0 || (!change.Deleted && change.Content == "") {
+		return reject(ErrInvalidOperation)
+	}
+
+	current, err := s.db.GetNoteState(ctx, change.ID, owner)
+	switch {
+	case errors.Is(err, storage.ErrNoteNotFound):
+		if change.BaseVersion != 0 {
+			return reject(ErrNoteNotFound)
+		}
+		if change.Deleted {
+			// created and deleted offline, nothing to do
+			result.Status = models.SyncStatusApplied
+			return result
+		}
+		if err := s.checkSpelling(ctx, change.Content, owner); err != nil {
+			return reject(err)
+		}
+		if _, err := s.db.AddNote(ctx, change.ID, change.Content, owner); err != nil {
+			if errors.Is(err, storage.ErrNoteExists) {
+				// the ID is taken by another owner
+				return reject(ErrInvalidOperation)
+			}
+			log.ErrorContext(ctx, "failed to push note", slog.String("error", err.Error()))
+			return reject(err)
+		}
+		s.metrics.NoteCreated()
+		result.Status = models.SyncStatusApplied
+		result.Version = 1
+		return result
+	case err != nil:
+		log.ErrorContext(ctx, "failed to get note state", slog.String("error", err.Error()))
+		return reject(err)
+	}
+
+	if current.Deleted && change.Deleted {
+		result.Status = models.SyncStatusApplied
+		result.Version = current.Version
+		return result
+	}
+
+	if current.Version != change.BaseVersion || current.Deleted {
+		result.Status = models.SyncStatusConflict
+		result.Server = &current
+		return result
+	}
+
+	if change.Deleted {
+		result.Version, err = s.db.DeleteNote(ctx, change.ID, owner, change.BaseVersion)
+	} else {
+		if err := s.checkSpelling(ctx, change.Content, owner); err != nil {
+			return reject(err)
+		}
+		result.Version, err = s.db.UpdateNote(ctx, change.ID, change.Content, owner, change.BaseVersion)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrVersionConflict) || errors.Is(err, storage.ErrNoteNotFound) {
+			// lost a race with another writer after the state was read
+			return conflict()
+		}
+		log.ErrorContext(ctx, "failed to push note", slog.String("error", err.Error()))
+		return reject(err)
+	}
+
+	result.Status = models.SyncStatusApplied
+
+	return result
+}
+
+func encodeSyncToken(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncTokenPrefix + strconv.FormatInt(seq, 10)))
+}
+
+func decodeSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidSyncToken
+	}
+
+	seq, ok := strings.CutPrefix(string(raw), syncTokenPrefix)
+	if !ok {
+		return 0, ErrInvalidSyncToken
+	}
+
+	since, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil || since < 0 {
+		return 0, ErrInvalidSyncToken
+	}
+
+	return since, nil
+}
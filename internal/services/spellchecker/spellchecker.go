@@ -1,18 +1,31 @@
 package spellcheck
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"testovoe/internal/lib/tracing"
 )
 
 const spellcheckURL = "https://speller.yandex.net/services/spellservice.json/checkText"
 
-func CheckSpelling(text string) ([]map[string]interface{}, error) {
+var client = &http.Client{
+	Transport: tracing.Transport(http.DefaultTransport),
+}
+
+func CheckSpelling(ctx context.Context, text string) ([]map[string]interface{}, error) {
 	const op = "spellchecker.CheckSpelling"
 
-	resp, err := http.PostForm(spellcheckURL, url.Values{"text": {text}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, spellcheckURL, strings.NewReader(url.Values{"text": {text}}.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -24,3 +37,26 @@ func CheckSpelling(text string) ([]map[string]interface{}, error) {
 	}
 	return result, nil
 }
+
+// Ping checks that the speller answers. It bypasses tracing, probes
+// would drown the real calls.
+func Ping(ctx context.Context) error {
+	const op = "spellchecker.Ping"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spellcheckURL+"?text=ping", nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	return nil
+}
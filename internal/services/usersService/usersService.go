@@ -0,0 +1,403 @@
+package usersService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testovoe/internal/lib/apperr"
+	"testovoe/internal/lib/logger"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+	"testovoe/internal/storage/postgres"
+	"unicode/utf8"
+)
+
+const (
+	minPasswordLength = 8
+	// the administrator's password comes from the environment of a
+	// deployment, not from someone choosing it in the admin API
+	minAdminPasswordLength = 12
+)
+
+var (
+	ErrUserNotFound      = apperr.NotFound("user_not_found", "user not found")
+	ErrInvalidRole       = apperr.Validation("invalid_role", "invalid role")
+	ErrWeakPassword      = apperr.Validation("weak_password", "password is too short")
+	ErrExternalUser      = apperr.Conflict("external_user", "user signs in through the identity provider")
+	ErrSelfAction        = apperr.Conflict("self_action", "not allowed on your own account")
+	ErrCannotImpersonate = apperr.Forbidden("cannot_impersonate", "user cannot be impersonated")
+	ErrReasonRequired    = apperr.Validation("reason_required", "reason is required")
+
+	ErrAdminPassword = errors.New("set a password of at least 12 characters through AUTH_ADMIN_PASSWORD, or its bcrypt hash through AUTH_ADMIN_PASSWORD_HASH; default passwords are refused")
+	ErrSeededAdmin   = errors.New("administrators cannot be seeded from the users list, use the admin section")
+)
+
+// defaultPasswords are refused for the administrator, next to its username.
+var defaultPasswords = []string{"admin", "administrator", "password", "password1", "changeme", "secret", "admin123"}
+
+type UsersStorage interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	UpsertExternalUser(ctx context.Context, user models.User) (models.User, error)
+	CreateLocalUser(ctx context.Context, username, passwordHash, role string) (bool, error)
+	GetUser(ctx context.Context, username string) (models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	SetUserDisabled(ctx context.Context, username string, disabled bool) error
+	SetUserPassword(ctx context.Context, username, passwordHash string) error
+	SetUserRole(ctx context.Context, username, role string) error
+	AddAuditEvent(ctx context.Context, event models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, limit int) ([]models.AuditEvent, error)
+}
+
+// SeedUser is a local user created at startup unless it already exists.
+// PasswordHash, a bcrypt hash, takes precedence over Password.
+type SeedUser struct {
+	Username     string
+	Password     string
+	PasswordHash string
+	Role         string
+}
+
+type UsersService struct {
+	log *slog.Logger
+	db  UsersStorage
+}
+
+func NewUsersService(log *slog.Logger, db *postgres.Storage) *UsersService {
+	return &UsersService{
+		log: log,
+		db:  db,
+	}
+}
+
+// SeedUsers creates the configured local users. Existing users are left
+// untouched, so passwords changed through the admin API survive restarts.
+// Their passwords sit in the config file, so none of them may be an
+// administrator.
+func (s *UsersService) SeedUsers(ctx context.Context, users []SeedUser) error {
+	const op = "usersService.SeedUsers"
+
+	for _, u := range users {
+		if u.Role == "" {
+			u.Role = oa.RoleUser
+		}
+
+		if !oa.ValidRole(u.Role) {
+			return fmt.Errorf("%s: %s: %w", op, u.Username, ErrInvalidRole)
+		}
+
+		if u.Role == oa.RoleAdmin {
+			return fmt.Errorf("%s: %s: %w", op, u.Username, ErrSeededAdmin)
+		}
+
+		if _, err := s.seedUser(ctx, u); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// SeedAdmin creates the administrator unless it exists. It refuses a
+// missing or default credential.
+func (s *UsersService) SeedAdmin(ctx context.Context, admin SeedUser) error {
+	const op = "usersService.SeedAdmin"
+
+	if err := checkAdminCredential(admin); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	admin.Role = oa.RoleAdmin
+
+	if _, err := s.seedUser(ctx, admin); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *UsersService) seedUser(ctx context.Context, u SeedUser) (bool, error) {
+	const op = "usersService.seedUser"
+
+	hash, err := seedHash(u)
+	if err != nil {
+		return false, err
+	}
+
+	created, err := s.db.CreateLocalUser(ctx, u.Username, hash, u.Role)
+	if err != nil {
+		return false, err
+	}
+
+	if created {
+		logger.For(ctx, s.log, op).InfoContext(ctx, "user created", slog.String("owner", u.Username), slog.String("role", u.Role))
+	}
+
+	return created, nil
+}
+
+func seedHash(u SeedUser) (string, error) {
+	if u.PasswordHash != "" {
+		return u.PasswordHash, nil
+	}
+
+	return oa.HashPassword(u.Password)
+}
+
+func checkAdminCredential(admin SeedUser) error {
+	if admin.Username == "" {
+		return ErrAdminPassword
+	}
+
+	if admin.PasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(admin.PasswordHash)); err != nil {
+			return fmt.Errorf("%w: %v", ErrAdminPassword, err)
+		}
+		if matchesAny(admin.PasswordHash, knownPasswords(admin.Username)) {
+			return ErrAdminPassword
+		}
+		return nil
+	}
+
+	if utf8.RuneCountInString(admin.Password) < minAdminPasswordLength {
+		return ErrAdminPassword
+	}
+
+	for _, p := range knownPasswords(admin.Username) {
+		if strings.EqualFold(admin.Password, p) {
+			return ErrAdminPassword
+		}
+	}
+
+	return nil
+}
+
+func knownPasswords(username string) []string {
+	return append(slices.Clip(defaultPasswords), username)
+}
+
+// matchesAny reports whether the bcrypt hash is of one of the passwords.
+func matchesAny(hash string, passwords []string) bool {
+	for _, p := range passwords {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(p)) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProvisionUser implements oauth.Provisioner.
+func (s *UsersService) ProvisionUser(ctx context.Context, identity oa.ExternalIdentity) (string, error) {
+	const op = "usersService.ProvisionUser"
+
+	user, err := s.db.UpsertExternalUser(ctx, models.User{
+		Username: identity.Username,
+		Issuer:   identity.Issuer,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return "", fmt.Errorf("%s: %w", op, oa.ErrIdentityConflict)
+		}
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.CreatedAt.Equal(user.LastLoginAt) {
+		logger.For(ctx, s.log, op).InfoContext(ctx, "user provisioned", slog.String("owner", user.Username), slog.String("issuer", user.Issuer))
+	}
+
+	return user.Username, nil
+}
+
+// GetUser implements oauth.UserStore.
+func (s *UsersService) GetUser(ctx context.Context, username string) (oa.User, error) {
+	const op = "usersService.GetUser"
+
+	user, err := s.db.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return oa.User{}, oa.ErrUserNotFound
+		}
+
+		return oa.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return oa.User{
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Role:         user.Role,
+		Disabled:     user.DisabledAt != nil,
+	}, nil
+}
+
+func (s *UsersService) ListUsers(ctx context.Context) ([]models.User, error) {
+	const op = "usersService.ListUsers"
+
+	users, err := s.db.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+func (s *UsersService) UserDetails(ctx context.Context, username string) (models.User, error) {
+	const op = "usersService.UserDetails"
+
+	user, err := s.db.GetUser(ctx, username)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	return user, nil
+}
+
+// SetDisabled disables or re-enables an account. Disabled users cannot
+// sign in, refresh tokens or use the API with tokens issued earlier.
+func (s *UsersService) SetDisabled(ctx context.Context, actor, username string, disabled bool) error {
+	const op = "usersService.SetDisabled"
+
+	if disabled && actor == username {
+		return fmt.Errorf("%s: %w", op, ErrSelfAction)
+	}
+
+	action := models.AuditUserEnabled
+	if disabled {
+		action = models.AuditUserDisabled
+	}
+
+	err := s.db.InTx(ctx, func(ctx context.Context) error {
+		if err := s.db.SetUserDisabled(ctx, username, disabled); err != nil {
+			return err
+		}
+
+		return s.db.AddAuditEvent(ctx, models.AuditEvent{Actor: actor, Action: action, Target: username})
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "user status changed", slog.String("owner", username), slog.String("action", action), slog.String("actor", actor))
+
+	return nil
+}
+
+func (s *UsersService) ResetPassword(ctx context.Context, actor, username, password string) error {
+	const op = "usersService.ResetPassword"
+
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("%s: %w", op, ErrWeakPassword)
+	}
+
+	user, err := s.db.GetUser(ctx, username)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	if !user.Local() {
+		return fmt.Errorf("%s: %w", op, ErrExternalUser)
+	}
+
+	hash, err := oa.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.db.InTx(ctx, func(ctx context.Context) error {
+		if err := s.db.SetUserPassword(ctx, username, hash); err != nil {
+			return err
+		}
+
+		return s.db.AddAuditEvent(ctx, models.AuditEvent{Actor: actor, Action: models.AuditPasswordReset, Target: username})
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "password reset", slog.String("owner", username), slog.String("actor", actor))
+
+	return nil
+}
+
+func (s *UsersService) SetRole(ctx context.Context, actor, username, role string) error {
+	const op = "usersService.SetRole"
+
+	if !oa.ValidRole(role) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidRole)
+	}
+
+	// an admin demoting themselves could leave nobody to undo it
+	if actor == username {
+		return fmt.Errorf("%s: %w", op, ErrSelfAction)
+	}
+
+	err := s.db.InTx(ctx, func(ctx context.Context) error {
+		if err := s.db.SetUserRole(ctx, username, role); err != nil {
+			return err
+		}
+
+		return s.db.AddAuditEvent(ctx, models.AuditEvent{Actor: actor, Action: models.AuditRoleChanged, Target: username, Details: role})
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	logger.For(ctx, s.log, op).InfoContext(ctx, "role changed", slog.String("owner", username), slog.String("role", role), slog.String("actor", actor))
+
+	return nil
+}
+
+// Impersonate checks that the admin may act as the user, records why, and
+// returns the scope of the impersonation token. Admins cannot be
+// impersonated, so the token never carries the admin scope.
+func (s *UsersService) Impersonate(ctx context.Context, actor, username, reason string) (string, error) {
+	const op = "usersService.Impersonate"
+
+	if reason == "" {
+		return "", fmt.Errorf("%s: %w", op, ErrReasonRequired)
+	}
+
+	user, err := s.db.GetUser(ctx, username)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, mapStorageError(err))
+	}
+
+	if user.Role == oa.RoleAdmin || user.DisabledAt != nil || actor == username {
+		return "", fmt.Errorf("%s: %w", op, ErrCannotImpersonate)
+	}
+
+	err = s.db.AddAuditEvent(ctx, models.AuditEvent{Actor: actor, Action: models.AuditImpersonated, Target: username, Details: reason})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.For(ctx, s.log, op).WarnContext(ctx, "impersonation started", slog.String("owner", username), slog.String("actor", actor), slog.String("reason", reason))
+
+	return strings.Join(oa.RoleScopes(user.Role), " "), nil
+}
+
+func (s *UsersService) ListAudit(ctx context.Context, limit int) ([]models.AuditEvent, error) {
+	const op = "usersService.ListAudit"
+
+	events, err := s.db.ListAuditEvents(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+func mapStorageError(err error) error {
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return ErrUserNotFound
+	}
+
+	return err
+}
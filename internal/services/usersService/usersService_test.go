@@ -0,0 +1,149 @@
+package usersService
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	oa "testovoe/internal/lib/oauth"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+// memoryUsers - хранилище пользователей в памяти, только то, что нужно сидированию
+type memoryUsers struct {
+	UsersStorage
+	users map[string]models.User
+}
+
+func (m *memoryUsers) CreateLocalUser(ctx context.Context, username, passwordHash, role string) (bool, error) {
+	if _, ok := m.users[username]; ok {
+		return false, nil
+	}
+	m.users[username] = models.User{Username: username, PasswordHash: passwordHash, Role: role}
+
+	return true, nil
+}
+
+func (m *memoryUsers) GetUser(ctx context.Context, username string) (models.User, error) {
+	user, ok := m.users[username]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func mustHash(t *testing.T, password string) string {
+	t.Helper()
+
+	hash, err := oa.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+func TestUsersService_SeedAdmin(t *testing.T) {
+	const strong = "correct horse battery staple"
+
+	tests := []struct {
+		name         string
+		existing     map[string]models.User
+		admin        SeedUser
+		wantErr      error
+		wantPassword string
+	}{
+		{
+			name:    "No password",
+			admin:   SeedUser{Username: "admin"},
+			wantErr: ErrAdminPassword,
+		},
+		{
+			name:    "Default password",
+			admin:   SeedUser{Username: "admin", Password: "admin"},
+			wantErr: ErrAdminPassword,
+		},
+		{
+			name:    "Password is the username",
+			admin:   SeedUser{Username: "administrator1", Password: "Administrator1"},
+			wantErr: ErrAdminPassword,
+		},
+		{
+			name:    "Short password",
+			admin:   SeedUser{Username: "admin", Password: "s3cret!"},
+			wantErr: ErrAdminPassword,
+		},
+		{
+			name:    "Hash of a default password",
+			admin:   SeedUser{Username: "admin", PasswordHash: mustHash(t, "changeme")},
+			wantErr: ErrAdminPassword,
+		},
+		{
+			name:    "Not a bcrypt hash",
+			admin:   SeedUser{Username: "admin", PasswordHash: "5f4dcc3b5aa765d61d8327deb882cf99"},
+			wantErr: ErrAdminPassword,
+		},
+		{
+			name:         "Created",
+			admin:        SeedUser{Username: "admin", Password: strong},
+			wantPassword: strong,
+		},
+		{
+			name:         "Created from hash",
+			admin:        SeedUser{Username: "admin", PasswordHash: mustHash(t, strong)},
+			wantPassword: strong,
+		},
+		{
+			name: "Existing admin is kept",
+			existing: map[string]models.User{
+				"admin": {Username: "admin", PasswordHash: mustHash(t, "changed through the API"), Role: oa.RoleAdmin},
+			},
+			admin:        SeedUser{Username: "admin", Password: strong},
+			wantPassword: "changed through the API",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &memoryUsers{users: map[string]models.User{}}
+			for k, v := range tt.existing {
+				db.users[k] = v
+			}
+			s := &UsersService{log: slog.New(slog.NewTextHandler(io.Discard, nil)), db: db}
+
+			err := s.SeedAdmin(context.Background(), tt.admin)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SeedAdmin() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(db.users) != len(tt.existing) {
+					t.Errorf("users = %v, want none created", db.users)
+				}
+				return
+			}
+
+			user := db.users[tt.admin.Username]
+			if user.Role != oa.RoleAdmin {
+				t.Errorf("role = %q, want %q", user.Role, oa.RoleAdmin)
+			}
+			if !matchesAny(user.PasswordHash, []string{tt.wantPassword}) {
+				t.Errorf("password is not %q", tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestUsersService_SeedUsersRejectsAdmins(t *testing.T) {
+	db := &memoryUsers{users: map[string]models.User{}}
+	s := &UsersService{log: slog.New(slog.NewTextHandler(io.Discard, nil)), db: db}
+
+	err := s.SeedUsers(context.Background(), []SeedUser{{Username: "admin", Password: "admin", Role: oa.RoleAdmin}})
+	if !errors.Is(err, ErrSeededAdmin) {
+		t.Fatalf("SeedUsers() error = %v, want %v", err, ErrSeededAdmin)
+	}
+	if len(db.users) != 0 {
+		t.Errorf("users = %v, want none", db.users)
+	}
+}
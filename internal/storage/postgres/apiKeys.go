@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+const apiKeyColumns = `id, owner, name, prefix, key_hash, scopes, created_at, expires_at, last_used_at`
+
+func scanAPIKey(row pgx.Row) (models.APIKey, error) {
+	var k models.APIKey
+	err := row.Scan(&k.ID, &k.Owner, &k.Name, &k.Prefix, &k.KeyHash, &k.Scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt)
+
+	return k, err
+}
+
+func (s *Storage) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	const op = "storage.postgres.CreateAPIKey"
+
+	created, err := scanAPIKey(s.conn(ctx).QueryRow(ctx,
+		`INSERT INTO api_keys (id, owner, name, prefix, key_hash, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING `+apiKeyColumns,
+		key.ID, key.Owner, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt))
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return created, nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, owner string) ([]models.APIKey, error) {
+	const op = "storage.postgres.ListAPIKeys"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+apiKeyColumns+`
+			FROM api_keys
+			WHERE owner = $1
+			ORDER BY created_at`,
+		owner)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) DeleteAPIKey(ctx context.Context, keyId, owner string) error {
+	const op = "storage.postgres.DeleteAPIKey"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`DELETE FROM api_keys WHERE id = $1 AND owner = $2`,
+		keyId, owner)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
+
+// UseAPIKey looks up an unexpired key by hash and records that it was
+// used. last_used_at is only written once a minute so that a busy script
+// does not turn every read into a write.
+func (s *Storage) UseAPIKey(ctx context.Context, keyHash string) (models.APIKey, error) {
+	const op = "storage.postgres.UseAPIKey"
+
+	key, err := scanAPIKey(s.conn(ctx).QueryRow(ctx,
+		`WITH touched AS (
+			UPDATE api_keys
+				SET last_used_at = now()
+				WHERE key_hash = $1 AND expires_at > now()
+					AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+		)
+		SELECT `+apiKeyColumns+`
+			FROM api_keys
+			WHERE key_hash = $1 AND expires_at > now()`,
+		keyHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.APIKey{}, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotFound)
+		}
+
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"testovoe/internal/models"
+	"time"
+)
+
+// RecordLoginFailure counts a failed login for the subject and returns the
+// number of failures in a row. Failures older than window are forgotten,
+// and so are the rows of other subjects holding only such failures and no
+// lock, so guessed usernames do not pile up.
+func (s *Storage) RecordLoginFailure(ctx context.Context, subject string, window time.Duration) (int, error) {
+	const op = "storage.postgres.RecordLoginFailure"
+
+	_, err := s.conn(ctx).Exec(ctx,
+		`DELETE FROM login_failures
+			WHERE last_failed_at < now() - $1::interval
+				AND (locked_until IS NULL OR locked_until <= now())`,
+		window)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var failures int
+
+	err = s.conn(ctx).QueryRow(ctx,
+		`INSERT INTO login_failures (subject, failures, last_failed_at)
+			VALUES ($1, 1, now())
+			ON CONFLICT (subject) DO UPDATE
+				SET failures = CASE
+						WHEN login_failures.last_failed_at < now() - $2::interval THEN 1
+						ELSE login_failures.failures + 1
+					END,
+					last_failed_at = now()
+			RETURNING failures`,
+		subject, window).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failures, nil
+}
+
+func (s *Storage) LockLogin(ctx context.Context, subject string, until time.Time) error {
+	const op = "storage.postgres.LockLogin"
+
+	_, err := s.conn(ctx).Exec(ctx,
+		`UPDATE login_failures SET locked_until = $2 WHERE subject = $1`,
+		subject, until)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetLoginLock returns the latest time until which any of the subjects is
+// locked, or the zero time when none of them is.
+func (s *Storage) GetLoginLock(ctx context.Context, subjects []string) (time.Time, error) {
+	const op = "storage.postgres.GetLoginLock"
+
+	var until *time.Time
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`SELECT max(locked_until)
+			FROM login_failures
+			WHERE subject = ANY($1) AND locked_until > now()`,
+		subjects).Scan(&until)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if until == nil {
+		return time.Time{}, nil
+	}
+
+	return *until, nil
+}
+
+// ClearLoginFailures resets the counter and the lock. It reports whether
+// the subject was locked at that moment.
+func (s *Storage) ClearLoginFailures(ctx context.Context, subject string) (bool, error) {
+	const op = "storage.postgres.ClearLoginFailures"
+
+	var wasLocked bool
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`WITH deleted AS (
+			DELETE FROM login_failures WHERE subject = $1
+				RETURNING locked_until
+		)
+		SELECT EXISTS (SELECT 1 FROM deleted WHERE locked_until > now())`,
+		subject).Scan(&wasLocked)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wasLocked, nil
+}
+
+func (s *Storage) AddLockoutEvent(ctx context.Context, event models.LockoutEvent) error {
+	const op = "storage.postgres.AddLockoutEvent"
+
+	_, err := s.conn(ctx).Exec(ctx,
+		`INSERT INTO lockout_events (subject, event, failures, locked_until, actor)
+			VALUES ($1, $2, $3, $4, $5)`,
+		event.Subject, event.Event, event.Failures, event.LockedUntil, event.Actor)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ListLockoutEvents returns the latest events first.
+func (s *Storage) ListLockoutEvents(ctx context.Context, limit int) ([]models.LockoutEvent, error) {
+	const op = "storage.postgres.ListLockoutEvents"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT id, subject, event, failures, locked_until, actor, created_at
+			FROM lockout_events
+			ORDER BY id DESC
+			LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	events := make([]models.LockoutEvent, 0)
+	for rows.Next() {
+		var e models.LockoutEvent
+		err := rows.Scan(&e.ID, &e.Subject, &e.Event, &e.Failures, &e.LockedUntil, &e.Actor, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+func (s *Storage) GetMFA(ctx context.Context, username string) (models.MFA, error) {
+	const op = "storage.postgres.GetMFA"
+
+	mfa := models.MFA{Username: username}
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`SELECT secret, confirmed_at, last_step
+			FROM user_mfa
+			WHERE username = $1`,
+		username).Scan(&mfa.Secret, &mfa.ConfirmedAt, &mfa.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.MFA{}, fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+		}
+
+		return models.MFA{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mfa, nil
+}
+
+// SaveMFASecret starts or restarts a pending enrollment. A confirmed
+// enrollment is never overwritten.
+func (s *Storage) SaveMFASecret(ctx context.Context, username, secret string) error {
+	const op = "storage.postgres.SaveMFASecret"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`INSERT INTO user_mfa (username, secret)
+			VALUES ($1, $2)
+			ON CONFLICT (username) DO UPDATE
+				SET secret = EXCLUDED.secret, last_step = 0, created_at = now()
+				WHERE user_mfa.confirmed_at IS NULL`,
+		username, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAEnabled)
+	}
+
+	return nil
+}
+
+// EnableMFA confirms a pending enrollment and stores the recovery code hashes.
+func (s *Storage) EnableMFA(ctx context.Context, username string, step int64, recoveryHashes []string) error {
+	const op = "storage.postgres.EnableMFA"
+
+	return s.InTx(ctx, func(ctx context.Context) error {
+		tag, err := s.conn(ctx).Exec(ctx,
+			`UPDATE user_mfa
+				SET confirmed_at = now(), last_step = $2
+				WHERE username = $1 AND confirmed_at IS NULL`,
+			username, step)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+		}
+
+		_, err = s.conn(ctx).Exec(ctx,
+			`INSERT INTO mfa_recovery_codes (username, code_hash)
+				SELECT $1, unnest($2::text[])`,
+			username, recoveryHashes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// DisableMFA removes the enrollment together with its recovery codes.
+func (s *Storage) DisableMFA(ctx context.Context, username string) error {
+	const op = "storage.postgres.DisableMFA"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`DELETE FROM user_mfa WHERE username = $1`,
+		username)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code. It fails when
+// that step or a later one was already used.
+func (s *Storage) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	const op = "storage.postgres.UseTOTPStep"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE user_mfa
+			SET last_step = $2
+			WHERE username = $1 AND confirmed_at IS NOT NULL AND last_step < $2`,
+		username, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFACodeUsed)
+	}
+
+	return nil
+}
+
+func (s *Storage) UseRecoveryCode(ctx context.Context, username, codeHash string) error {
+	const op = "storage.postgres.UseRecoveryCode"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE mfa_recovery_codes
+			SET used_at = now()
+			WHERE username = $1 AND code_hash = $2 AND used_at IS NULL`,
+		username, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFACodeUsed)
+	}
+
+	return nil
+}
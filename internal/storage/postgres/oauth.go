@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+func (s *Storage) SaveAuthCode(ctx context.Context, code models.AuthCode) error {
+	const op = "storage.postgres.SaveAuthCode"
+
+	// codes live for minutes, so sweeping on write keeps the table small
+	_, err := s.conn(ctx).Exec(ctx,
+		`DELETE FROM oauth_codes WHERE expires_at < now()`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.conn(ctx).Exec(ctx,
+		`INSERT INTO oauth_codes (code_hash, client_id, redirect_uri, username, scope, code_challenge, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		code.CodeHash, code.ClientID, code.RedirectURI, code.Username, code.Scope, code.CodeChallenge, code.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthCode marks the code as used and returns it, in one statement so
+// that a code can never be redeemed twice. Expired codes are not returned.
+func (s *Storage) ConsumeAuthCode(ctx context.Context, codeHash string) (models.AuthCode, error) {
+	const op = "storage.postgres.ConsumeAuthCode"
+
+	code := models.AuthCode{CodeHash: codeHash}
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`UPDATE oauth_codes
+			SET used_at = now()
+			WHERE code_hash = $1 AND used_at IS NULL AND expires_at > now()
+			RETURNING client_id, redirect_uri, username, scope, code_challenge, expires_at`,
+		codeHash).Scan(&code.ClientID, &code.RedirectURI, &code.Username, &code.Scope, &code.CodeChallenge, &code.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.AuthCode{}, fmt.Errorf("%s: %w", op, storage.ErrCodeNotFound)
+		}
+
+		return models.AuthCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+const clientColumns = `client_id, name, secret_hash, grant_types, scopes, redirect_uris, created_at, disabled_at`
+
+func scanClient(row pgx.Row) (models.Client, error) {
+	var c models.Client
+	err := row.Scan(&c.ID, &c.Name, &c.SecretHash, &c.GrantTypes, &c.Scopes, &c.RedirectURIs, &c.CreatedAt, &c.DisabledAt)
+
+	return c, err
+}
+
+func (s *Storage) CreateClient(ctx context.Context, client models.Client) (models.Client, error) {
+	const op = "storage.postgres.CreateClient"
+
+	created, err := scanClient(s.conn(ctx).QueryRow(ctx,
+		`INSERT INTO oauth_clients (client_id, name, secret_hash, grant_types, scopes, redirect_uris)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING `+clientColumns,
+		client.ID, client.Name, client.SecretHash, client.GrantTypes, client.Scopes, client.RedirectURIs))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return models.Client{}, fmt.Errorf("%s: %w", op, storage.ErrClientExists)
+		}
+
+		return models.Client{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return created, nil
+}
+
+// GetClient returns the client, including a disabled one.
+func (s *Storage) GetClient(ctx context.Context, clientID string) (models.Client, error) {
+	const op = "storage.postgres.GetClient"
+
+	client, err := scanClient(s.conn(ctx).QueryRow(ctx,
+		`SELECT `+clientColumns+`
+			FROM oauth_clients
+			WHERE client_id = $1`,
+		clientID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Client{}, fmt.Errorf("%s: %w", op, storage.ErrClientNotFound)
+		}
+
+		return models.Client{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return client, nil
+}
+
+func (s *Storage) ListClients(ctx context.Context) ([]models.Client, error) {
+	const op = "storage.postgres.ListClients"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+clientColumns+`
+			FROM oauth_clients
+			ORDER BY created_at, client_id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	clients := make([]models.Client, 0)
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		clients = append(clients, client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clients, nil
+}
+
+// UpdateClientSecret replaces the secret hash of an active client.
+func (s *Storage) UpdateClientSecret(ctx context.Context, clientID, secretHash string) error {
+	const op = "storage.postgres.UpdateClientSecret"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE oauth_clients
+			SET secret_hash = $2
+			WHERE client_id = $1 AND disabled_at IS NULL`,
+		clientID, secretHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrClientNotFound)
+	}
+
+	return nil
+}
+
+// DisableClient marks the client disabled. Disabling twice is a no-op.
+func (s *Storage) DisableClient(ctx context.Context, clientID string) error {
+	const op = "storage.postgres.DisableClient"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE oauth_clients
+			SET disabled_at = COALESCE(disabled_at, now())
+			WHERE client_id = $1`,
+		clientID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrClientNotFound)
+	}
+
+	return nil
+}
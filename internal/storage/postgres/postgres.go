@@ -2,19 +2,43 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"testovoe/internal/lib/logger"
+	"testovoe/internal/lib/tracing"
 	"testovoe/internal/models"
+	"testovoe/internal/storage"
 )
 
 type Storage struct {
 	db *pgxpool.Pool
 }
 
+// querier is the part of the pgx API shared by the pool and a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txKey struct{}
+
+const uniqueViolation = "23505"
+
 func New(conn string) (*Storage, error) {
 	const op = "storage.postgres.New"
 
-	db, err := pgxpool.New(context.Background(), conn)
+	cfg, err := pgxpool.ParseConfig(conn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	cfg.ConnConfig.Tracer = tracing.PgxTracer{}
+
+	db, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -24,22 +48,90 @@ func New(conn string) (*Storage, error) {
 	}, nil
 }
 
-func (s *Storage) AddNote(noteId, content, owner string) (string, error) {
-	_, err := s.db.Exec(context.Background(),
-		`INSERT INTO notes (id, content, owner) 
-			VALUES ($1, $2, $3)`,
-		noteId, content, owner)
+// InTx runs fn in a transaction carried by the context it is given, so the
+// storage methods called with that context take part in it. The transaction
+// is rolled back when fn returns an error. Nested calls join the outer one.
+func (s *Storage) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	const op = "storage.postgres.InTx"
+
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		// the request may already be canceled, the rollback still has to run
+		if rbErr := tx.Rollback(context.WithoutCancel(ctx)); rbErr != nil {
+			logger.FromContext(ctx, slog.Default()).ErrorContext(ctx, "failed to roll back transaction",
+				slog.String("op", op),
+				slog.String("error", rbErr.Error()),
+			)
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
 
-	return noteId, err
+	return s.db
 }
 
-func (s *Storage) GetNotes(owner string) ([]models.Note, error) {
+// nextSeq bumps the owner's change sequence. The row lock it takes is held
+// until the surrounding statement commits, so sequence numbers of one owner
+// become visible in order.
+const nextSeq = `WITH seq AS (
+		INSERT INTO note_change_seq (owner, seq)
+			VALUES ($2, 1)
+			ON CONFLICT (owner) DO UPDATE SET seq = note_change_seq.seq + 1
+			RETURNING seq
+	)`
+
+func (s *Storage) AddNote(ctx context.Context, noteId, content, owner string) (string, error) {
+	const op = "storage.postgres.AddNote"
+
+	_, err := s.conn(ctx).Exec(ctx,
+		nextSeq+`
+		INSERT INTO notes (id, owner, content, change_seq)
+			SELECT $1::uuid, $2, $3, seq FROM seq`,
+		noteId, owner, content)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return "", fmt.Errorf("%s: %w", op, storage.ErrNoteExists)
+		}
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return noteId, nil
+}
+
+const noteColumns = `id, content, owner, tags, notebook, created_at, updated_at`
+
+func scanNote(row pgx.Row, note *models.Note) error {
+	return row.Scan(&note.ID, &note.Content, &note.Owner, &note.Tags, &note.Notebook, &note.CreatedAt, &note.UpdatedAt)
+}
+
+func (s *Storage) GetNotes(ctx context.Context, owner string) ([]models.Note, error) {
 	notes := make([]models.Note, 0)
 
-	rows, err := s.db.Query(context.Background(),
-		`SELECT id, content, owner
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+noteColumns+`
 			FROM notes
-			WHERE owner = $1`,
+			WHERE owner = $1 AND deleted_at IS NULL`,
 		owner)
 	if err != nil {
 		return nil, err
@@ -47,7 +139,7 @@ func (s *Storage) GetNotes(owner string) ([]models.Note, error) {
 
 	for rows.Next() {
 		note := models.Note{}
-		err = rows.Scan(&note.ID, &note.Content, &note.Owner)
+		err = scanNote(rows, &note)
 		if err != nil {
 			return nil, err
 		}
@@ -57,8 +149,384 @@ func (s *Storage) GetNotes(owner string) ([]models.Note, error) {
 	return notes, nil
 }
 
+// IterateNotes streams the owner's notes to fn row by row instead of
+// loading them all into memory.
+func (s *Storage) IterateNotes(ctx context.Context, owner string, fn func(note models.Note) error) error {
+	const op = "storage.postgres.IterateNotes"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+noteColumns+`
+			FROM notes
+			WHERE owner = $1 AND deleted_at IS NULL
+			ORDER BY id`,
+		owner)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note := models.Note{}
+		if err := scanNote(rows, &note); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := fn(note); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetNotesByIDs returns the live notes of the owner among ids, in no
+// particular order; unknown IDs are left out.
+func (s *Storage) GetNotesByIDs(ctx context.Context, owner string, ids []string) ([]models.Note, error) {
+	const op = "storage.postgres.GetNotesByIDs"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+noteColumns+`
+			FROM notes
+			WHERE owner = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL`,
+		owner, ids)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	notes := make([]models.Note, 0, len(ids))
+
+	for rows.Next() {
+		note := models.Note{}
+		if err := scanNote(rows, &note); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return notes, nil
+}
+
+// SearchNotes returns up to limit live notes of the owner matching a
+// web-search style query, best match first.
+func (s *Storage) SearchNotes(ctx context.Context, owner, query string, limit int) ([]models.Note, error) {
+	const op = "storage.postgres.SearchNotes"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+noteColumns+`
+			FROM notes, websearch_to_tsquery('simple', $2) AS query
+			WHERE owner = $1 AND deleted_at IS NULL
+				AND to_tsvector('simple', content) @@ query
+			ORDER BY ts_rank(to_tsvector('simple', content), query) DESC, id
+			LIMIT $3`,
+		owner, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	notes := make([]models.Note, 0)
+
+	for rows.Next() {
+		note := models.Note{}
+		if err := scanNote(rows, &note); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return notes, nil
+}
+
+// ListTags counts the owner's live notes per tag, most used first.
+func (s *Storage) ListTags(ctx context.Context, owner string, limit int) ([]models.Tag, error) {
+	const op = "storage.postgres.ListTags"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT tag, count(*)
+			FROM notes, unnest(tags) AS tag
+			WHERE owner = $1 AND deleted_at IS NULL
+			GROUP BY tag
+			ORDER BY count(*) DESC, tag
+			LIMIT $2`,
+		owner, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	tags := make([]models.Tag, 0)
+
+	for rows.Next() {
+		tag := models.Tag{}
+		if err := rows.Scan(&tag.Name, &tag.Notes); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tags, nil
+}
+
+// ListNotebooks counts the owner's live notes per notebook, by path. Notes
+// outside a notebook are not counted.
+func (s *Storage) ListNotebooks(ctx context.Context, owner string, limit int) ([]models.Notebook, error) {
+	const op = "storage.postgres.ListNotebooks"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT notebook, count(*)
+			FROM notes
+			WHERE owner = $1 AND deleted_at IS NULL AND notebook <> ''
+			GROUP BY notebook
+			ORDER BY notebook
+			LIMIT $2`,
+		owner, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	notebooks := make([]models.Notebook, 0)
+
+	for rows.Next() {
+		notebook := models.Notebook{}
+		if err := rows.Scan(&notebook.Path, &notebook.Notes); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		notebooks = append(notebooks, notebook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return notebooks, nil
+}
+
+func (s *Storage) GetNote(ctx context.Context, noteId, owner string) (models.Note, error) {
+	const op = "storage.postgres.GetNote"
+
+	var note models.Note
+
+	err := scanNote(s.conn(ctx).QueryRow(ctx,
+		`SELECT `+noteColumns+`
+			FROM notes
+			WHERE id = $1 AND owner = $2 AND deleted_at IS NULL`,
+		noteId, owner), &note)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Note{}, fmt.Errorf("%s: %w", op, storage.ErrNoteNotFound)
+		}
+
+		return models.Note{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return note, nil
+}
+
+// UpdateNote replaces the content of a live note and returns its new
+// version. A non-zero baseVersion makes the update conditional on the note
+// still being at that version.
+func (s *Storage) UpdateNote(ctx context.Context, noteId, content, owner string, baseVersion int64) (int64, error) {
+	const op = "storage.postgres.UpdateNote"
+
+	var version int64
+
+	err := s.conn(ctx).QueryRow(ctx,
+		nextSeq+`
+		UPDATE notes
+			SET content = $3,
+				version = version + 1,
+				change_seq = (SELECT seq FROM seq),
+				updated_at = now()
+			WHERE id = $1 AND owner = $2 AND deleted_at IS NULL
+				AND ($4::bigint = 0 OR version = $4)
+			RETURNING version`,
+		noteId, owner, content, baseVersion).Scan(&version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, s.missedWriteReason(ctx, noteId, owner))
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// DeleteNote turns a live note into a tombstone, which is kept so that
+// sync clients learn about the deletion, and returns the tombstone version.
+func (s *Storage) DeleteNote(ctx context.Context, noteId, owner string, baseVersion int64) (int64, error) {
+	const op = "storage.postgres.DeleteNote"
+
+	var version int64
+
+	err := s.conn(ctx).QueryRow(ctx,
+		nextSeq+`
+		UPDATE notes
+			SET content = '',
+				version = version + 1,
+				change_seq = (SELECT seq FROM seq),
+				updated_at = now(),
+				deleted_at = now()
+			WHERE id = $1 AND owner = $2 AND deleted_at IS NULL
+				AND ($3::bigint = 0 OR version = $3)
+			RETURNING version`,
+		noteId, owner, baseVersion).Scan(&version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, s.missedWriteReason(ctx, noteId, owner))
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// missedWriteReason tells apart a conditional write that lost a race from
+// one that targeted a missing or deleted note.
+func (s *Storage) missedWriteReason(ctx context.Context, noteId, owner string) error {
+	var exists bool
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM notes
+				WHERE id = $1 AND owner = $2 AND deleted_at IS NULL
+		)`,
+		noteId, owner).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return storage.ErrVersionConflict
+	}
+
+	return storage.ErrNoteNotFound
+}
+
+// GetNoteState returns the sync state of a note, including tombstones.
+func (s *Storage) GetNoteState(ctx context.Context, noteId, owner string) (models.NoteChange, error) {
+	const op = "storage.postgres.GetNoteState"
+
+	var change models.NoteChange
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`SELECT id, content, version, deleted_at IS NOT NULL, updated_at, change_seq
+			FROM notes
+			WHERE id = $1 AND owner = $2`,
+		noteId, owner).Scan(&change.ID, &change.Content, &change.Version, &change.Deleted, &change.UpdatedAt, &change.Seq)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NoteChange{}, fmt.Errorf("%s: %w", op, storage.ErrNoteNotFound)
+		}
+
+		return models.NoteChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return change, nil
+}
+
+// GetChangeSeq returns the latest point of the owner's change sequence,
+// 0 before the first change.
+func (s *Storage) GetChangeSeq(ctx context.Context, owner string) (int64, error) {
+	const op = "storage.postgres.GetChangeSeq"
+
+	var seq int64
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`SELECT seq FROM note_change_seq WHERE owner = $1`,
+		owner).Scan(&seq)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return seq, nil
+}
+
+// GetChanges returns up to limit notes of the owner, tombstones included,
+// changed after the given point of the change sequence, oldest first.
+func (s *Storage) GetChanges(ctx context.Context, owner string, since int64, limit int) ([]models.NoteChange, error) {
+	const op = "storage.postgres.GetChanges"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT id, content, version, deleted_at IS NOT NULL, updated_at, change_seq
+			FROM notes
+			WHERE owner = $1 AND change_seq > $2
+			ORDER BY change_seq
+			LIMIT $3`,
+		owner, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	changes := make([]models.NoteChange, 0)
+
+	for rows.Next() {
+		var change models.NoteChange
+		err := rows.Scan(&change.ID, &change.Content, &change.Version, &change.Deleted, &change.UpdatedAt, &change.Seq)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return changes, nil
+}
+
 func (s *Storage) Close() {
 	s.db.Close()
 
 	return
 }
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := s.db.Ping(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// MigrationVersion returns the latest schema version applied by goose.
+func (s *Storage) MigrationVersion(ctx context.Context) (int64, error) {
+	const op = "storage.postgres.MigrationVersion"
+
+	var version int64
+
+	err := s.db.QueryRow(ctx,
+		`SELECT COALESCE(max(version_id), 0) FROM goose_db_version WHERE is_applied`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+func (s *Storage) PoolStat() *pgxpool.Stat {
+	return s.db.Stat()
+}
@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testovoe/internal/storage"
+	"time"
+)
+
+// newTestSchema создаёт пустую схему в базе из TEST_DATABASE_URL и
+// возвращает строку подключения к ней; без переменной тест пропускается
+func newTestSchema(t *testing.T) (string, *pgx.Conn) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+		admin.Close(context.Background())
+	})
+
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("CREATE SCHEMA error = %v", err)
+	}
+	if _, err := admin.Exec(ctx, "SET search_path TO "+schema); err != nil {
+		t.Fatalf("SET search_path error = %v", err)
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	return dsn + sep + "search_path=" + schema, admin
+}
+
+// migrateUp применяет Up-часть миграции
+func migrateUp(t *testing.T, conn *pgx.Conn, name string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "..", "..", "migrations", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, _, _ := strings.Cut(string(data), "-- +goose Down")
+	if _, err := conn.Exec(context.Background(), up); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func TestStorage_GetChangesIncludesNotesFromBeforeSync(t *testing.T) {
+	dsn, admin := newTestSchema(t)
+	ctx := context.Background()
+
+	migrateUp(t, admin, "20240827114759_notes_table.sql")
+	migrateUp(t, admin, "20240905120000_notes_export.sql")
+
+	_, err := admin.Exec(ctx,
+		`INSERT INTO notes (id, owner, content) VALUES
+			('123e4567-e89b-12d3-a456-426614174000', 'alice', 'old'),
+			('123e4567-e89b-12d3-a456-426614174001', 'alice', 'older')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrateUp(t, admin, "20240910120000_notes_sync.sql")
+
+	s, err := New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	changes, err := s.GetChanges(ctx, "alice", 0, 10)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("GetChanges() = %d changes, want 2", len(changes))
+	}
+
+	seq, err := s.GetChangeSeq(ctx, "alice")
+	if err != nil || seq != 2 {
+		t.Fatalf("GetChangeSeq() = %d, %v, want 2", seq, err)
+	}
+
+	// новые заметки продолжают последовательность
+	if _, err := s.AddNote(ctx, "123e4567-e89b-12d3-a456-426614174002", "new", "alice"); err != nil {
+		t.Fatalf("AddNote() error = %v", err)
+	}
+
+	changes, err = s.GetChanges(ctx, "alice", seq, 10)
+	if err != nil || len(changes) != 1 || changes[0].Seq != 3 {
+		t.Fatalf("GetChanges() = %+v, %v, want the new note at seq 3", changes, err)
+	}
+}
+
+func TestStorage_ShareNote(t *testing.T) {
+	dsn, admin := newTestSchema(t)
+	ctx := context.Background()
+
+	for _, name := range []string{
+		"20240827114759_notes_table.sql",
+		"20240905120000_notes_export.sql",
+		"20240910120000_notes_sync.sql",
+		"20241010120000_external_users.sql",
+		"20241015120000_user_roles.sql",
+		"20241110120000_note_shares.sql",
+	} {
+		migrateUp(t, admin, name)
+	}
+
+	s, err := New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const noteId = "123e4567-e89b-12d3-a456-426614174000"
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if _, err := s.CreateLocalUser(ctx, username, "", "user"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.AddNote(ctx, noteId, "shared", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		owner       string
+		username    string
+		expectedErr error
+	}{
+		{name: "Share", owner: "alice", username: "bob"},
+		{name: "Share again", owner: "alice", username: "bob"},
+		{name: "Limit reached", owner: "alice", username: "carol", expectedErr: storage.ErrShareLimit},
+		{name: "Unknown user", owner: "alice", username: "mallory", expectedErr: storage.ErrUserNotFound},
+		{name: "Note of another user", owner: "bob", username: "carol", expectedErr: storage.ErrNoteNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// одной заметкой можно поделиться не больше чем с одним пользователем
+			err := s.ShareNote(ctx, noteId, tt.owner, tt.username, 1)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("ShareNote() error = %v, want %v", err, tt.expectedErr)
+			}
+		})
+	}
+
+	shares, err := s.GetNoteShares(ctx, "alice", []string{noteId})
+	if err != nil || len(shares) != 1 || shares[0].Username != "bob" {
+		t.Fatalf("GetNoteShares() = %+v, %v, want the share with bob", shares, err)
+	}
+
+	notes, err := s.GetSharedNotes(ctx, "bob", 10)
+	if err != nil || len(notes) != 1 || notes[0].ID != noteId {
+		t.Fatalf("GetSharedNotes() = %+v, %v, want the shared note", notes, err)
+	}
+
+	if err := s.UnshareNote(ctx, noteId, "alice", "bob"); err != nil {
+		t.Fatalf("UnshareNote() error = %v", err)
+	}
+
+	notes, err = s.GetSharedNotes(ctx, "bob", 10)
+	if err != nil || len(notes) != 0 {
+		t.Fatalf("GetSharedNotes() = %+v, %v, want none after unsharing", notes, err)
+	}
+}
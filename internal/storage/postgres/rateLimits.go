@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TakeRateLimitToken refills the token bucket by the time passed since the
+// last request and takes a token from it when one is left. The row stays
+// locked until the transaction ends, so concurrent requests of all
+// instances queue up on it.
+func (s *Storage) TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (float64, bool, error) {
+	const op = "storage.postgres.TakeRateLimitToken"
+
+	var tokens float64
+	var allowed bool
+
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		err := s.conn(ctx).QueryRow(ctx,
+			`INSERT INTO rate_limits AS rl (key, tokens)
+				VALUES ($1, $3::float8)
+				ON CONFLICT (key) DO UPDATE
+					SET tokens = LEAST($3::float8, rl.tokens + EXTRACT(EPOCH FROM now() - rl.updated_at)::float8 * $2::float8),
+						updated_at = now()
+				RETURNING tokens`,
+			key, rate, burst).Scan(&tokens)
+		if err != nil {
+			return err
+		}
+
+		if tokens < 1 {
+			return nil
+		}
+
+		_, err = s.conn(ctx).Exec(ctx,
+			`UPDATE rate_limits SET tokens = tokens - 1 WHERE key = $1`,
+			key)
+		if err != nil {
+			return err
+		}
+
+		tokens--
+		allowed = true
+
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, allowed, nil
+}
+
+func (s *Storage) PruneRateLimits(ctx context.Context, idle time.Duration) error {
+	const op = "storage.postgres.PruneRateLimits"
+
+	_, err := s.conn(ctx).Exec(ctx,
+		`DELETE FROM rate_limits WHERE updated_at < now() - $1::interval`,
+		idle)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+// ShareNote lets username read a live note of the owner. Sharing it again
+// with the same user changes nothing; a note already shared with limit users
+// is not shared with another one.
+func (s *Storage) ShareNote(ctx context.Context, noteId, owner, username string, limit int) error {
+	const op = "storage.postgres.ShareNote"
+
+	var noteFound, userFound, shared bool
+	var count int
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`WITH note AS (
+			SELECT id FROM notes WHERE id = $1 AND owner = $2 AND deleted_at IS NULL
+		), target AS (
+			SELECT username FROM users WHERE username = $3
+		), shares AS (
+			SELECT count(*) AS n, COALESCE(bool_or(shared_with = $3), false) AS shared
+				FROM note_shares
+				WHERE note_id = $1
+		), added AS (
+			INSERT INTO note_shares (note_id, shared_with)
+				SELECT note.id, target.username
+					FROM note, target, shares
+					WHERE NOT shares.shared AND shares.n < $4
+				ON CONFLICT DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM note), EXISTS (SELECT 1 FROM target), shares.shared, shares.n
+			FROM shares`,
+		noteId, owner, username, limit).Scan(&noteFound, &userFound, &shared, &count)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case !noteFound:
+		return fmt.Errorf("%s: %w", op, storage.ErrNoteNotFound)
+	case !userFound:
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	case !shared && count >= limit:
+		return fmt.Errorf("%s: %w", op, storage.ErrShareLimit)
+	}
+
+	return nil
+}
+
+// UnshareNote takes back the access of username to a note of the owner.
+// It is not an error if the note was not shared with them.
+func (s *Storage) UnshareNote(ctx context.Context, noteId, owner, username string) error {
+	const op = "storage.postgres.UnshareNote"
+
+	var noteFound bool
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`WITH note AS (
+			SELECT id FROM notes WHERE id = $1 AND owner = $2 AND deleted_at IS NULL
+		), removed AS (
+			DELETE FROM note_shares
+				WHERE note_id IN (SELECT id FROM note) AND shared_with = $3
+		)
+		SELECT EXISTS (SELECT 1 FROM note)`,
+		noteId, owner, username).Scan(&noteFound)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !noteFound {
+		return fmt.Errorf("%s: %w", op, storage.ErrNoteNotFound)
+	}
+
+	return nil
+}
+
+// GetNoteShares returns who the owner's notes among ids are shared with,
+// oldest share first.
+func (s *Storage) GetNoteShares(ctx context.Context, owner string, ids []string) ([]models.NoteShare, error) {
+	const op = "storage.postgres.GetNoteShares"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT ns.note_id, ns.shared_with, ns.created_at
+			FROM note_shares ns
+				JOIN notes n ON n.id = ns.note_id
+			WHERE n.owner = $1 AND n.id = ANY($2::uuid[]) AND n.deleted_at IS NULL
+			ORDER BY ns.created_at, ns.shared_with`,
+		owner, ids)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	shares := make([]models.NoteShare, 0)
+
+	for rows.Next() {
+		share := models.NoteShare{}
+		if err := rows.Scan(&share.NoteID, &share.Username, &share.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		shares = append(shares, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return shares, nil
+}
+
+// GetSharedNotes returns up to limit live notes other users shared with
+// username, most recently updated first.
+func (s *Storage) GetSharedNotes(ctx context.Context, username string, limit int) ([]models.Note, error) {
+	const op = "storage.postgres.GetSharedNotes"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+noteColumns+`
+			FROM notes
+			WHERE id IN (SELECT note_id FROM note_shares WHERE shared_with = $1)
+				AND deleted_at IS NULL
+			ORDER BY updated_at DESC, id
+			LIMIT $2`,
+		username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	notes := make([]models.Note, 0)
+
+	for rows.Next() {
+		note := models.Note{}
+		if err := scanNote(rows, &note); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return notes, nil
+}
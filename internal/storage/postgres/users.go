@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testovoe/internal/models"
+	"testovoe/internal/storage"
+)
+
+// UpsertExternalUser creates the user on the first login and refreshes it
+// on the next ones. The username stays the one picked on the first login,
+// even if the provider later reports another one.
+func (s *Storage) UpsertExternalUser(ctx context.Context, user models.User) (models.User, error) {
+	const op = "storage.postgres.UpsertExternalUser"
+
+	err := s.conn(ctx).QueryRow(ctx,
+		`INSERT INTO users (username, issuer, subject, email)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (issuer, subject) DO UPDATE
+				SET email = EXCLUDED.email, last_login_at = now()
+			RETURNING username, created_at, last_login_at`,
+		user.Username, user.Issuer, user.Subject, user.Email).Scan(&user.Username, &user.CreatedAt, &user.LastLoginAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// CreateLocalUser adds a password user unless the username is taken and
+// reports whether it was added.
+func (s *Storage) CreateLocalUser(ctx context.Context, username, passwordHash, role string) (bool, error) {
+	const op = "storage.postgres.CreateLocalUser"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`INSERT INTO users (username, password_hash, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (username) DO NOTHING`,
+		username, passwordHash, role)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+const userColumns = `u.username, COALESCE(u.issuer, ''), COALESCE(u.subject, ''), u.email, u.password_hash,
+	u.role, u.disabled_at, u.created_at, u.last_login_at`
+
+func scanUser(row pgx.Row, user *models.User, extra ...any) error {
+	return row.Scan(append([]any{&user.Username, &user.Issuer, &user.Subject, &user.Email, &user.PasswordHash,
+		&user.Role, &user.DisabledAt, &user.CreatedAt, &user.LastLoginAt}, extra...)...)
+}
+
+func (s *Storage) GetUser(ctx context.Context, username string) (models.User, error) {
+	const op = "storage.postgres.GetUser"
+
+	var user models.User
+
+	err := scanUser(s.conn(ctx).QueryRow(ctx,
+		`SELECT `+userColumns+`,
+				(SELECT count(*) FROM notes n WHERE n.owner = u.username AND n.deleted_at IS NULL)
+			FROM users u
+			WHERE u.username = $1`,
+		username), &user, &user.NoteCount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// ListUsers returns all users with the number of notes each one owns.
+func (s *Storage) ListUsers(ctx context.Context) ([]models.User, error) {
+	const op = "storage.postgres.ListUsers"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT `+userColumns+`, count(n.id)
+			FROM users u
+			LEFT JOIN notes n ON n.owner = u.username AND n.deleted_at IS NULL
+			GROUP BY u.username
+			ORDER BY u.username`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user, &user.NoteCount); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+func (s *Storage) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	const op = "storage.postgres.SetUserDisabled"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE users
+			SET disabled_at = CASE WHEN $2::boolean THEN COALESCE(disabled_at, now()) END
+			WHERE username = $1`,
+		username, disabled)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// SetUserPassword changes the password of a local user; external users are
+// reported as not found.
+func (s *Storage) SetUserPassword(ctx context.Context, username, passwordHash string) error {
+	const op = "storage.postgres.SetUserPassword"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE users SET password_hash = $2 WHERE username = $1 AND issuer IS NULL`,
+		username, passwordHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, username, role string) error {
+	const op = "storage.postgres.SetUserRole"
+
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE users SET role = $2 WHERE username = $1`,
+		username, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) AddAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	const op = "storage.postgres.AddAuditEvent"
+
+	_, err := s.conn(ctx).Exec(ctx,
+		`INSERT INTO admin_audit (actor, action, target, details)
+			VALUES ($1, $2, $3, $4)`,
+		event.Actor, event.Action, event.Target, event.Details)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ListAuditEvents returns the latest events first.
+func (s *Storage) ListAuditEvents(ctx context.Context, limit int) ([]models.AuditEvent, error) {
+	const op = "storage.postgres.ListAuditEvents"
+
+	rows, err := s.conn(ctx).Query(ctx,
+		`SELECT id, actor, action, target, details, created_at
+			FROM admin_audit
+			ORDER BY id DESC
+			LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	events := make([]models.AuditEvent, 0)
+	for rows.Next() {
+		var e models.AuditEvent
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.Details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,19 @@
+package storage
+
+import "errors"
+
+var (
+	ErrNoteNotFound    = errors.New("note not found")
+	ErrNoteExists      = errors.New("note already exists")
+	ErrVersionConflict = errors.New("note version conflict")
+	ErrCodeNotFound    = errors.New("authorization code not found")
+	ErrClientNotFound  = errors.New("client not found")
+	ErrClientExists    = errors.New("client already exists")
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrMFANotFound     = errors.New("mfa enrollment not found")
+	ErrMFAEnabled      = errors.New("mfa already enabled")
+	ErrMFACodeUsed     = errors.New("mfa code already used")
+	ErrUserExists      = errors.New("user already exists")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrShareLimit      = errors.New("note share limit reached")
+)
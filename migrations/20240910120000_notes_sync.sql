@@ -0,0 +1,40 @@
+-- +goose Up
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS note_change_seq (
+    owner TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL DEFAULT 0
+);
+
+-- notes from before sync get a place in the change sequence of their
+-- owner, otherwise an initial sync (change_seq > 0) would never return them
+WITH numbered AS (
+    SELECT id, row_number() OVER (PARTITION BY owner ORDER BY id) AS seq
+        FROM notes
+        WHERE change_seq = 0
+)
+UPDATE notes
+    SET change_seq = numbered.seq
+    FROM numbered
+    WHERE notes.id = numbered.id;
+
+INSERT INTO note_change_seq (owner, seq)
+    SELECT owner, max(change_seq) FROM notes GROUP BY owner
+    ON CONFLICT (owner) DO UPDATE SET seq = GREATEST(note_change_seq.seq, EXCLUDED.seq);
+
+CREATE INDEX IF NOT EXISTS notes_owner_change_seq_idx ON notes (owner, change_seq);
+
+-- +goose Down
+DROP INDEX IF EXISTS notes_owner_change_seq_idx;
+
+DROP TABLE IF EXISTS note_change_seq;
+
+DELETE FROM notes WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS change_seq,
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS login_failures (
+    subject TEXT PRIMARY KEY,
+    failures INT NOT NULL,
+    last_failed_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS login_failures_last_failed_at_idx ON login_failures (last_failed_at);
+
+CREATE TABLE IF NOT EXISTS lockout_events (
+    id BIGSERIAL PRIMARY KEY,
+    subject TEXT NOT NULL,
+    event TEXT NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    actor TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS lockout_events_created_at_idx ON lockout_events (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS lockout_events;
+DROP TABLE IF EXISTS login_failures;
@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE users
+    ALTER COLUMN issuer DROP NOT NULL,
+    ALTER COLUMN subject DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS admin_audit (
+    id BIGSERIAL PRIMARY KEY,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    target TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS admin_audit_created_at_idx ON admin_audit (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS admin_audit;
+
+DELETE FROM users WHERE issuer IS NULL;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS role,
+    DROP COLUMN IF EXISTS password_hash,
+    ALTER COLUMN subject SET NOT NULL,
+    ALTER COLUMN issuer SET NOT NULL;
@@ -0,0 +1,6 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS notes_content_search_idx
+    ON notes USING GIN (to_tsvector('simple', content));
+
+-- +goose Down
+DROP INDEX IF EXISTS notes_content_search_idx;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS note_shares (
+    note_id UUID NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    shared_with TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (note_id, shared_with)
+);
+
+CREATE INDEX IF NOT EXISTS note_shares_shared_with_idx ON note_shares (shared_with, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_shares;
@@ -0,0 +1,41 @@
+// Package migrations embeds the goose migrations, so the binary knows which
+// schema version it was built for.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// LatestVersion returns the version of the newest migration.
+func LatestVersion() (int64, error) {
+	const op = "migrations.LatestVersion"
+
+	files, err := fs.Glob(FS, "*.sql")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var latest int64
+	for _, name := range files {
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			continue
+		}
+
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s: %w", op, name, err)
+		}
+
+		latest = max(latest, version)
+	}
+
+	return latest, nil
+}